@@ -15,7 +15,7 @@ func NewAIModeCardHandler(cardMsg CardMsg,
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
 
 		if cardMsg.Kind == AIModeChooseKind {
-			newCard, err, done := CommonProcessAIMode(cardMsg, cardAction,
+			newCard, err, done := CommonProcessAIMode(ctx, cardMsg, cardAction,
 				m.sessionCache)
 			if done {
 				return newCard, err
@@ -27,11 +27,11 @@ func NewAIModeCardHandler(cardMsg CardMsg,
 }
 
 // CommonProcessAIMode is the common process for choosing AI mode
-func CommonProcessAIMode(msg CardMsg, cardAction *larkcard.CardAction,
-	cache services.SessionServiceCacheInterface) (interface{},
+func CommonProcessAIMode(ctx context.Context, msg CardMsg,
+	cardAction *larkcard.CardAction, cache services.SessionServiceCacheInterface) (interface{},
 	error, bool) {
 	option := cardAction.Action.Option
-	replyMsg(context.Background(), "Select AI mode:"+option,
+	replyMsg(ctx, "Select AI mode:"+option,
 		&msg.MsgId)
 	cache.SetAIMode(msg.SessionId, openai.AIModeMap[option])
 	return nil, nil, true
@@ -19,11 +19,23 @@ func NewCardHandler(m MessageHandler) CardHandlerFunc {
 	handlers := []CardHandlerMeta{
 		NewClearCardHandler,
 		NewPicResolutionHandler,
+		NewPicSettingHandler,
+		NewPicVarMoreHandler,
+		NewPicHistoryHandler,
+		NewPicEditExitHandler,
 		NewPicTextMoreHandler,
 		NewPicModeChangeHandler,
+		NewVisionAskCardHandler,
 		NewRoleTagCardHandler,
 		NewRoleCardHandler,
+		NewRoleConfirmCardHandler,
 		NewAIModeCardHandler,
+		NewVoiceSettingHandler,
+		NewSettingsCardHandler,
+		NewKnowledgeBaseCardHandler,
+		NewScheduleCancelCardHandler,
+		NewReminderCardHandler,
+		NewReminderSnoozeCardHandler,
 	}
 
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
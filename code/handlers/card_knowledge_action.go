@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+func NewKnowledgeBaseCardHandler(cardMsg CardMsg,
+	m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == KnowledgeBaseKind {
+			m.CommonProcessKnowledgeBase(cardMsg, cardAction)
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func (m MessageHandler) CommonProcessKnowledgeBase(msg CardMsg,
+	cardAction *larkcard.CardAction) {
+	option := cardAction.Action.Option
+	name := option
+	if option == knowledgeBaseOff {
+		name = ""
+	}
+	if err := m.knowledge.Select(msg.ChatId, name); err != nil {
+		replyMsg(m.background(), "🤖️：Failed to switch knowledge base: "+
+			err.Error(), &msg.MsgId)
+		return
+	}
+	if name == "" {
+		replyMsg(m.background(), "Knowledge base has been closed",
+			&msg.MsgId)
+		return
+	}
+	replyMsg(m.background(), "Knowledge base has been switched to "+name,
+		&msg.MsgId)
+}
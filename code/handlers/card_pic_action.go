@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"start-feishubot/services"
 
@@ -11,7 +14,57 @@ import (
 func NewPicResolutionHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
 		if cardMsg.Kind == PicResolutionKind {
-			CommonProcessPicResolution(cardMsg, cardAction, m.sessionCache)
+			CommonProcessPicResolution(ctx, cardMsg, cardAction, m.sessionCache)
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func NewPicSettingHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == PicSettingKind {
+			return CommonProcessPicSetting(cardMsg, cardAction, m.sessionCache,
+				m.config().PicturePromptOptimize)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func NewPicVarMoreHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == PicVarMoreKind {
+			go func() {
+				m.CommonProcessPicVariation(cardMsg, cardMsg.Value.(string))
+			}()
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func NewPicHistoryHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == PicHistoryKind {
+			action, imageKey, _ := strings.Cut(cardMsg.Value.(string), ":")
+			go func() {
+				switch action {
+				case "vary":
+					m.CommonProcessPicVariation(cardMsg, imageKey)
+				case "edit":
+					m.CommonProcessPicEditSelect(cardMsg, imageKey)
+				}
+			}()
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func NewPicEditExitHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == PicEditExitKind {
+			m.stopPictureEdit(ctx, cardMsg.SessionId, &cardMsg.MsgId)
 			return nil, nil
 		}
 		return nil, ErrNextHandler
@@ -21,7 +74,8 @@ func NewPicResolutionHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc
 func NewPicModeChangeHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
 		if cardMsg.Kind == PicModeChangeKind {
-			newCard, err, done := CommonProcessPicModeChange(cardMsg, m.sessionCache)
+			newCard, err, done := CommonProcessPicModeChange(cardMsg, m.sessionCache,
+				m.config().PicturePromptOptimize)
 			if done {
 				return newCard, err
 			}
@@ -43,29 +97,114 @@ func NewPicTextMoreHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
 	}
 }
 
-func CommonProcessPicResolution(msg CardMsg,
+func CommonProcessPicResolution(ctx context.Context, msg CardMsg,
 	cardAction *larkcard.CardAction,
 	cache services.SessionServiceCacheInterface) {
 	option := cardAction.Action.Option
 	//fmt.Println(larkcore.Prettify(msg))
 	cache.SetPicResolution(msg.SessionId, services.Resolution(option))
 	//send text
-	replyMsg(context.Background(), "The resolution of the picture has been updated"+option,
+	replyMsg(ctx, "The resolution of the picture has been updated"+option,
 		&msg.MsgId)
 }
 
+// CommonProcessPicSetting 修改一项图片设置, 模型不支持时保留原设置并提示
+func CommonProcessPicSetting(msg CardMsg,
+	cardAction *larkcard.CardAction,
+	cache services.SessionServiceCacheInterface,
+	optimizeDefault bool) (interface{}, error) {
+	option := cardAction.Action.Option
+	options := cache.GetPicOptions(msg.SessionId)
+	optimize := cache.GetPicPromptOptimize(msg.SessionId, optimizeDefault)
+	updated := options
+	switch msg.Value {
+	case "optimize":
+		optimize = !optimize
+		cache.SetPicPromptOptimize(msg.SessionId, optimize)
+	case "model":
+		// 切换模型时重置新模型不支持的参数
+		updated = options.WithModel(option)
+	case "size":
+		updated.Size = option
+	case "quality":
+		updated.Quality = option
+	case "style":
+		updated.Style = option
+	case "n":
+		n, err := strconv.Atoi(option)
+		if err != nil {
+			return nil, nil
+		}
+		updated.N = n
+	default:
+		return nil, nil
+	}
+	warning := ""
+	if err := updated.Validate(); err != nil {
+		warning = err.Error()
+		updated = options
+	} else {
+		cache.SetPicOptions(msg.SessionId, updated)
+	}
+	return newPicSettingCard(&msg.SessionId, updated, optimize, warning)
+}
+
 func (m MessageHandler) CommonProcessPicMore(msg CardMsg) {
-	resolution := m.sessionCache.GetPicResolution(msg.SessionId)
-	//fmt.Println("resolution: ", resolution)
-	//fmt.Println("msg: ", msg)
+	options := m.sessionCache.GetPicOptions(msg.SessionId)
 	question := msg.Value.(string)
-	bs64, _ := m.gpt.GenerateOneImage(question, resolution)
-	replayImageCardByBase64(context.Background(), bs64, &msg.MsgId,
-		&msg.SessionId, question)
+	bs64s, err := m.gpt().GenerateImageWithOptions(question, options)
+	if err != nil {
+		replyMsg(m.background(), fmt.Sprintf(
+			"🤖️：The picture generation failed, please try again later～\nError message: %v", err), &msg.MsgId)
+		return
+	}
+	imageKeys, err := replayImagesCardByBase64(m.background(), bs64s,
+		&msg.MsgId, &msg.SessionId, question, msg.Optimized)
+	if err == nil {
+		m.addGeneratedPictures(msg.SessionId, question, imageKeys...)
+	}
+}
+
+// CommonProcessPicVariation 重新获取 imageKey 对应的图片并生成一张变体
+func (m MessageHandler) CommonProcessPicVariation(msg CardMsg, imageKey string) {
+	ctx := m.background()
+	data, err := m.fetchPicture(ctx, msg.SessionId, imageKey, msg.MsgId)
+	if err != nil {
+		replyMsg(ctx, fmt.Sprintf("🤖️：The download download failed, please try again later～\n Error message: %v", err),
+			&msg.MsgId)
+		return
+	}
+	resolution := m.sessionCache.GetPicOptions(msg.SessionId).VariationSize()
+	bs64, err := m.gpt().GenerateOneImageVariationData(data, resolution)
+	if err != nil {
+		replyMsg(ctx, fmt.Sprintf(
+			"🤖️：The picture generation failed, please try again later～\nError message: %v", err), &msg.MsgId)
+		return
+	}
+	newKey, err := replayVariantImageByBase64(ctx, bs64, &msg.MsgId,
+		&msg.SessionId, imageKey)
+	if err == nil {
+		m.addGeneratedPictures(msg.SessionId, "", newKey)
+	}
+}
+
+// CommonProcessPicEditSelect 把历史中的图片设为待修改的图片, 并进入图片创作模式
+func (m MessageHandler) CommonProcessPicEditSelect(msg CardMsg, imageKey string) {
+	ctx := m.background()
+	data, err := m.fetchPicture(ctx, msg.SessionId, imageKey, msg.MsgId)
+	if err != nil {
+		replyMsg(ctx, fmt.Sprintf("🤖️：The download download failed, please try again later～\n Error message: %v", err),
+			&msg.MsgId)
+		return
+	}
+	m.sessionCache.SetMode(msg.SessionId, services.ModePicCreate)
+	m.sessionCache.SetPicEditImage(msg.SessionId, data)
+	sendPicEditCard(ctx, &msg.SessionId, &msg.MsgId,
+		"Reply with an instruction such as \"make the background a beach\" to edit this picture～")
 }
 
 func CommonProcessPicModeChange(cardMsg CardMsg,
-	session services.SessionServiceCacheInterface) (
+	session services.SessionServiceCacheInterface, optimizeDefault bool) (
 	interface{}, error, bool) {
 	if cardMsg.Value == "1" {
 
@@ -76,11 +215,9 @@ func CommonProcessPicModeChange(cardMsg CardMsg,
 		session.SetPicResolution(sessionId,
 			services.Resolution256)
 
-		newCard, _ :=
-			newSendCard(
-				withHeader("🖼️ Enter the picture creation mode", larkcard.TemplateBlue),
-				withPicResolutionBtn(&sessionId),
-				withNote("remind：Reply text or picture，Let AI generate related pictures。"))
+		newCard, _ := newPicSettingCard(&sessionId,
+			session.GetPicOptions(sessionId),
+			session.GetPicPromptOptimize(sessionId, optimizeDefault), "")
 		return newCard, nil, true
 	}
 	if cardMsg.Value == "0" {
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"start-feishubot/services/reminder"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// 日期选择器回调的时间格式, 例如 2019-10-19 10:00 +0800
+const pickerDatetimeLayout = "2006-01-02 15:04 -0700"
+
+func NewReminderCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == ReminderKind {
+			return m.CommonProcessReminder(cardMsg, cardAction)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func NewReminderSnoozeCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == ReminderSnoozeKind {
+			return m.CommonProcessReminderSnooze(cardMsg, cardAction)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessReminder 处理确认、修改时间、取消和完成, 返回更新后的卡片
+func (m MessageHandler) CommonProcessReminder(msg CardMsg,
+	cardAction *larkcard.CardAction) (interface{}, error) {
+	value, _ := msg.Value.(string)
+	action, id, _ := strings.Cut(value, ":")
+	loc := m.userTimezone(cardAction.OpenID)
+
+	var update func(r *reminder.Reminder)
+	switch action {
+	case "confirm":
+		update = func(r *reminder.Reminder) {
+			// 时间已过时保持待确认, 让用户重新选择时间
+			if r.Status == reminder.StatusPending && r.DueAt.After(time.Now()) {
+				r.Status = reminder.StatusActive
+			}
+		}
+	case "time":
+		dueAt, err := parsePickerDatetime(cardAction.Action.Option, loc)
+		if err != nil {
+			return nil, err
+		}
+		update = func(r *reminder.Reminder) {
+			r.DueAt = dueAt
+		}
+	case "cancel":
+		update = func(r *reminder.Reminder) {
+			r.Status = reminder.StatusCancel
+		}
+	case "done":
+		update = func(r *reminder.Reminder) {
+			r.Status = reminder.StatusDone
+		}
+	default:
+		return nil, fmt.Errorf("unknown reminder action %s", action)
+	}
+	r, err := m.reminders.Update(id, cardAction.OpenID, update)
+	if err != nil {
+		return nil, err
+	}
+	return newReminderStatusCard(r, loc)
+}
+
+// CommonProcessReminderSnooze 稍后再次提醒
+func (m MessageHandler) CommonProcessReminderSnooze(msg CardMsg,
+	cardAction *larkcard.CardAction) (interface{}, error) {
+	value, _ := msg.Value.(string)
+	delay, id, _ := strings.Cut(value, ":")
+	d, err := time.ParseDuration(delay)
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.reminders.Update(id, cardAction.OpenID, func(r *reminder.Reminder) {
+		r.DueAt = time.Now().Add(d)
+		r.Status = reminder.StatusActive
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReminderStatusCard(r, m.userTimezone(cardAction.OpenID))
+}
+
+func parsePickerDatetime(option string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(pickerDatetimeLayout, option); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(reminderTimeLayout, option, loc)
+}
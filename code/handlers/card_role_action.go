@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"start-feishubot/initialization"
-	"start-feishubot/services"
 	"start-feishubot/services/openai"
 
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
@@ -15,8 +17,8 @@ func NewRoleTagCardHandler(cardMsg CardMsg,
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
 
 		if cardMsg.Kind == RoleTagsChooseKind {
-			newCard, err, done := CommonProcessRoleTag(cardMsg, cardAction,
-				m.sessionCache)
+			newCard, err, done := CommonProcessRoleTag(ctx, cardMsg, cardAction,
+				m.roles)
 			if done {
 				return newCard, err
 			}
@@ -31,8 +33,8 @@ func NewRoleCardHandler(cardMsg CardMsg,
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
 
 		if cardMsg.Kind == RoleChooseKind {
-			newCard, err, done := CommonProcessRole(cardMsg, cardAction,
-				m.sessionCache)
+			newCard, err, done := CommonProcessRole(ctx, cardMsg, cardAction,
+				m.roles)
 			if done {
 				return newCard, err
 			}
@@ -42,36 +44,98 @@ func NewRoleCardHandler(cardMsg CardMsg,
 	}
 }
 
-func CommonProcessRoleTag(msg CardMsg, cardAction *larkcard.CardAction,
-	cache services.SessionServiceCacheInterface) (interface{},
+func NewRoleConfirmCardHandler(cardMsg CardMsg,
+	m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == RoleConfirmKind {
+			return nil, m.CommonProcessRoleConfirm(ctx, cardMsg, cardAction)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func CommonProcessRoleTag(ctx context.Context, msg CardMsg,
+	cardAction *larkcard.CardAction, roleList *initialization.Roles) (interface{},
 	error, bool) {
 	option := cardAction.Action.Option
 	//replyMsg(context.Background(), "已选择tag:"+option,
 	//	&msg.MsgId)
-	roles := initialization.GetTitleListByTag(option)
+	roles := roleList.GetTitleListByTag(option)
 	//fmt.Printf("roles: %s", roles)
-	SendRoleListCard(context.Background(), &msg.SessionId,
-		&msg.MsgId, option, *roles)
+	SendRoleListCard(ctx, &msg.SessionId,
+		&msg.MsgId, msg.ChatId, option, *roles)
 	return nil, nil, true
 }
 
-func CommonProcessRole(msg CardMsg, cardAction *larkcard.CardAction,
-	cache services.SessionServiceCacheInterface) (interface{},
-	error, bool) {
+// CommonProcessRole 选择角色后先展示角色详情, 确认后才开始新话题
+func CommonProcessRole(ctx context.Context, msg CardMsg,
+	cardAction *larkcard.CardAction,
+	roles *initialization.Roles) (interface{}, error, bool) {
 	option := cardAction.Action.Option
-	contentByTitle, error := initialization.GetFirstRoleContentByTitle(option)
-	if error != nil {
-		return nil, error, true
+	role := roles.GetRoleByTitle(option)
+	if role == nil {
+		return nil, errors.New("role not found"), true
 	}
-	cache.Clear(msg.SessionId)
-	systemMsg := append([]openai.Messages{}, openai.Messages{
-		Role: "system", Content: contentByTitle,
-	})
-	cache.SetMsg(msg.SessionId, systemMsg)
-	//pp.Println("systemMsg: ", systemMsg)
-	sendSystemInstructionCard(context.Background(), &msg.SessionId,
-		&msg.MsgId, contentByTitle)
-	//replyMsg(context.Background(), "已选择角色:"+contentByTitle,
-	//	&msg.MsgId)
+	sendRoleDetailCard(ctx, &msg.SessionId, &msg.MsgId, msg.ChatId, *role)
 	return nil, nil, true
 }
+
+// CommonProcessRoleConfirm 使用角色开始新话题
+func (m MessageHandler) CommonProcessRoleConfirm(ctx context.Context,
+	msg CardMsg, cardAction *larkcard.CardAction) error {
+	title, _ := msg.Value.(string)
+	role := m.roles.GetRoleByTitle(title)
+	if role == nil {
+		replyMsg(ctx, "🤖️：This role is no longer available, please choose another one～",
+			&msg.MsgId)
+		return nil
+	}
+	m.sessionCache.Clear(msg.SessionId)
+	systemMsg := m.applyRole(msg.SessionId, *role,
+		m.roleVars(ctx, cardAction.OpenID, msg.ChatId))
+	//pp.Println("systemMsg: ", systemMsg)
+	sendSystemInstructionCard(ctx, &msg.SessionId,
+		&msg.MsgId, systemMsg[0].Content)
+	return nil
+}
+
+// applyRole 把角色提示词和示例对话写入话题, 并使用角色的模型和温度.
+// 话题中已经选择的模型和 AI 模式优先
+func (m MessageHandler) applyRole(sessionId string, role initialization.Role,
+	vars map[string]string) []openai.Messages {
+	msg := []openai.Messages{{Role: "system", Content: role.Render(vars)}}
+	for _, example := range role.Examples {
+		msg = append(msg,
+			openai.Messages{Role: "user", Content: example.User},
+			openai.Messages{Role: "assistant", Content: example.Assistant})
+	}
+	m.sessionCache.SetMsg(sessionId, msg)
+	if role.Model != "" && m.sessionCache.GetModel(sessionId) == "" {
+		// 角色列表可以随时重新加载, 不在可选模型中的模型不使用
+		if m.isChatModel(role.Model) {
+			m.sessionCache.SetModel(sessionId, role.Model)
+		} else {
+			fmt.Printf("role %s: model %s is not in the chat models, ignored\n",
+				role.Title, role.Model)
+		}
+	}
+	if role.Temperature != nil && !m.sessionCache.HasAIMode(sessionId) {
+		m.sessionCache.SetAIMode(sessionId, openai.AIMode(*role.Temperature))
+	}
+	return msg
+}
+
+// roleVars 角色提示词的模板变量, 见 initialization.RoleVariables
+func (m MessageHandler) roleVars(ctx context.Context, userId string,
+	chatId string) map[string]string {
+	language := m.settings.Get(chatId).Language
+	if language == "" {
+		language = "the same language as the user"
+	}
+	loc := m.userTimezone(userId)
+	return map[string]string{
+		"language":  language,
+		"user_name": m.resolveUserName(ctx, &userId),
+		"date":      time.Now().In(loc).Format("2006-01-02"),
+	}
+}
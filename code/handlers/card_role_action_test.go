@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services"
+	"start-feishubot/services/openai"
+	"start-feishubot/services/reminder"
+	"start-feishubot/services/settings"
+)
+
+func newRoleTestHandler(t *testing.T, roles ...initialization.Role) MessageHandler {
+	dir := t.TempDir()
+	settingsStore, err := settings.NewStore(filepath.Join(dir, "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reminders, err := reminder.NewStore(filepath.Join(dir, "reminders.json"), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleList := &initialization.Roles{}
+	roleList.Set(roles)
+	userCache := services.NewUserCache()
+	userCache.SetName("ou_1", "Alice")
+	return MessageHandler{
+		roles:        roleList,
+		sessionCache: services.NewSessionCache(),
+		userCache:    userCache,
+		reminders:    reminders,
+		settings:     settingsStore,
+		state: &handlerState{config: initialization.Config{
+			ChatModels: []string{"gpt-4o", "gpt-4o-mini"},
+		}},
+	}
+}
+
+func temperature(v float64) *float64 {
+	return &v
+}
+
+func TestApplyRole(t *testing.T) {
+	role := initialization.Role{
+		Title:   "translator",
+		Content: "Translate for {{user_name}} into {{language}}.",
+		Examples: []initialization.RoleExample{
+			{User: "你好", Assistant: "Hello"},
+		},
+		Model:       "gpt-4o",
+		Temperature: temperature(0),
+	}
+	tests := []struct {
+		name string
+		role initialization.Role
+		// before 应用角色前话题中已有的选择
+		before    func(cache services.SessionServiceCacheInterface)
+		wantModel string
+		wantMode  openai.AIMode
+		wantSet   bool
+	}{
+		{"role model and zero temperature", role, nil, "gpt-4o", 0, true},
+		{"topic choices win", role, func(cache services.SessionServiceCacheInterface) {
+			cache.SetModel("s1", "gpt-4o-mini")
+			cache.SetAIMode("s1", openai.Creativity)
+		}, "gpt-4o-mini", openai.Creativity, true},
+		{"model not allowed", initialization.Role{Title: "x", Content: "x",
+			Model: "gpt-unknown"}, nil, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newRoleTestHandler(t, tt.role)
+			if tt.before != nil {
+				tt.before(m.sessionCache)
+			}
+			msg := m.applyRole("s1", tt.role, map[string]string{
+				"user_name": "Alice", "language": "English"})
+			if got := m.sessionCache.GetModel("s1"); got != tt.wantModel {
+				t.Errorf("model = %q, want %q", got, tt.wantModel)
+			}
+			if got := m.sessionCache.HasAIMode("s1"); got != tt.wantSet {
+				t.Fatalf("HasAIMode() = %v, want %v", got, tt.wantSet)
+			}
+			if got := m.sessionCache.GetAIMode("s1"); tt.wantSet && got != tt.wantMode {
+				t.Errorf("ai mode = %v, want %v", got, tt.wantMode)
+			}
+			if len(msg) != 1+2*len(tt.role.Examples) {
+				t.Fatalf("got %d messages, want system prompt and examples", len(msg))
+			}
+			if len(m.sessionCache.GetMsg("s1")) != len(msg) {
+				t.Errorf("role messages should be saved in the topic")
+			}
+		})
+	}
+}
+
+func TestChatPrompt(t *testing.T) {
+	role := initialization.Role{
+		Title:   "translator",
+		Content: "Translate for {{user_name}} into {{language}}.",
+		Examples: []initialization.RoleExample{
+			{User: "你好", Assistant: "Hello"},
+		},
+		Model:       "gpt-4o",
+		Temperature: temperature(0.2),
+	}
+	m := newRoleTestHandler(t, role)
+	sessionId, chatId := "s1", "oc_1"
+	info := &MsgInfo{sessionId: &sessionId, chatId: &chatId, userId: "ou_1"}
+
+	if msg := m.chatPrompt(context.Background(), info, settings.Settings{}); msg != nil {
+		t.Errorf("no role or system prompt should give no prompt, got %v", msg)
+	}
+	msg := m.chatPrompt(context.Background(), info,
+		settings.Settings{SystemPrompt: "be brief"})
+	if len(msg) != 1 || msg[0].Content != "be brief" {
+		t.Errorf("system prompt = %v", msg)
+	}
+	if m.sessionCache.GetModel(sessionId) != "" {
+		t.Errorf("a plain system prompt should not change the model")
+	}
+
+	chatSettings, err := m.settings.Update(chatId, "ou_1", func(s *settings.Settings) {
+		s.Role = "translator"
+		s.Language = "English"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = m.chatPrompt(context.Background(), info, chatSettings)
+	want := []openai.Messages{
+		{Role: "system", Content: "Translate for Alice into English."},
+		{Role: "user", Content: "你好"},
+		{Role: "assistant", Content: "Hello"},
+	}
+	if len(msg) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(msg), len(want))
+	}
+	for i := range want {
+		if msg[i].Role != want[i].Role || msg[i].Content != want[i].Content {
+			t.Errorf("message %d = %+v, want %+v", i, msg[i], want[i])
+		}
+	}
+	if got := m.sessionCache.GetModel(sessionId); got != "gpt-4o" {
+		t.Errorf("model = %q, want the role model", got)
+	}
+	if got := m.aiMode(sessionId, settings.Settings{Temperature: temperature(1)}); got != 0.2 {
+		t.Errorf("ai mode = %v, the role temperature should win over the settings", got)
+	}
+
+	// 话题中已经选择的模型和 AI 模式不被角色覆盖
+	m.sessionCache.Clear(sessionId)
+	m.sessionCache.SetModel(sessionId, "gpt-4o-mini")
+	m.sessionCache.SetAIMode(sessionId, openai.Fresh)
+	m.chatPrompt(context.Background(), info, chatSettings)
+	if got := m.sessionCache.GetModel(sessionId); got != "gpt-4o-mini" {
+		t.Errorf("model = %q, the topic model should be kept", got)
+	}
+	if got := m.sessionCache.GetAIMode(sessionId); got != openai.Fresh {
+		t.Errorf("ai mode = %v, the topic ai mode should be kept", got)
+	}
+
+	// 角色已从角色列表中删除
+	if msg := m.chatPrompt(context.Background(), info,
+		settings.Settings{Role: "removed"}); msg != nil {
+		t.Errorf("a removed role should give no prompt, got %v", msg)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+func NewScheduleCancelCardHandler(cardMsg CardMsg,
+	m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == ScheduleCancelKind {
+			m.CommonProcessScheduleCancel(cardMsg, cardAction)
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func (m MessageHandler) CommonProcessScheduleCancel(msg CardMsg,
+	cardAction *larkcard.CardAction) {
+	if !m.isAdmin(cardAction.OpenID) {
+		replyMsg(m.background(), "🤖️：Only administrators can manage schedules～",
+			&msg.MsgId)
+		return
+	}
+	id, _ := msg.Value.(string)
+	if err := m.removeSchedule(msg.ChatId, id); err != nil {
+		replyMsg(m.background(), fmt.Sprintf("🤖️：%v", err), &msg.MsgId)
+		return
+	}
+	replyMsg(m.background(), fmt.Sprintf("🤖️：Schedule %s cancelled", id),
+		&msg.MsgId)
+}
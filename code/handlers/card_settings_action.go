@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"start-feishubot/services/settings"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+func NewSettingsCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == SettingsKind {
+			return m.CommonProcessSettings(ctx, cardMsg, cardAction)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessSettings 修改一项会话设置, 返回更新后的设置卡片
+func (m MessageHandler) CommonProcessSettings(ctx context.Context, msg CardMsg,
+	cardAction *larkcard.CardAction) (interface{}, error) {
+	var handlerType HandlerType = UserHandler
+	if msg.ChatType == GroupChatType {
+		handlerType = GroupHandler
+	}
+	if !m.canChangeSettings(handlerType, cardAction.OpenID) {
+		replyMsg(ctx, "🤖️：Only administrators can change the group settings～",
+			&msg.MsgId)
+		return nil, nil
+	}
+	option := cardAction.Action.Option
+	// 下拉菜单未选择时不修改
+	if option == "" && msg.Value != "without_mention" &&
+		msg.Value != "voice_reply" && msg.Value != "reset" {
+		return nil, nil
+	}
+	var err error
+	if msg.Value == "reset" {
+		err = m.settings.Reset(msg.ChatId)
+	} else {
+		voiceReply := m.chatConfig(msg.ChatId).VoiceReply
+		_, err = m.settings.Update(msg.ChatId, cardAction.OpenID, func(s *settings.Settings) {
+			switch msg.Value {
+			case "role":
+				s.Role, s.SystemPrompt = fromDefault(option), ""
+			case "model":
+				s.Model = fromDefault(option)
+			case "temperature":
+				s.Temperature = nil
+				if t, err := strconv.ParseFloat(option, 64); err == nil {
+					s.Temperature = &t
+				}
+			case "without_mention":
+				s.AnswerWithoutMention = !s.AnswerWithoutMention
+			case "group_mode":
+				s.GroupMode = fromDefault(option)
+			case "language":
+				s.Language = fromDefault(option)
+			case "voice_reply":
+				on := !voiceReply
+				s.VoiceReply = &on
+			case "max_history":
+				s.MaxHistory, _ = strconv.Atoi(option)
+			}
+		})
+	}
+	if err != nil {
+		replyMsg(ctx, fmt.Sprintf("🤖️：Failed to save the settings～\nError message: %v", err),
+			&msg.MsgId)
+		return nil, nil
+	}
+	return newSettingsCard(msg.MsgId, msg.ChatId, handlerType,
+		m.settingsView(msg.ChatId))
+}
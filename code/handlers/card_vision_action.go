@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"start-feishubot/services/openai"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+func NewVisionAskCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == VisionAskKind {
+			m.CommonProcessVisionAsk(cardMsg)
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessVisionAsk 将图片加入会话, 之后在话题中的提问都会带上这张图片
+func (m MessageHandler) CommonProcessVisionAsk(msg CardMsg) {
+	ctx := m.background()
+	imageKey, _ := msg.Value.(string)
+	data, err := downloadMessageResource(ctx, msg.MsgId, imageKey, "image")
+	if err != nil {
+		replyMsg(ctx, fmt.Sprintf("🤖️：The download download failed, please try again later～\n Error message: %v", err),
+			&msg.MsgId)
+		return
+	}
+	history := m.sessionCache.GetMsg(msg.SessionId)
+	history = append(history, openai.NewImageMessage("", imageDataUrl(data)))
+	m.sessionCache.SetMsg(msg.SessionId, history)
+	replyMsg(ctx, "🤖️：Got the picture, reply in this topic with your question about it～",
+		&msg.MsgId)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+func NewVoiceSettingHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == VoiceSettingKind {
+			return CommonProcessVoiceSetting(cardMsg, cardAction, m.sessionCache,
+				m.chatConfig(cardMsg.ChatId))
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessVoiceSetting 修改语音设置, 返回更新后的设置卡片
+func CommonProcessVoiceSetting(msg CardMsg, cardAction *larkcard.CardAction,
+	cache services.SessionServiceCacheInterface,
+	config initialization.Config) (interface{}, error) {
+	settings := loadVoiceSettings(cache, config, msg.SessionId)
+	option := cardAction.Action.Option
+	switch msg.Value {
+	case "toggle":
+		cache.SetVoiceReply(msg.SessionId, !settings.reply)
+	case "transcribe_only":
+		cache.SetTranscribeOnly(msg.SessionId, !settings.transcribeOnly)
+	case "voice":
+		if option != "" {
+			cache.SetVoice(msg.SessionId, option)
+		}
+	case "language":
+		if option != "" {
+			cache.SetTranscribeLanguage(msg.SessionId, option)
+		}
+	}
+	return newVoiceSettingCard(&msg.SessionId, msg.ChatId,
+		loadVoiceSettings(cache, config, msg.SessionId))
+}
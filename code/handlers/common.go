@@ -1,21 +1,41 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 // func sendCard
 func msgFilter(msg string) string {
-	//replace @到下一个非空的字段 为 ''
-	regex := regexp.MustCompile(`@[^ ]*`)
+	//replace @机器人的占位符 为 ''
+	regex := regexp.MustCompile(`@_user_\d+|@_all`)
 	return regex.ReplaceAllString(msg, "")
 
 }
 
+// replaceMentions 把消息内容中@其他人的占位符替换为 @名字, 让模型知道提到了谁;
+// @机器人的占位符保留, 由 msgFilter 删除
+func replaceMentions(content string, mentions []*larkim.MentionEvent,
+	isBot func(mention *larkim.MentionEvent) bool) string {
+	for _, mention := range mentions {
+		if mention.Key == nil || mention.Name == nil || isBot(mention) {
+			continue
+		}
+		// 名字写入 JSON 字符串中, 需要转义
+		name, _ := json.Marshal("@" + *mention.Name)
+		content = strings.ReplaceAll(content, *mention.Key,
+			string(name[1:len(name)-1]))
+	}
+	return content
+}
+
 // Parse rich text json to text
 func parsePostContent(content string) string {
 	/*
@@ -103,6 +123,24 @@ func parsePostContent(content string) string {
 			if v1.(map[string]interface{})["tag"] == "text" {
 				text += v1.(map[string]interface{})["text"].(string)
 			}
+			if v1.(map[string]interface{})["tag"] == "at" {
+				if userId, ok := v1.(map[string]interface{})["user_id"].(string); ok {
+					text += userId
+				}
+			}
+			// 保留超链接文字和地址, 地址用于识别飞书文档链接
+			if v1.(map[string]interface{})["tag"] == "a" {
+				linkText, _ := v1.(map[string]interface{})["text"].(string)
+				href, _ := v1.(map[string]interface{})["href"].(string)
+				switch {
+				case linkText != "" && href != "" && linkText != href:
+					text += linkText + " (" + href + ")"
+				case href != "":
+					text += href
+				default:
+					text += linkText
+				}
+			}
 		}
 		// add new line
 		text += "\n"
@@ -110,6 +148,37 @@ func parsePostContent(content string) string {
 	return msgFilter(text)
 }
 
+// imageDataUrl 将图片编码为 data URL, 用于发送给图片理解模型
+func imageDataUrl(data []byte) string {
+	return "data:" + http.DetectContentType(data) + ";base64," +
+		base64.StdEncoding.EncodeToString(data)
+}
+
+// parsePostImageKeys 富文本消息中的图片
+func parsePostImageKeys(content, msgType string) []string {
+	if msgType != "post" {
+		return nil
+	}
+	var post struct {
+		Content [][]struct {
+			Tag      string `json:"tag"`
+			ImageKey string `json:"image_key"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(content), &post); err != nil {
+		return nil
+	}
+	var keys []string
+	for _, line := range post.Content {
+		for _, item := range line {
+			if item.Tag == "img" && item.ImageKey != "" {
+				keys = append(keys, item.ImageKey)
+			}
+		}
+	}
+	return keys
+}
+
 func parseContent(content, msgType string) string {
 	//"{\"text\":\"@_user_1  hahaha\"}",
 	//only get text content hahaha
@@ -198,3 +267,17 @@ func parseImageKey(content string) string {
 	imageKey := contentMap["image_key"].(string)
 	return imageKey
 }
+
+func parseFileName(content string) string {
+	var contentMap map[string]interface{}
+	err := json.Unmarshal([]byte(content), &contentMap)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	if contentMap["file_name"] == nil {
+		return ""
+	}
+	fileName := contentMap["file_name"].(string)
+	return fileName
+}
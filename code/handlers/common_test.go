@@ -0,0 +1,30 @@
+package handlers
+
+import "testing"
+
+func TestParsePostContentLink(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"text and href",
+			`{"tag":"a","text":"周报","href":"https://x.feishu.cn/docx/abc"}`,
+			"看看 周报 (https://x.feishu.cn/docx/abc)\n"},
+		{"text is the href",
+			`{"tag":"a","text":"https://x.feishu.cn/docx/abc","href":"https://x.feishu.cn/docx/abc"}`,
+			"看看 https://x.feishu.cn/docx/abc\n"},
+		{"href only", `{"tag":"a","href":"https://x.feishu.cn/docx/abc"}`,
+			"看看 https://x.feishu.cn/docx/abc\n"},
+		{"text only", `{"tag":"a","text":"周报"}`, "看看 周报\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `{"title":"","content":[[{"tag":"text","text":"看看 "},` +
+				tt.link + `]]}`
+			if got := parsePostContent(content); got != tt.want {
+				t.Errorf("parsePostContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
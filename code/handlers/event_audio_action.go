@@ -1,14 +1,13 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"os"
+	"strings"
 
-	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
 	"start-feishubot/utils/audio"
-
-	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 type AudioAction struct { /*语音*/
@@ -20,50 +19,103 @@ func (*AudioAction) Execute(a *ActionInfo) bool {
 		return true
 	}
 
-	// 只有私聊才解析语音,其他不解析
-	if a.info.handlerType != UserHandler {
-		return true
-	}
-
-	//判断是否是语音
+	//判断是否是语音, 群聊中只有机器人已参与的话题中的语音会到这里
 	if a.info.msgType == "audio" {
-		fileKey := a.info.fileKey
-		//fmt.Printf("fileKey: %s \n", fileKey)
-		msgId := a.info.msgId
-		//fmt.Println("msgId: ", *msgId)
-		req := larkim.NewGetMessageResourceReqBuilder().MessageId(
-			*msgId).FileKey(fileKey).Type("file").Build()
-		resp, err := initialization.GetLarkClient().Im.MessageResource.Get(context.Background(), req)
-		//fmt.Println(resp, err)
-		if err != nil {
-			fmt.Println(err)
-			return true
-		}
-		f := fmt.Sprintf("%s.ogg", fileKey)
-		resp.WriteFile(f)
-		defer os.Remove(f)
-
-		//fmt.Println("f: ", f)
-		output := fmt.Sprintf("%s.mp3", fileKey)
-		// 等待转换完成
-		audio.OggToWavByPath(f, output)
-		defer os.Remove(output)
-		//fmt.Println("output: ", output)
-
-		text, err := a.handler.gpt.AudioToText(output)
-		if err != nil {
-			fmt.Println(err)
-
-			sendMsg(*a.ctx, fmt.Sprintf("🤖️：The voice conversion failed, please try again later～\nError message: %v", err), a.info.msgId)
+		text, ok := transcribeOrReply(a, *a.info.msgId, a.info.fileKey)
+		if !ok {
 			return false
 		}
+		return handleTranscript(a, text)
+	}
 
-		replyMsg(*a.ctx, fmt.Sprintf("🤖️：%s", text), a.info.msgId)
-		//fmt.Println("text: ", text)
-		a.info.qParsed = text
+	// 回复语音消息并@机器人时, 转写被回复的语音
+	parentId := a.info.parentId
+	if parentId == nil || *parentId == "" ||
+		(a.info.msgType != "text" && a.info.msgType != "post") {
+		return true
+	}
+	// 命令交给后续的处理, 如 /clear、/minutes
+	if strings.HasPrefix(strings.TrimSpace(a.info.qParsed), "/") {
+		return true
+	}
+	// 话题中的消息都以根消息为 parent, 和 QuoteAction 一样, 话题已有上下文时
+	// 不再获取和转写根消息
+	if *parentId == *a.info.sessionId &&
+		a.handler.sessionCache.GetMsg(*a.info.sessionId) != nil {
+		return true
+	}
+	if a.info.handlerType == GroupHandler &&
+		!a.handler.mentionsMe(*a.ctx, a.info.mention) {
+		return true
+	}
+	items, err := fetchParentMessages(*a.ctx, a.info)
+	if err != nil || len(items) == 0 || msgTypeOf(items[0]) != "audio" ||
+		items[0].Body == nil || items[0].Body.Content == nil {
+		return true
+	}
+	text, ok := transcribeOrReply(a, *parentId, parseFileKey(*items[0].Body.Content))
+	if !ok {
+		return false
+	}
+	// 附带的文字作为问题, 转写结果作为引用
+	if a.info.qParsed != "" {
+		a.info.quoted = text
 		return true
 	}
+	return handleTranscript(a, text)
+}
+
+// transcribeOrReply 转写语音, 失败或没有识别出内容时回复提示并返回 false
+func transcribeOrReply(a *ActionInfo, msgId string, fileKey string) (string, bool) {
+	text, err := a.handler.transcribe(*a.ctx, msgId, fileKey, *a.info.sessionId)
+	if err != nil {
+		fmt.Println(err)
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：The voice conversion failed, please try again later～\nError message: %v", err), a.info.msgId)
+		return "", false
+	}
+	if text == "" {
+		replyMsg(*a.ctx, "🤖️：No speech was recognized in this voice message～", a.info.msgId)
+		return "", false
+	}
+	return text, true
+}
 
+// handleTranscript 只转写模式下回复转写结果后结束, 否则把转写结果作为问题
+func handleTranscript(a *ActionInfo, text string) bool {
+	if a.handler.sessionCache.GetTranscribeOnly(*a.info.sessionId,
+		a.handler.config().TranscribeOnly) {
+		replyMsg(*a.ctx, fmt.Sprintf("📝 Transcript：\n%s", text), a.info.msgId)
+		return false
+	}
+	replyMsg(*a.ctx, fmt.Sprintf("🤖️：%s", text), a.info.msgId)
+	a.info.qParsed = text
 	return true
+}
 
+// transcribe 下载飞书语音并转写, 超过接口限制的长录音分段转写
+func (m MessageHandler) transcribe(ctx context.Context, msgId string,
+	fileKey string, sessionId string) (string, error) {
+	if text, ok := m.msgCache.GetTranscript(msgId); ok {
+		return text, nil
+	}
+	data, err := downloadMessageResource(ctx, msgId, fileKey, "file")
+	if err != nil {
+		return "", fmt.Errorf("downloading voice: %w", err)
+	}
+	pcm, _, err := audio.DecodeOggOpus(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decoding voice: %w", err)
+	}
+	language := m.sessionCache.GetTranscribeLanguage(sessionId,
+		m.config().TranscribeLanguage)
+	if language == autoLanguage {
+		language = ""
+	}
+	text, err := m.gpt().TranscribePCM(pcm, audio.OpusSampleRate,
+		openai.TranscribeOptions{Language: language})
+	if err != nil {
+		return "", err
+	}
+	m.msgCache.SetTranscript(msgId, text)
+	return text, nil
 }
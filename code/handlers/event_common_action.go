@@ -3,8 +3,8 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"strings"
 
-	"start-feishubot/initialization"
 	"start-feishubot/services/openai"
 	"start-feishubot/utils"
 
@@ -16,11 +16,18 @@ type MsgInfo struct {
 	msgType     string
 	msgId       *string
 	chatId      *string
+	userId      string
+	parentId    *string
 	qParsed     string
+	quoted      string
 	fileKey     string
+	fileName    string
 	imageKey    string
+	imageKeys   []string // 富文本消息中的图片
 	sessionId   *string
 	mention     []*larkim.MentionEvent
+	// parentMessages 被回复的消息, 获取后缓存, 见 fetchParentMessages
+	parentMessages []*larkim.Message
 }
 type ActionInfo struct {
 	handler *MessageHandler
@@ -53,7 +60,31 @@ func (*ProcessMentionAction) Execute(a *ActionInfo) bool {
 	}
 	// 群聊判断是否提到机器人
 	if a.info.handlerType == GroupHandler {
-		if a.handler.judgeIfMentionMe(a.info.mention) {
+		sessionId := *a.info.sessionId
+		if a.handler.mentionsMe(*a.ctx, a.info.mention) {
+			a.handler.msgCache.TagEngaged(sessionId)
+			return true
+		}
+		// 文件、视频和语音无法@机器人, 在机器人已参与的话题中直接处理
+		if (a.info.msgType == "file" || a.info.msgType == "audio" ||
+			a.info.msgType == "media") && a.handler.engaged(sessionId) {
+			return true
+		}
+		// 只@了其他人的消息不回答
+		if len(a.info.mention) > 0 {
+			return false
+		}
+		chatSettings := a.handler.settings.Get(*a.info.chatId)
+		// 会话设置为不需要@机器人时, 回答所有消息
+		if chatSettings.AnswerWithoutMention {
+			return true
+		}
+		modes := a.handler.groupModes(chatSettings)
+		if modes["thread"] && a.handler.engaged(sessionId) {
+			return true
+		}
+		if modes["keyword"] && a.handler.matchKeyword(a.info.qParsed) {
+			a.handler.msgCache.TagEngaged(sessionId)
 			return true
 		}
 		return false
@@ -65,6 +96,10 @@ type EmptyAction struct { /*空消息*/
 }
 
 func (*EmptyAction) Execute(a *ActionInfo) bool {
+	// 图片消息没有文字, 交给图片处理
+	if a.info.msgType == "image" || len(a.info.imageKeys) > 0 {
+		return true
+	}
 	if len(a.info.qParsed) == 0 {
 		sendMsg(*a.ctx, "🤖️：What do you want to know ~", a.info.chatId)
 		fmt.Println("msgId", *a.info.msgId,
@@ -123,7 +158,7 @@ type BalanceAction struct { /*余额*/
 func (*BalanceAction) Execute(a *ActionInfo) bool {
 	if _, foundBalance := utils.EitherTrimEqual(a.info.qParsed,
 		"/balance", "Balance"); foundBalance {
-		balanceResp, err := a.handler.gpt.GetBalance()
+		balanceResp, err := a.handler.gpt().GetBalance()
 		if err != nil {
 			replyMsg(*a.ctx, "Failure to query the balance, please try it later", a.info.msgId)
 			return false
@@ -134,6 +169,40 @@ func (*BalanceAction) Execute(a *ActionInfo) bool {
 	return true
 }
 
+type ReloadConfigAction struct { /*重新加载配置*/
+}
+
+func (*ReloadConfigAction) Execute(a *ActionInfo) bool {
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/reload-config", "Reload config"); !found {
+		return true
+	}
+	if len(a.handler.config().AdminUsers) == 0 {
+		replyMsg(*a.ctx, "🤖️：Set ADMIN_USERS to reload the config by command, "+
+			"changes to the config file are also reloaded automatically～", a.info.msgId)
+		return false
+	}
+	if !a.handler.isConfiguredAdmin(a.info.userId) {
+		replyMsg(*a.ctx, "🤖️：Only administrators can reload the config～",
+			a.info.msgId)
+		return false
+	}
+	restart, err := a.handler.reloader.Reload()
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The config was not reloaded, the previous config is still in use～\n%v", err),
+			a.info.msgId)
+		return false
+	}
+	msg := "🤖️：The config and role list have been reloaded～"
+	if len(restart) > 0 {
+		msg += fmt.Sprintf("\nRestart the bot to apply changes to %s",
+			strings.Join(restart, ", "))
+	}
+	replyMsg(*a.ctx, msg, a.info.msgId)
+	return false
+}
+
 type RoleListAction struct { /*角色列表*/
 }
 
@@ -147,8 +216,9 @@ func (*RoleListAction) Execute(a *ActionInfo) bool {
 		//a.handler.sessionCache.SetMsg(*a.info.sessionId, systemMsg)
 		//sendSystemInstructionCard(*a.ctx, a.info.sessionId,
 		//	a.info.msgId, system)
-		tags := initialization.GetAllUniqueTags()
-		SendRoleTagsCard(*a.ctx, a.info.sessionId, a.info.msgId, *tags)
+		tags := a.handler.roles.GetAllUniqueTags()
+		SendRoleTagsCard(*a.ctx, a.info.sessionId, a.info.msgId, *a.info.chatId,
+			*tags)
 		return false
 	}
 	return true
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"start-feishubot/services/document"
+	"start-feishubot/services/openai"
+	"start-feishubot/utils/audio"
+)
+
+const (
+	// 检索时带入上下文的分块数量
+	documentTopK = 4
+	// 文档小于该字符数时直接全文带入, 无需检索
+	documentFullTextLength = 2400
+)
+
+type FileAction struct { /*文档*/
+}
+
+func (*FileAction) Execute(a *ActionInfo) bool {
+	if a.info.msgType != "file" && a.info.msgType != "media" {
+		return true
+	}
+	if a.info.msgType == "media" || audio.IsMediaFile(a.info.fileName) {
+		replyMsg(*a.ctx, "🤖️：Reply to this file with */minutes* to get the meeting notes～",
+			a.info.msgId)
+		return false
+	}
+	if !document.IsSupported(a.info.fileName) {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：Only %s documents are supported for now～",
+			strings.Join(document.SupportedFormats(), "/")), a.info.msgId)
+		return false
+	}
+
+	data, err := downloadMessageResource(*a.ctx, *a.info.msgId,
+		a.info.fileKey, "file")
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The file download failed, please try again later～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	doc, err := document.Parse(a.info.fileName, data)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：Unable to read the document～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+
+	a.handler.sessionCache.SetDocument(*a.info.sessionId, doc)
+	sendDocumentLoadedCard(*a.ctx, a.info.sessionId, a.info.msgId, doc)
+	return false
+}
+
+// withDocumentContext 将文档中与问题相关的内容作为 system 消息插入到用户问题之前,
+// 这部分内容只用于本次请求, 不写入会话历史
+func withDocumentContext(doc *document.Document, question string,
+	msg []openai.Messages) []openai.Messages {
+	if doc == nil || len(msg) == 0 {
+		return msg
+	}
+	chunks := doc.Chunks
+	if doc.Length() > documentFullTextLength {
+		chunks = doc.Search(question, documentTopK)
+	}
+
+	var excerpts strings.Builder
+	for _, c := range chunks {
+		excerpts.WriteString(fmt.Sprintf("[%s]\n%s\n\n", c.Location, c.Content))
+	}
+	system := openai.Messages{
+		Role: "system",
+		Content: fmt.Sprintf("Answer the user's question using only the "+
+			"following excerpts from the document \"%s\". Cite the page or "+
+			"section in square brackets after each fact you use, e.g. [page 2]. "+
+			"If the excerpts do not contain the answer, say so.\n\n%s",
+			doc.Name, strings.TrimSpace(excerpts.String())),
+	}
+
+	result := make([]openai.Messages, 0, len(msg)+1)
+	result = append(result, msg[:len(msg)-1]...)
+	result = append(result, system, msg[len(msg)-1])
+	return result
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+)
+
+// 关闭知识库的菜单选项
+const knowledgeBaseOff = "__off__"
+
+type KnowledgeBaseAction struct { /*知识库*/
+}
+
+func (*KnowledgeBaseAction) Execute(a *ActionInfo) bool {
+	if _, foundKb := utils.EitherTrimEqual(a.info.qParsed,
+		"/kb", "Knowledge base"); foundKb {
+		if !a.handler.gpt().SupportsEmbeddings() {
+			replyMsg(*a.ctx, "🤖️：Knowledge bases on Azure need AZURE_EMBEDDING_DEPLOYMENT_NAME in the config～",
+				a.info.msgId)
+			return false
+		}
+		names := a.handler.knowledge.List()
+		if len(names) == 0 {
+			replyMsg(*a.ctx, "🤖️：No knowledge base found, please build one with --ingest first～",
+				a.info.msgId)
+			return false
+		}
+		SendKnowledgeBaseCard(*a.ctx, a.info.sessionId, a.info.msgId,
+			a.info.chatId, a.handler.knowledge.Selected(*a.info.chatId), names)
+		return false
+	}
+	return true
+}
+
+// withKnowledgeContext 检索会话群所选知识库, 将相关分块及来源作为 system 消息
+// 插入到用户问题之前, 只用于本次请求
+func (m MessageHandler) withKnowledgeContext(chatId string, question string,
+	msg []openai.Messages) []openai.Messages {
+	name := m.knowledge.Selected(chatId)
+	if name == "" || len(msg) == 0 || !m.gpt().SupportsEmbeddings() {
+		return msg
+	}
+	idx, err := m.knowledge.Get(name)
+	if err != nil {
+		fmt.Printf("failed to load knowledge base %s: %v\n", name, err)
+		return msg
+	}
+	vector, err := m.gpt().Embedding(question)
+	if err != nil {
+		fmt.Printf("failed to embed question: %v\n", err)
+		return msg
+	}
+	results := idx.Search(vector, m.config().KnowledgeBaseTopK)
+	if len(results) == 0 {
+		return msg
+	}
+
+	var excerpts strings.Builder
+	for _, r := range results {
+		excerpts.WriteString(fmt.Sprintf("[%s - %s]\n%s\n\n",
+			r.Source, r.Location, r.Content))
+	}
+	system := openai.Messages{
+		Role: "system",
+		Content: fmt.Sprintf("The following excerpts come from the knowledge "+
+			"base \"%s\". Prefer them when answering, and list the sources "+
+			"you used at the end in the form [file - section]. If they are "+
+			"irrelevant, answer normally.\n\n%s",
+			name, strings.TrimSpace(excerpts.String())),
+	}
+
+	result := make([]openai.Messages, 0, len(msg)+1)
+	result = append(result, msg[:len(msg)-1]...)
+	result = append(result, system, msg[len(msg)-1])
+	return result
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"start-feishubot/services/document"
+	"start-feishubot/services/larkdoc"
+)
+
+// 一条消息中最多读取的文档数量
+const maxLinkedDocs = 3
+
+type LarkDocAction struct { /*飞书文档*/
+}
+
+func (*LarkDocAction) Execute(a *ActionInfo) bool {
+	links := larkdoc.ParseLinks(a.info.qParsed + "\n" + a.info.quoted)
+	if len(links) == 0 {
+		return true
+	}
+	if len(links) > maxLinkedDocs {
+		links = links[:maxLinkedDocs]
+	}
+	var tokens []string
+	for _, link := range links {
+		tokens = append(tokens, link.Token)
+	}
+	source := strings.Join(tokens, ",")
+	// 同一篇文档已经在本会话中时不再重复读取
+	previous := a.handler.sessionCache.GetDocument(*a.info.sessionId)
+	if previous != nil && previous.Source == source {
+		return true
+	}
+
+	var parts []string
+	var titles []string
+	for _, link := range links {
+		doc, err := larkdoc.Fetch(*a.ctx, link)
+		if errors.Is(err, larkdoc.ErrPermissionDenied) {
+			sendDocPermissionCard(*a.ctx, a.info.sessionId, a.info.msgId,
+				link.Url, a.handler.config().FeishuBotName)
+			return false
+		}
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf(
+				"🤖️：Unable to read the document %s～\nError message: %v",
+				link.Url, err), a.info.msgId)
+			return false
+		}
+		titles = append(titles, doc.Title)
+		parts = append(parts, doc.Markdown)
+	}
+
+	doc, err := document.Parse("linked.md", []byte(strings.Join(parts, "\n\n")))
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：Unable to read the document～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	doc.Name = strings.Join(titles, ", ")
+	doc.Source = source
+	if previous != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The document %s replaced %s in this topic～",
+			doc.Name, previous.Name), a.info.msgId)
+	}
+	// 文档内容作为本会话的问答文档, 由 MessageAction 带入上下文
+	a.handler.sessionCache.SetDocument(*a.info.sessionId, doc)
+	return true
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+	"start-feishubot/utils/audio"
+)
+
+const (
+	// 每段上传转写的最大字节数, 低于接口 25MB 的限制
+	minutesPartBytes = 24 << 20
+	// 分段总结时每段转写记录最多占用的 token 数
+	minutesChunkTokens = 3000
+)
+
+type MinutesAction struct { /*会议纪要*/
+}
+
+func (*MinutesAction) Execute(a *ActionInfo) bool {
+	if _, foundMinutes := utils.CutCommand(a.info.qParsed,
+		"/minutes", "Meeting notes"); !foundMinutes {
+		return true
+	}
+	check := AzureModeCheck(a)
+	if !check {
+		return false
+	}
+	parentId := a.info.parentId
+	if parentId == nil || *parentId == "" {
+		replyMsg(*a.ctx, "🤖️：Reply to an audio or video file with */minutes* to get the meeting notes～",
+			a.info.msgId)
+		return false
+	}
+	items, err := fetchParentMessages(*a.ctx, a.info)
+	if err != nil || len(items) == 0 || items[0].Body == nil ||
+		items[0].Body.Content == nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：Unable to read the replied message～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	content := *items[0].Body.Content
+	fileName := parseFileName(content)
+	switch msgTypeOf(items[0]) {
+	case "audio":
+		fileName = "voice.opus"
+	case "media":
+	case "file":
+		if !audio.IsMediaFile(fileName) {
+			replyMsg(*a.ctx, "🤖️：Only audio and video files can be turned into meeting notes～",
+				a.info.msgId)
+			return false
+		}
+	default:
+		replyMsg(*a.ctx, "🤖️：Reply to an audio or video file with */minutes* to get the meeting notes～",
+			a.info.msgId)
+		return false
+	}
+
+	replyMsg(*a.ctx, fmt.Sprintf(
+		"🤖️：Transcribing %s, this may take a few minutes～", fileName), a.info.msgId)
+	transcription, err := a.handler.transcribeMedia(*a.ctx, *parentId,
+		parseFileKey(content), fileName, *a.info.sessionId)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The transcription failed, please try again later～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	lines := transcriptLines(transcription)
+	if len(lines) == 0 {
+		replyMsg(*a.ctx, "🤖️：No speech was recognized in this file～", a.info.msgId)
+		return false
+	}
+
+	summary, err := a.handler.summarizeMeeting(lines)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The message robot is rotten, please try again later～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	sendMinutesCard(*a.ctx, a.info.msgId, summary, fileName, transcription)
+
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "-transcript.txt"
+	fileKey, err := uploadFile(*a.ctx, []byte(strings.Join(lines, "\n")+"\n"), name)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：Failed to upload the transcript～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	replyFile(*a.ctx, fileKey, a.info.msgId)
+	return false
+}
+
+// transcribeMedia 下载录音或视频, 提取音频后分段转写
+func (m MessageHandler) transcribeMedia(ctx context.Context, msgId string,
+	fileKey string, fileName string, sessionId string) (*openai.Transcription, error) {
+	data, err := downloadMessageResource(ctx, msgId, fileKey, "file")
+	if err != nil {
+		return nil, fmt.Errorf("downloading file: %w", err)
+	}
+	parts, err := audio.SplitForTranscription(fileName, data, minutesPartBytes)
+	if errors.Is(err, audio.ErrNoAudioTrack) {
+		return nil, errors.New("the file has no audio track")
+	}
+	if err != nil {
+		return nil, err
+	}
+	language := m.sessionCache.GetTranscribeLanguage(sessionId,
+		m.config().TranscribeLanguage)
+	if language == autoLanguage {
+		language = ""
+	}
+	return m.gpt().TranscribeParts(parts, openai.TranscribeOptions{Language: language})
+}
+
+// transcriptLines 把转写结果整理为 "[hh:mm:ss] 内容" 的逐句记录
+func transcriptLines(t *openai.Transcription) []string {
+	var lines []string
+	for _, segment := range t.Segments {
+		lines = append(lines, fmt.Sprintf("[%s] %s",
+			formatTimestamp(segment.Start), segment.Text))
+	}
+	if len(lines) == 0 && t.Text != "" {
+		lines = append(lines, t.Text)
+	}
+	return lines
+}
+
+func formatTimestamp(seconds float64) string {
+	s := int(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// summarizeMeeting 转写记录过长时分段总结, 再把各段的总结合并为一份会议纪要
+func (m MessageHandler) summarizeMeeting(lines []string) (*ChatSummary, error) {
+	var chunks []string
+	var chunk []string
+	tokens := 0
+	for _, line := range lines {
+		lineMsg := openai.Messages{Content: line}
+		length := lineMsg.CalculateTokenLength()
+		if tokens+length > minutesChunkTokens && len(chunk) > 0 {
+			chunks = append(chunks, strings.Join(chunk, "\n"))
+			chunk, tokens = nil, 0
+		}
+		chunk = append(chunk, line)
+		tokens += length
+	}
+	chunks = append(chunks, strings.Join(chunk, "\n"))
+
+	var partials []*ChatSummary
+	for i, transcript := range chunks {
+		summary, err := m.completeMeetingNotes("You write meeting notes from a timestamped "+
+			"meeting transcript. Use the language of the meeting. Mention the "+
+			"timestamp of important points. Leave lists empty when nothing applies.",
+			transcript)
+		if err != nil {
+			return nil, fmt.Errorf("summarizing part %d of %d: %w", i+1, len(chunks), err)
+		}
+		partials = append(partials, summary)
+	}
+	if len(partials) == 1 {
+		return partials[0], nil
+	}
+	merged, err := json.Marshal(partials)
+	if err != nil {
+		return nil, err
+	}
+	return m.completeMeetingNotes("You merge the notes of consecutive parts of one meeting "+
+		"into a single set of meeting notes. Use the language of the notes. "+
+		"Remove duplicates and keep the timestamps.", string(merged))
+}
+
+func (m MessageHandler) completeMeetingNotes(system string, content string) (*ChatSummary, error) {
+	msg := []openai.Messages{
+		{Role: "system", Content: system},
+		{Role: "user", Content: content},
+	}
+	summary := &ChatSummary{}
+	err := m.gpt().StructuredCompletions(msg, openai.Fresh, summary,
+		openai.StructuredOptions{
+			Name:        "meeting_notes",
+			Description: "Summary, decisions, action items and open questions of the meeting",
+		})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
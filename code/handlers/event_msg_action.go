@@ -1,22 +1,46 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 
 	"start-feishubot/services/openai"
+	"start-feishubot/services/tools"
 )
 
 type MessageAction struct { /*消息*/
 }
 
 func (*MessageAction) Execute(a *ActionInfo) bool {
+	chatSettings := a.handler.settings.Get(*a.info.chatId)
 	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
-	msg = append(msg, openai.Messages{
-		Role: "user", Content: a.info.qParsed,
-	})
+	if len(msg) == 0 {
+		// 新话题使用会话设置的默认角色
+		msg = a.handler.chatPrompt(*a.ctx, a.info, chatSettings)
+	}
+	userMsg, err := a.handler.userMessage(*a.ctx, a.info)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：The download download failed, please try again later～\n Error message: %v", err),
+			a.info.msgId)
+		return false
+	}
+	msg = append(msg, userMsg)
 	// get ai mode as temperature
-	aiMode := a.handler.sessionCache.GetAIMode(*a.info.sessionId)
-	completions, err := a.handler.gpt.Completions(msg, aiMode)
+	aiMode := a.handler.aiMode(*a.info.sessionId, chatSettings)
+	// 会话中有文档时, 带上文档相关内容
+	doc := a.handler.sessionCache.GetDocument(*a.info.sessionId)
+	// 只限制本次请求带上的历史, 会话中保存完整的历史
+	reqMsg := limitHistory(msg, chatSettings.MaxHistory)
+	reqMsg = withDocumentContext(doc, a.info.qParsed, reqMsg)
+	// 会话群选择了知识库时, 检索知识库
+	reqMsg = a.handler.withKnowledgeContext(*a.info.chatId, a.info.qParsed,
+		reqMsg)
+	reqMsg = withReplyLanguage(reqMsg, chatSettings.Language)
+	completions, records, err := a.handler.complete(*a.ctx, a.info,
+		reqMsg, aiMode)
+	if len(records) > 0 {
+		defer sendToolRecordsCard(*a.ctx, a.info.msgId, records)
+	}
 	if err != nil {
 		replyMsg(*a.ctx, fmt.Sprintf(
 			"🤖️：The message robot is rotten, please try again later～\nError message: %v", err), a.info.msgId)
@@ -29,6 +53,7 @@ func (*MessageAction) Execute(a *ActionInfo) bool {
 		//fmt.Println("new topic", msg[1].Content)
 		sendNewTopicCard(*a.ctx, a.info.sessionId, a.info.msgId,
 			completions.Content)
+		a.handler.replyVoice(*a.ctx, a.info, completions.Content)
 		return false
 	}
 	err = replyMsg(*a.ctx, completions.Content, a.info.msgId)
@@ -37,5 +62,58 @@ func (*MessageAction) Execute(a *ActionInfo) bool {
 			"🤖️：The message robot is rotten, please try again later～\nError message: %v", err), a.info.msgId)
 		return false
 	}
+	a.handler.replyVoice(*a.ctx, a.info, completions.Content)
 	return true
 }
+
+// userMessage 用户的提问, 图片消息和富文本中的图片作为多模态内容
+func (m MessageHandler) userMessage(ctx context.Context,
+	info *MsgInfo) (openai.Messages, error) {
+	text := withQuotedContext(info.quoted, info.qParsed)
+	imageKeys := info.imageKeys
+	if info.msgType == "image" {
+		imageKeys = []string{info.imageKey}
+	}
+	if len(imageKeys) == 0 {
+		return openai.Messages{Role: "user", Content: text}, nil
+	}
+	var urls []string
+	for _, key := range imageKeys {
+		data, err := downloadMessageResource(ctx, *info.msgId, key, "image")
+		if err != nil {
+			return openai.Messages{}, err
+		}
+		urls = append(urls, imageDataUrl(data))
+	}
+	return openai.NewImageMessage(text, urls...), nil
+}
+
+// complete 会话中有图片时使用图片理解模型;
+// 开启工具调用时, 由模型决定是否调用工具后再回答
+func (m MessageHandler) complete(ctx context.Context, info *MsgInfo,
+	msg []openai.Messages, aiMode openai.AIMode) (openai.Messages,
+	[]tools.Record, error) {
+	for _, v := range msg {
+		if v.HasImage() {
+			resp, err := m.gpt().VisionCompletions(msg, aiMode)
+			return resp, nil, err
+		}
+	}
+	// 话题中角色的模型优先, 其次是会话设置的模型
+	model := m.sessionCache.GetModel(*info.sessionId)
+	if model == "" {
+		model = m.settings.Get(*info.chatId).Model
+	}
+	gpt := m.gpt().WithModel(model)
+	if !m.config().ToolsEnabled {
+		resp, err := gpt.Completions(msg, aiMode)
+		return resp, nil, err
+	}
+	caller := tools.Caller{
+		UserId: info.userId,
+		ChatId: *info.chatId,
+		Admin:  m.isConfiguredAdmin(info.userId),
+	}
+	return m.tools.Run(ctx, gpt, caller, msg, aiMode,
+		m.config().ToolMaxIterations)
+}
@@ -2,15 +2,15 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	"start-feishubot/initialization"
 	"start-feishubot/services"
 	"start-feishubot/services/openai"
 	"start-feishubot/utils"
-
-	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 type PicAction struct { /*图片*/
@@ -30,7 +30,22 @@ func (*PicAction) Execute(a *ActionInfo) bool {
 		a.handler.sessionCache.SetPicResolution(*a.info.sessionId,
 			services.Resolution256)
 		sendPicCreateInstructionCard(*a.ctx, a.info.sessionId,
-			a.info.msgId)
+			a.info.msgId, a.handler.sessionCache.GetPicOptions(*a.info.sessionId),
+			a.handler.sessionCache.GetPicPromptOptimize(*a.info.sessionId,
+				a.handler.config().PicturePromptOptimize))
+		return false
+	}
+
+	// 列出会话中的图片
+	if _, foundHistory := utils.EitherTrimEqual(a.info.qParsed,
+		"/images", "Picture history"); foundHistory {
+		history := a.handler.sessionCache.GetPicHistory(*a.info.sessionId)
+		if len(history) == 0 {
+			replyMsg(*a.ctx, "🤖️：There are no pictures in this topic yet～", a.info.msgId)
+			return false
+		}
+		sendPicHistoryCard(*a.ctx, a.info.sessionId, a.info.msgId, history,
+			a.handler.userTimezone(a.info.userId))
 		return false
 	}
 
@@ -39,69 +54,195 @@ func (*PicAction) Execute(a *ActionInfo) bool {
 
 	// 收到一张图片,且不在图片创作模式下, 提醒是否切换到图片创作模式
 	if a.info.msgType == "image" && mode != services.ModePicCreate {
-		sendPicModeCheckCard(*a.ctx, a.info.sessionId, a.info.msgId)
+		sendPicModeCheckCard(*a.ctx, a.info.sessionId, a.info.msgId,
+			a.info.imageKey)
 		return false
 	}
 
 	if a.info.msgType == "image" && mode == services.ModePicCreate {
-		//保存图片
-		imageKey := a.info.imageKey
-		//fmt.Printf("fileKey: %s \n", imageKey)
-		msgId := a.info.msgId
-		//fmt.Println("msgId: ", *msgId)
-		req := larkim.NewGetMessageResourceReqBuilder().MessageId(
-			*msgId).FileKey(imageKey).Type("image").Build()
-		resp, err := initialization.GetLarkClient().Im.MessageResource.Get(context.Background(), req)
-		//fmt.Println(resp, err)
+		data, err := downloadMessageResource(*a.ctx, *a.info.msgId,
+			a.info.imageKey, "image")
 		if err != nil {
-			//fmt.Println(err)
 			replyMsg(*a.ctx, fmt.Sprintf("🤖️：The download download failed, please try again later～\n Error message: %v", err),
 				a.info.msgId)
 			return false
 		}
-
-		f := fmt.Sprintf("%s.png", imageKey)
-		resp.WriteFile(f)
-		defer os.Remove(f)
-		resolution := a.handler.sessionCache.GetPicResolution(*a.
-			info.sessionId)
-
-		openai.ConvertJpegToPNG(f)
-		openai.ConvertToRGBA(f, f)
-
-		//图片校验
-		err = openai.VerifyPngs([]string{f})
+		resolution := a.handler.sessionCache.GetPicOptions(*a.
+			info.sessionId).VariationSize()
+		// 转换为正方形 PNG, 缩小到目标尺寸并压缩到 4MB 以内
+		data, err = a.handler.preprocessPicture(data, resolution)
 		if err != nil {
-			replyMsg(*a.ctx, fmt.Sprintf("🤖️：Unable to parse the picture, please send the original picture and try to re -operate～"),
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：Unable to parse the picture, please send a JPEG, PNG, GIF or WebP picture～\nError message: %v", err),
 				a.info.msgId)
 			return false
 		}
-		bs64, err := a.handler.gpt.GenerateOneImageVariation(f, resolution)
+		// 保存原图, 之后的文字指令用于修改这张图片
+		a.handler.sessionCache.SetPicEditImage(*a.info.sessionId, data)
+		a.handler.sessionCache.AddPicHistory(*a.info.sessionId, services.PicHistoryItem{
+			ImageKey: a.info.imageKey, MsgId: *a.info.msgId, CreatedAt: time.Now(),
+		})
+		bs64, err := a.handler.gpt().GenerateOneImageVariationData(data, resolution)
 		if err != nil {
 			replyMsg(*a.ctx, fmt.Sprintf(
 				"🤖️：The picture generation failed, please try again later～\nError message: %v", err), a.info.msgId)
 			return false
 		}
-		replayImagePlainByBase64(*a.ctx, bs64, a.info.msgId)
+		imageKey, err := replayVariantImageByBase64(*a.ctx, bs64, a.info.msgId,
+			a.info.sessionId, a.info.imageKey)
+		if err == nil {
+			a.handler.addGeneratedPictures(*a.info.sessionId, "", imageKey)
+		}
+		sendPicEditCard(*a.ctx, a.info.sessionId, a.info.msgId,
+			"Reply with an instruction such as \"make the background a beach\" to edit the original picture～")
 		return false
 
 	}
 
+	// 修改之前发送的图片, 直到用户退出修改
+	if mode == services.ModePicCreate &&
+		a.handler.sessionCache.GetPicEditImage(*a.info.sessionId) != nil {
+		if _, foundExit := utils.EitherTrimEqual(a.info.qParsed,
+			"/stop_edit", "Stop editing"); foundExit {
+			a.handler.stopPictureEdit(*a.ctx, *a.info.sessionId, a.info.msgId)
+			return false
+		}
+		a.handler.editPicture(a)
+		return false
+	}
+
 	// 生成图片
 	if mode == services.ModePicCreate {
-		resolution := a.handler.sessionCache.GetPicResolution(*a.
-			info.sessionId)
-		bs64, err := a.handler.gpt.GenerateOneImage(a.info.qParsed,
-			resolution)
+		options := a.handler.sessionCache.GetPicOptions(*a.info.sessionId)
+		prompt, optimized := a.handler.picturePrompt(*a.info.sessionId,
+			a.info.qParsed)
+		bs64s, err := a.handler.gpt().GenerateImageWithOptions(prompt, options)
 		if err != nil {
 			replyMsg(*a.ctx, fmt.Sprintf(
 				"🤖️：The picture generation failed, please try again later～\nError message: %v", err), a.info.msgId)
 			return false
 		}
-		replayImageCardByBase64(*a.ctx, bs64, a.info.msgId, a.info.sessionId,
-			a.info.qParsed)
+		imageKeys, err := replayImagesCardByBase64(*a.ctx, bs64s, a.info.msgId,
+			a.info.sessionId, prompt, optimized)
+		if err == nil {
+			a.handler.addGeneratedPictures(*a.info.sessionId, prompt,
+				imageKeys...)
+		}
 		return false
 	}
 
 	return true
 }
+
+// editPicture 按文字指令修改会话中的图片, 图片的透明区域作为蒙版;
+// 没有透明区域时整张图片都可以被修改
+func (m MessageHandler) editPicture(a *ActionInfo) {
+	sessionId := *a.info.sessionId
+	image := m.sessionCache.GetPicEditImage(sessionId)
+	mask, transparent, err := openai.CreateMaskData(image)
+	if err != nil {
+		replyMsg(*a.ctx, "🤖️：Unable to parse the picture, please send the original picture and try to re -operate～",
+			a.info.msgId)
+		return
+	}
+	resolution := m.sessionCache.GetPicOptions(sessionId).VariationSize()
+	bs64, err := m.gpt().GenerateOneImageEditData(image, mask, a.info.qParsed, resolution)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The picture generation failed, please try again later～\nError message: %v", err), a.info.msgId)
+		return
+	}
+	// 继续修改生成后的图片
+	if data, err := base64.StdEncoding.DecodeString(bs64); err == nil {
+		m.sessionCache.SetPicEditImage(sessionId, data)
+	}
+	if imageKey, err := replayImagePlainByBase64(*a.ctx, bs64,
+		a.info.msgId); err == nil {
+		m.addGeneratedPictures(sessionId, a.info.qParsed, imageKey)
+	}
+	tip := "Reply with another instruction to keep editing the new picture～"
+	if !transparent {
+		tip += "\nTip: send a PNG whose area to change is transparent to keep the rest of the picture unchanged～"
+	}
+	sendPicEditCard(*a.ctx, a.info.sessionId, a.info.msgId, tip)
+}
+
+// stopPictureEdit 清除待修改的图片, 之后的文字重新用于生成图片
+func (m MessageHandler) stopPictureEdit(ctx context.Context, sessionId string,
+	msgId *string) {
+	m.sessionCache.SetPicEditImage(sessionId, nil)
+	replyMsg(ctx, "🤖️：Stopped editing, reply with a description to generate new pictures～",
+		msgId)
+}
+
+// preprocessPicture 按配置的方式把图片转换为图片接口可以接受的 PNG, size 形如 256x256
+func (m MessageHandler) preprocessPicture(data []byte, size string) ([]byte, error) {
+	side, _ := strconv.Atoi(strings.SplitN(size, "x", 2)[0])
+	return openai.PreprocessImage(data, openai.PreprocessOptions{
+		Fit:  openai.PictureFit(m.config().PictureFit),
+		Size: side,
+	})
+}
+
+// picturePrompt 开启提示词扩写时返回扩写后的提示词; 扩写失败时使用原文
+func (m MessageHandler) picturePrompt(sessionId string,
+	prompt string) (string, bool) {
+	if !m.sessionCache.GetPicPromptOptimize(sessionId,
+		m.config().PicturePromptOptimize) {
+		return prompt, false
+	}
+	optimized, err := m.gpt().OptimizeImagePrompt(prompt,
+		m.config().PicturePromptTranslate)
+	if err != nil {
+		fmt.Printf("failed to optimize the picture prompt: %v\n", err)
+		return prompt, false
+	}
+	return optimized, true
+}
+
+// addGeneratedPictures 把机器人上传的图片记录到会话的图片历史中
+func (m MessageHandler) addGeneratedPictures(sessionId string, prompt string,
+	imageKeys ...string) {
+	var items []services.PicHistoryItem
+	for _, key := range imageKeys {
+		items = append(items, services.PicHistoryItem{
+			ImageKey: key, Prompt: prompt, CreatedAt: time.Now(),
+		})
+	}
+	m.sessionCache.AddPicHistory(sessionId, items...)
+}
+
+// fetchPicture 重新获取历史中的图片并预处理为图片接口可以接受的 PNG;
+// 用户发送的图片从消息中下载, 机器人生成的图片通过 image_key 下载.
+// 已不在历史中的图片先尝试从卡片所回复的消息 msgId 中下载
+func (m MessageHandler) fetchPicture(ctx context.Context, sessionId string,
+	imageKey string, msgId string) ([]byte, error) {
+	var data []byte
+	var err error
+	item, found := findPicHistory(m.sessionCache.GetPicHistory(sessionId), imageKey)
+	switch {
+	case found && item.MsgId != "":
+		data, err = downloadMessageResource(ctx, item.MsgId, imageKey, "image")
+	case found:
+		data, err = downloadImage(ctx, imageKey)
+	default:
+		data, err = downloadMessageResource(ctx, msgId, imageKey, "image")
+		if err != nil {
+			data, err = downloadImage(ctx, imageKey)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	resolution := m.sessionCache.GetPicOptions(sessionId).VariationSize()
+	return m.preprocessPicture(data, resolution)
+}
+
+func findPicHistory(history []services.PicHistoryItem,
+	imageKey string) (services.PicHistoryItem, bool) {
+	for _, item := range history {
+		if item.ImageKey == imageKey {
+			return item, true
+		}
+	}
+	return services.PicHistoryItem{}, false
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"start-feishubot/initialization"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// 引用内容最大长度, 避免超长的合并转发撑爆上下文
+const maxQuotedLength = 3000
+
+type QuoteAction struct { /*引用消息*/
+}
+
+func (*QuoteAction) Execute(a *ActionInfo) bool {
+	parentId := a.info.parentId
+	// 被回复的语音已经转写为引用内容
+	if parentId == nil || *parentId == "" || a.info.quoted != "" {
+		return true
+	}
+	// 回复的是话题的根消息, 且话题已有上下文, 无需重复引用
+	if *parentId == *a.info.sessionId &&
+		a.handler.sessionCache.GetMsg(*a.info.sessionId) != nil {
+		return true
+	}
+	items, err := fetchParentMessages(*a.ctx, a.info)
+	if err != nil {
+		fmt.Printf("failed to fetch quoted message %s: %v\n", *parentId, err)
+		return true
+	}
+	a.info.quoted = quotedContent(items)
+	return true
+}
+
+// fetchParentMessages 获取被回复的消息, 合并转发时包含其中的子消息.
+// 结果保存在 info 中, 同一条消息只请求一次
+func fetchParentMessages(ctx context.Context, info *MsgInfo) ([]*larkim.Message, error) {
+	if info.parentMessages != nil {
+		return info.parentMessages, nil
+	}
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Im.Message.Get(ctx, larkim.NewGetMessageReqBuilder().
+		MessageId(*info.parentId).
+		Build())
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success() {
+		return nil, errors.New(resp.Msg)
+	}
+	info.parentMessages = []*larkim.Message{}
+	if resp.Data != nil {
+		info.parentMessages = append(info.parentMessages, resp.Data.Items...)
+	}
+	return info.parentMessages, nil
+}
+
+// quotedContent 被回复消息的文本内容, 机器人自己发出的消息返回空
+func quotedContent(items []*larkim.Message) string {
+	if len(items) == 0 {
+		return ""
+	}
+	parent := items[0]
+	if parent.Sender != nil && parent.Sender.SenderType != nil &&
+		*parent.Sender.SenderType == "app" {
+		return ""
+	}
+
+	var text string
+	if msgTypeOf(parent) == "merge_forward" {
+		text = parseMergeForward(parent, items[1:])
+	} else {
+		text = parseMessageItem(parent)
+	}
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) > maxQuotedLength {
+		text = string([]rune(text)[:maxQuotedLength]) + "..."
+	}
+	return text
+}
+
+// parseMergeForward 将合并转发中的子消息按顺序拼接为聊天记录
+func parseMergeForward(parent *larkim.Message, items []*larkim.Message) string {
+	var lines []string
+	for _, item := range items {
+		if item.UpperMessageId == nil || *item.UpperMessageId != *parent.MessageId {
+			continue
+		}
+		text := strings.TrimSpace(parseMessageItem(item))
+		if text == "" {
+			continue
+		}
+		lines = append(lines, "- "+text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parseMessageItem(item *larkim.Message) string {
+	if item.Body == nil || item.Body.Content == nil {
+		return ""
+	}
+	switch msgType := msgTypeOf(item); msgType {
+	case "text", "post":
+		return parseContent(*item.Body.Content, msgType)
+	case "image":
+		return "[image]"
+	case "file", "audio", "media":
+		return fmt.Sprintf("[%s]", msgType)
+	default:
+		return ""
+	}
+}
+
+func msgTypeOf(item *larkim.Message) string {
+	if item.MsgType == nil {
+		return ""
+	}
+	return *item.MsgType
+}
+
+// withQuotedContext 将引用内容拼接到用户问题之前
+func withQuotedContext(quoted string, question string) string {
+	if quoted == "" {
+		return question
+	}
+	return fmt.Sprintf("Quoted message:\n\"\"\"\n%s\n\"\"\"\n\n%s",
+		quoted, question)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"start-feishubot/services/openai"
+	"start-feishubot/services/reminder"
+	"start-feishubot/utils"
+)
+
+const reminderTimeLayout = "2006-01-02 15:04"
+
+const reminderUsage = "Usage:\n" +
+	"/remind <when> <what> - e.g. /remind tomorrow at 3pm to send the report\n" +
+	"/remind list - list your reminders\n" +
+	"/timezone <zone> - set your time zone, e.g. /timezone Europe/Berlin"
+
+type ReminderAction struct { /*个人提醒*/
+}
+
+func (*ReminderAction) Execute(a *ActionInfo) bool {
+	if zone, ok := utils.CutCommand(a.info.qParsed,
+		"/timezone", "Timezone"); ok {
+		a.handler.setTimezone(a, zone)
+		return false
+	}
+
+	request, ok := utils.CutCommand(a.info.qParsed, "/remind")
+	if ok {
+		if request == "" || request == "list" {
+			sendReminderListCard(*a.ctx, a.info.msgId,
+				a.handler.reminders.List(a.info.userId),
+				a.handler.userTimezone(a.info.userId))
+			return false
+		}
+	} else if !isReminderRequest(a.info.qParsed) {
+		return true
+	} else {
+		request = a.info.qParsed
+	}
+	if a.info.userId == "" {
+		return true
+	}
+
+	loc := a.handler.userTimezone(a.info.userId)
+	parsed, err := a.handler.extractReminder(request, time.Now().In(loc))
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The message robot is rotten, please try again later～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	if !parsed.IsReminder {
+		// 只是提到了提醒, 交给后续的对话处理
+		if ok {
+			replyMsg(*a.ctx, "🤖️：I could not find a time in your request～\n"+reminderUsage,
+				a.info.msgId)
+			return false
+		}
+		return true
+	}
+	dueAt, err := time.ParseInLocation(reminderTimeLayout, parsed.Time, loc)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：I could not understand the time %q～\n%s",
+			parsed.Time, reminderUsage), a.info.msgId)
+		return false
+	}
+	r, err := a.handler.reminders.Add(a.info.userId, parsed.Content, dueAt)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：Failed to save the reminder～\nError message: %v", err),
+			a.info.msgId)
+		return false
+	}
+	sendReminderConfirmCard(*a.ctx, a.info.msgId, r, loc)
+	return false
+}
+
+// isReminderRequest 粗略判断消息是否在请求提醒, 具体时间交给模型解析
+func isReminderRequest(msg string) bool {
+	lower := strings.ToLower(msg)
+	return strings.Contains(lower, "remind me") || strings.Contains(msg, "提醒我")
+}
+
+func (m MessageHandler) setTimezone(a *ActionInfo, zone string) {
+	if zone == "" {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：Your time zone is %s\n%s",
+			m.userTimezone(a.info.userId), reminderUsage), a.info.msgId)
+		return
+	}
+	if err := m.reminders.SetTimezone(a.info.userId, zone); err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：%v, please use a name like Asia/Shanghai～", err),
+			a.info.msgId)
+		return
+	}
+	replyMsg(*a.ctx, "🤖️：Your time zone has been set to "+zone, a.info.msgId)
+}
+
+type ParsedReminder struct {
+	IsReminder bool   `json:"is_reminder" desc:"false when the user does not ask to be reminded at a specific time"`
+	Time       string `json:"time" desc:"the due time in the format YYYY-MM-DD HH:MM in the user's time zone"`
+	Content    string `json:"content" desc:"what to remind, in the language of the user, without the time"`
+}
+
+// extractReminder 让模型从自然语言中解析出提醒时间和内容
+func (m MessageHandler) extractReminder(request string,
+	now time.Time) (*ParsedReminder, error) {
+	msg := []openai.Messages{
+		{Role: "system", Content: fmt.Sprintf(
+			"You extract reminders from user messages. The current time is %s (%s, time zone %s). "+
+				"When only a day is given, use 09:00.",
+			now.Format(reminderTimeLayout), now.Weekday(), now.Location())},
+		{Role: "user", Content: request},
+	}
+	parsed := &ParsedReminder{}
+	err := m.gpt().StructuredCompletions(msg, openai.Fresh, parsed,
+		openai.StructuredOptions{Name: "reminder"})
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(parsed.Content) == "" {
+		parsed.Content = request
+	}
+	return parsed, nil
+}
+
+// fireReminder 到期后私聊提醒用户
+func (m MessageHandler) fireReminder(r reminder.Reminder) {
+	sendReminderCard(m.background(), r, m.userTimezone(r.UserId))
+}
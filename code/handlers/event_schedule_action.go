@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+	"start-feishubot/services/scheduler"
+	"start-feishubot/utils"
+)
+
+const scheduleUsage = "Usage:\n" +
+	"/schedule - list the schedules of this chat\n" +
+	"/schedule add <cron> | <prompt> - e.g. /schedule add 0 9 * * 1 | write a weekly report template\n" +
+	"/schedule add <cron> | /summary - summarize today's discussion\n" +
+	"/schedule del <id> - cancel a schedule"
+
+type ScheduleAction struct { /*定时任务*/
+}
+
+func (*ScheduleAction) Execute(a *ActionInfo) bool {
+	args, foundSchedule := utils.CutCommand(a.info.qParsed,
+		"/schedule", "Schedule")
+	if !foundSchedule {
+		return true
+	}
+	if args == "" || args == "list" {
+		sendScheduleListCard(*a.ctx, a.info.sessionId, a.info.msgId,
+			a.handler.scheduler, *a.info.chatId)
+		return false
+	}
+	if !a.handler.isAdmin(a.info.userId) {
+		replyMsg(*a.ctx, "🤖️：Only administrators can manage schedules～",
+			a.info.msgId)
+		return false
+	}
+
+	if spec, ok := utils.CutPrefix(args, "add "); ok {
+		job, err := parseScheduleJob(spec)
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：%v\n%s", err, scheduleUsage),
+				a.info.msgId)
+			return false
+		}
+		job.ChatId = *a.info.chatId
+		job.CreatedBy = a.info.userId
+		added, err := a.handler.scheduler.Add(job)
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：Failed to add the schedule～\nError message: %v", err),
+				a.info.msgId)
+			return false
+		}
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：Schedule %s added, next run at %s",
+			added.Id, a.handler.scheduler.Next(added.Id).Format("2006-01-02 15:04")),
+			a.info.msgId)
+		return false
+	}
+	if id, ok := utils.CutPrefix(args, "del "); ok {
+		if err := a.handler.removeSchedule(*a.info.chatId, strings.TrimSpace(id)); err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：%v", err), a.info.msgId)
+			return false
+		}
+		replyMsg(*a.ctx, "🤖️：Schedule cancelled", a.info.msgId)
+		return false
+	}
+	replyMsg(*a.ctx, "🤖️："+scheduleUsage, a.info.msgId)
+	return false
+}
+
+// parseScheduleJob 解析 "<cron> | <prompt>"
+func parseScheduleJob(spec string) (scheduler.Job, error) {
+	parts := strings.SplitN(spec, "|", 2)
+	if len(parts) != 2 {
+		return scheduler.Job{}, fmt.Errorf("missing '|' between cron and prompt")
+	}
+	job := scheduler.Job{
+		Spec:   strings.TrimSpace(parts[0]),
+		Prompt: strings.TrimSpace(parts[1]),
+		Kind:   scheduler.KindPrompt,
+	}
+	if job.Prompt == "/summary" {
+		job.Kind = scheduler.KindSummary
+		job.Prompt = ""
+	}
+	job.Name = job.Prompt
+	if job.Kind == scheduler.KindSummary {
+		job.Name = "Daily summary"
+	}
+	return job, nil
+}
+
+// removeSchedule 只能取消本群的任务
+func (m MessageHandler) removeSchedule(chatId string, id string) error {
+	for _, job := range m.scheduler.List(chatId) {
+		if job.Id == id {
+			return m.scheduler.Remove(id)
+		}
+	}
+	return fmt.Errorf("schedule %s not found in this chat", id)
+}
+
+// runScheduledJob 执行定时任务, 结果发送到任务所在的群.
+// loc 为调度器的时区, 总结任务从该时区的当天零点开始
+func (m MessageHandler) runScheduledJob(job scheduler.Job, loc *time.Location) {
+	ctx := m.background()
+	chatId := job.ChatId
+	switch job.Kind {
+	case scheduler.KindSummary:
+		now := time.Now().In(loc)
+		since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		items, err := fetchChatHistory(ctx, chatId, since, maxSummaryCount)
+		if err != nil {
+			fmt.Printf("schedule %s failed to read history: %v\n", job.Id, err)
+			return
+		}
+		transcript, used := m.buildTranscript(ctx, items, "", loc)
+		if used == 0 {
+			return
+		}
+		summary, err := m.summarizeTranscript(transcript)
+		if err != nil {
+			fmt.Printf("schedule %s failed to summarize: %v\n", job.Id, err)
+			return
+		}
+		sendSummaryCardToChat(ctx, &chatId, summary, used, since)
+	default:
+		msg := []openai.Messages{{Role: "user", Content: job.Prompt}}
+		completions, err := m.gpt().Completions(msg, openai.Balance)
+		if err != nil {
+			fmt.Printf("schedule %s failed: %v\n", job.Id, err)
+			return
+		}
+		sendMsg(ctx, completions.Content, &chatId)
+	}
+}
+
+func scheduleJobs(configs []initialization.ScheduleConfig) []scheduler.Job {
+	jobs := make([]scheduler.Job, 0, len(configs))
+	for _, c := range configs {
+		jobs = append(jobs, scheduler.Job{
+			Name:   c.Name,
+			Spec:   c.Spec,
+			ChatId: c.ChatId,
+			Kind:   scheduler.JobKind(c.Kind),
+			Prompt: c.Prompt,
+		})
+	}
+	return jobs
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+	"start-feishubot/services/settings"
+	"start-feishubot/utils"
+)
+
+const settingsUsage = "Usage: /settings to open the settings card, /settings prompt <text> " +
+	"to set the default system prompt, /settings reset to restore the defaults"
+
+type SettingsAction struct { /*会话设置*/
+}
+
+func (*SettingsAction) Execute(a *ActionInfo) bool {
+	args, foundSettings := utils.CutCommand(a.info.qParsed,
+		"/settings", "Settings")
+	if !foundSettings {
+		return true
+	}
+	chatId := *a.info.chatId
+	if args == "" {
+		sendSettingsCard(*a.ctx, a.info.msgId, chatId, a.info.handlerType,
+			a.handler.settingsView(chatId))
+		return false
+	}
+	if !a.handler.canChangeSettings(a.info.handlerType, a.info.userId) {
+		replyMsg(*a.ctx, "🤖️：Only administrators can change the group settings～",
+			a.info.msgId)
+		return false
+	}
+
+	if prompt, ok := utils.CutPrefix(args, "prompt"); ok {
+		prompt = strings.TrimSpace(prompt)
+		_, err := a.handler.settings.Update(chatId, a.info.userId,
+			func(s *settings.Settings) {
+				s.SystemPrompt = prompt
+				s.Role = ""
+			})
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：Failed to save the settings～\nError message: %v", err),
+				a.info.msgId)
+			return false
+		}
+		sendSettingsCard(*a.ctx, a.info.msgId, chatId, a.info.handlerType,
+			a.handler.settingsView(chatId))
+		return false
+	}
+	if args == "reset" {
+		if err := a.handler.settings.Reset(chatId); err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：Failed to save the settings～\nError message: %v", err),
+				a.info.msgId)
+			return false
+		}
+		sendSettingsCard(*a.ctx, a.info.msgId, chatId, a.info.handlerType,
+			a.handler.settingsView(chatId))
+		return false
+	}
+	replyMsg(*a.ctx, "🤖️："+settingsUsage, a.info.msgId)
+	return false
+}
+
+// canChangeSettings 私聊的设置由用户自己修改, 群聊的设置只有管理员可以修改
+func (m MessageHandler) canChangeSettings(handlerType HandlerType, userId string) bool {
+	return handlerType != GroupHandler || m.isAdmin(userId)
+}
+
+// settingsView 设置卡片展示的会话设置和可选项
+func (m MessageHandler) settingsView(chatId string) settingsView {
+	models := m.chatModels()
+	var roles []string
+	for _, role := range *m.roles.GetRoleList() {
+		roles = append(roles, role.Title)
+	}
+	chatSettings := m.settings.Get(chatId)
+	var modes []string
+	for _, mode := range initialization.GroupModes {
+		if m.groupModes(chatSettings)[mode] {
+			modes = append(modes, mode)
+		}
+	}
+	return settingsView{
+		settings:   chatSettings,
+		roles:      roles,
+		models:     models,
+		voiceReply: m.chatConfig(chatId).VoiceReply,
+		groupMode:  strings.Join(modes, ", "),
+	}
+}
+
+// chatModels 可选的对话模型, 未配置 CHAT_MODELS 时使用内置列表
+func (m MessageHandler) chatModels() []string {
+	if models := m.config().ChatModels; len(models) > 0 {
+		return models
+	}
+	return openai.ChatModels
+}
+
+func (m MessageHandler) isChatModel(model string) bool {
+	for _, v := range m.chatModels() {
+		if v == model {
+			return true
+		}
+	}
+	return false
+}
+
+// chatConfig 叠加会话设置后的配置
+func (m MessageHandler) chatConfig(chatId string) initialization.Config {
+	config := m.config()
+	if s := m.settings.Get(chatId); s.VoiceReply != nil {
+		config.VoiceReply = *s.VoiceReply
+	}
+	return config
+}
+
+// chatPrompt 新话题的默认系统提示词, 使用会话设置的角色时同时带上示例对话、
+// 模型和温度. 角色已从角色列表中删除时不使用
+func (m MessageHandler) chatPrompt(ctx context.Context, info *MsgInfo,
+	s settings.Settings) []openai.Messages {
+	if s.SystemPrompt != "" {
+		return []openai.Messages{{Role: "system", Content: s.SystemPrompt}}
+	}
+	if s.Role == "" {
+		return nil
+	}
+	if role := m.roles.GetRoleByTitle(s.Role); role != nil {
+		return m.applyRole(*info.sessionId, *role,
+			m.roleVars(ctx, info.userId, *info.chatId))
+	}
+	return nil
+}
+
+// aiMode 话题中选择的 AI 模式优先, 其次是会话设置的温度
+func (m MessageHandler) aiMode(sessionId string, s settings.Settings) openai.AIMode {
+	if s.Temperature != nil && !m.sessionCache.HasAIMode(sessionId) {
+		return openai.AIMode(*s.Temperature)
+	}
+	return m.sessionCache.GetAIMode(sessionId)
+}
+
+// limitHistory 保留开头的系统提示词和最近的 max 条消息, max 为 0 时不限制
+func limitHistory(msg []openai.Messages, max int) []openai.Messages {
+	if max <= 0 {
+		return msg
+	}
+	head := 0
+	for head < len(msg) && msg[head].Role == "system" {
+		head++
+	}
+	if len(msg)-head <= max {
+		return msg
+	}
+	return append(append([]openai.Messages{}, msg[:head]...), msg[len(msg)-max:]...)
+}
+
+// withReplyLanguage 要求模型使用会话设置的语言回答, 不保存到会话中
+func withReplyLanguage(msg []openai.Messages, language string) []openai.Messages {
+	if language == "" {
+		return msg
+	}
+	return append(append([]openai.Messages{}, msg...), openai.Messages{
+		Role: "system", Content: fmt.Sprintf("Always answer in %s.", language),
+	})
+}
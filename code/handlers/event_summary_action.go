@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	larkcontact "github.com/larksuite/oapi-sdk-go/v3/service/contact/v3"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+const (
+	defaultSummaryCount = 50
+	maxSummaryCount     = 200
+	// 未指定起始时间时, 最多回溯的时间范围
+	defaultSummaryWindow = 24 * time.Hour
+	// 聊天记录最多占用的 token 数
+	summaryTokenBudget = 1500
+	// 拉取聊天记录的最大页数
+	maxHistoryPages = 20
+)
+
+type SummaryAction struct { /*群聊总结*/
+}
+
+func (*SummaryAction) Execute(a *ActionInfo) bool {
+	args, foundSummary := utils.CutCommand(a.info.qParsed,
+		"/summary", "Summary")
+	if !foundSummary {
+		return true
+	}
+	if a.info.handlerType != GroupHandler {
+		replyMsg(*a.ctx, "🤖️：Chat summary is only available in group chats～",
+			a.info.msgId)
+		return false
+	}
+	loc := a.handler.userTimezone(a.info.userId)
+	count, since, err := parseSummaryArgs(args, time.Now().In(loc))
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：%v\nUsage: /summary [N | since 2h | since 09:00]", err),
+			a.info.msgId)
+		return false
+	}
+
+	items, err := fetchChatHistory(*a.ctx, *a.info.chatId, since, count)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：Failed to read the chat history, please make sure the bot can read group messages～\nError message: %v", err),
+			a.info.msgId)
+		return false
+	}
+	transcript, used := a.handler.buildTranscript(*a.ctx, items,
+		*a.info.msgId, loc)
+	if used == 0 {
+		replyMsg(*a.ctx, "🤖️：There is nothing to summarize yet～", a.info.msgId)
+		return false
+	}
+
+	summary, err := a.handler.summarizeTranscript(transcript)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf(
+			"🤖️：The message robot is rotten, please try again later～\nError message: %v", err), a.info.msgId)
+		return false
+	}
+	sendSummaryCard(*a.ctx, a.info.msgId, summary, used, since)
+	return false
+}
+
+// parseSummaryArgs 解析 "N" 或 "since 2h / since 09:00 / since 2006-01-02 15:04"
+func parseSummaryArgs(args string, now time.Time) (int, time.Time, error) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return defaultSummaryCount, now.Add(-defaultSummaryWindow), nil
+	}
+	if n, err := strconv.Atoi(args); err == nil {
+		if n <= 0 {
+			return 0, time.Time{}, errors.New("the number of messages must be positive")
+		}
+		if n > maxSummaryCount {
+			n = maxSummaryCount
+		}
+		return n, now.Add(-defaultSummaryWindow), nil
+	}
+	value, ok := utils.CutPrefix(args, "since ")
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("unknown argument: %s", args)
+	}
+	value = strings.TrimSpace(value)
+	if d, err := time.ParseDuration(value); err == nil {
+		return maxSummaryCount, now.Add(-d), nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return maxSummaryCount, now.AddDate(0, 0, -days), nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		since := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(),
+			t.Minute(), 0, 0, now.Location())
+		if since.After(now) {
+			since = since.AddDate(0, 0, -1)
+		}
+		return maxSummaryCount, since, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, now.Location()); err == nil {
+		return maxSummaryCount, t, nil
+	}
+	return 0, time.Time{}, fmt.Errorf("unknown time: %s", value)
+}
+
+// fetchChatHistory 从最新的消息开始拉取 since 之后的群消息, 拉满 count 条后停止,
+// 按时间正序返回. SDK 的列表请求不支持 sort_type, 这里直接调用接口
+func fetchChatHistory(ctx context.Context, chatId string, since time.Time,
+	count int) ([]*larkim.Message, error) {
+	client := initialization.GetLarkClient(ctx)
+	var items []*larkim.Message
+	pageToken := ""
+	for page := 0; page < maxHistoryPages && len(items) < count; page++ {
+		query := larkcore.QueryParams{}
+		query.Set("container_id_type", "chat")
+		query.Set("container_id", chatId)
+		query.Set("start_time", strconv.FormatInt(since.Unix(), 10))
+		query.Set("sort_type", "ByCreateTimeDesc")
+		query.Set("page_size", "50")
+		if pageToken != "" {
+			query.Set("page_token", pageToken)
+		}
+		resp, err := client.Do(ctx, &larkcore.ApiReq{
+			HttpMethod:                http.MethodGet,
+			ApiPath:                   "/open-apis/im/v1/messages",
+			QueryParams:               query,
+			SupportedAccessTokenTypes: []larkcore.AccessTokenType{larkcore.AccessTokenTypeTenant},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Code int                        `json:"code"`
+			Msg  string                     `json:"msg"`
+			Data larkim.ListMessageRespData `json:"data"`
+		}
+		if err := json.Unmarshal(resp.RawBody, &body); err != nil {
+			return nil, err
+		}
+		if body.Code != 0 {
+			return nil, fmt.Errorf("%d %s", body.Code, body.Msg)
+		}
+		items = append(items, body.Data.Items...)
+		if body.Data.HasMore == nil || !*body.Data.HasMore ||
+			body.Data.PageToken == nil {
+			break
+		}
+		pageToken = *body.Data.PageToken
+	}
+	if len(items) > count {
+		items = items[:count]
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+// buildTranscript 过滤机器人消息, 从最新的消息往前拼接, 直到用完 token 预算,
+// 返回聊天记录和实际使用的消息数
+func (m MessageHandler) buildTranscript(ctx context.Context,
+	items []*larkim.Message, commandMsgId string, loc *time.Location) (string, int) {
+	var lines []string
+	tokens := 0
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if item.MessageId != nil && *item.MessageId == commandMsgId {
+			continue
+		}
+		if item.Deleted != nil && *item.Deleted {
+			continue
+		}
+		if item.Sender == nil || item.Sender.SenderType == nil ||
+			*item.Sender.SenderType != "user" {
+			continue
+		}
+		text := strings.TrimSpace(parseMessageItem(withMentionNames(item)))
+		if text == "" {
+			continue
+		}
+		line := fmt.Sprintf("[%s] %s: %s", messageTime(item, loc),
+			m.resolveUserName(ctx, item.Sender.Id), text)
+		lineMsg := openai.Messages{Content: line}
+		tokens += lineMsg.CalculateTokenLength()
+		if tokens > summaryTokenBudget {
+			break
+		}
+		lines = append(lines, line)
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n"), len(lines)
+}
+
+// withMentionNames 将消息中的 @_user_1 占位符替换为被@人的姓名
+func withMentionNames(item *larkim.Message) *larkim.Message {
+	if item.Body == nil || item.Body.Content == nil || len(item.Mentions) == 0 {
+		return item
+	}
+	content := *item.Body.Content
+	for _, mention := range item.Mentions {
+		if mention.Key != nil && mention.Name != nil {
+			content = strings.ReplaceAll(content, *mention.Key, *mention.Name)
+		}
+	}
+	copied := *item
+	copied.Body = &larkim.MessageBody{Content: &content}
+	return &copied
+}
+
+// messageTime 消息的发送时间, 按 loc 时区显示
+func messageTime(item *larkim.Message, loc *time.Location) string {
+	if item.CreateTime == nil {
+		return ""
+	}
+	ms, err := strconv.ParseInt(*item.CreateTime, 10, 64)
+	if err != nil {
+		return ""
+	}
+	return time.UnixMilli(ms).In(loc).Format("01-02 15:04")
+}
+
+// resolveUserName 通过通讯录接口获取用户姓名, 失败时使用 open_id
+func (m MessageHandler) resolveUserName(ctx context.Context, openId *string) string {
+	if openId == nil {
+		return "unknown"
+	}
+	if name, ok := m.userCache.GetName(*openId); ok {
+		return name
+	}
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Contact.User.Get(ctx, larkcontact.NewGetUserReqBuilder().
+		UserId(*openId).
+		UserIdType("open_id").
+		Build())
+	if err != nil || !resp.Success() || resp.Data == nil ||
+		resp.Data.User == nil || resp.Data.User.Name == nil {
+		return *openId
+	}
+	m.userCache.SetName(*openId, *resp.Data.User.Name)
+	return *resp.Data.User.Name
+}
+
+type ActionItem struct {
+	Owner string `json:"owner" desc:"who is responsible, empty when unassigned"`
+	Task  string `json:"task"`
+}
+
+type ChatSummary struct {
+	Summary       string       `json:"summary"`
+	Decisions     []string     `json:"decisions,omitempty"`
+	ActionItems   []ActionItem `json:"action_items,omitempty"`
+	OpenQuestions []string     `json:"open_questions,omitempty"`
+}
+
+func (m MessageHandler) summarizeTranscript(transcript string) (*ChatSummary, error) {
+	msg := []openai.Messages{
+		{Role: "system", Content: "You summarize group chat transcripts. " +
+			"Use the language of the chat. Leave lists empty when nothing applies."},
+		{Role: "user", Content: transcript},
+	}
+	summary := &ChatSummary{}
+	err := m.gpt().StructuredCompletions(msg, openai.Fresh, summary,
+		openai.StructuredOptions{
+			Name:        "chat_summary",
+			Description: "Summary, decisions, action items and open questions of the chat",
+		})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+func TestParseSummaryArgs(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	now := time.Date(2024, 5, 10, 14, 30, 0, 0, loc)
+	tests := []struct {
+		name      string
+		args      string
+		wantCount int
+		wantSince time.Time
+		wantErr   bool
+	}{
+		{"default", "", defaultSummaryCount, now.Add(-defaultSummaryWindow), false},
+		{"count", " 30 ", 30, now.Add(-defaultSummaryWindow), false},
+		{"count is capped", "1000", maxSummaryCount, now.Add(-defaultSummaryWindow), false},
+		{"zero count", "0", 0, time.Time{}, true},
+		{"negative count", "-5", 0, time.Time{}, true},
+		{"since duration", "since 2h", maxSummaryCount, now.Add(-2 * time.Hour), false},
+		{"since days", "since 3d", maxSummaryCount, now.AddDate(0, 0, -3), false},
+		{"since clock today", "since 09:00", maxSummaryCount,
+			time.Date(2024, 5, 10, 9, 0, 0, 0, loc), false},
+		{"since clock yesterday", "since 18:00", maxSummaryCount,
+			time.Date(2024, 5, 9, 18, 0, 0, 0, loc), false},
+		{"since date time", "since 2024-05-01 08:15", maxSummaryCount,
+			time.Date(2024, 5, 1, 8, 15, 0, 0, loc), false},
+		{"unknown time", "since yesterday", 0, time.Time{}, true},
+		{"unknown argument", "last week", 0, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, since, err := parseSummaryArgs(tt.args, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSummaryArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if count != tt.wantCount {
+				t.Errorf("count = %d, want %d", count, tt.wantCount)
+			}
+			if !since.Equal(tt.wantSince) {
+				t.Errorf("since = %v, want %v", since, tt.wantSince)
+			}
+		})
+	}
+}
+
+func TestMessageTime(t *testing.T) {
+	createTime := "1715322600000" // 2024-05-10 06:30 UTC
+	item := &larkim.Message{CreateTime: &createTime}
+	if got := messageTime(item, time.FixedZone("UTC+8", 8*60*60)); got != "05-10 14:30" {
+		t.Errorf("messageTime() = %q, want 05-10 14:30", got)
+	}
+	if got := messageTime(&larkim.Message{}, time.UTC); got != "" {
+		t.Errorf("messageTime() without a create time = %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+	"start-feishubot/utils/audio"
+)
+
+type VoiceAction struct { /*语音设置*/
+}
+
+func (*VoiceAction) Execute(a *ActionInfo) bool {
+	if _, foundVoice := utils.EitherTrimEqual(a.info.qParsed,
+		"/voice", "Voice reply"); foundVoice {
+		sendVoiceSettingCard(*a.ctx, a.info.sessionId, a.info.msgId, *a.info.chatId,
+			loadVoiceSettings(a.handler.sessionCache, a.handler.chatConfig(*a.info.chatId),
+				*a.info.sessionId))
+		return false
+	}
+	return true
+}
+
+// replyVoice 会话开启语音回复时, 把回答合成为语音发送
+func (m MessageHandler) replyVoice(ctx context.Context, info *MsgInfo,
+	text string) {
+	// Azure 接口暂不支持语音合成
+	sessionId := *info.sessionId
+	if m.config().AzureOn ||
+		!m.sessionCache.GetVoiceReply(sessionId, m.chatConfig(*info.chatId).VoiceReply) {
+		return
+	}
+	if err := m.sendVoice(ctx, sessionId, info.msgId, text); err != nil {
+		fmt.Println(err)
+		replyMsg(ctx, fmt.Sprintf("🤖️：Voice reply failed, please try again later～\nError message: %v", err), info.msgId)
+	}
+}
+
+func (m MessageHandler) sendVoice(ctx context.Context, sessionId string,
+	msgId *string, text string) error {
+	speech, err := m.gpt().TextToSpeech(text, openai.SpeechOptions{
+		Model: m.config().TTSModel,
+		Voice: m.sessionCache.GetVoice(sessionId, m.config().TTSVoice),
+		Speed: m.config().TTSSpeed,
+	})
+	if err != nil {
+		return err
+	}
+	// 飞书的语音消息需要 Ogg Opus 文件和时长
+	voice, duration, err := audio.RemuxOggOpus(speech)
+	if err != nil {
+		return fmt.Errorf("speech is not ogg opus: %w", err)
+	}
+	fileKey, err := uploadAudio(ctx, voice, duration)
+	if err != nil {
+		return err
+	}
+	return replyAudio(ctx, fileKey, msgId)
+}
@@ -3,12 +3,21 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"start-feishubot/initialization"
 	"start-feishubot/services"
+	"start-feishubot/services/knowledge"
 	"start-feishubot/services/openai"
+	"start-feishubot/services/reminder"
+	"start-feishubot/services/scheduler"
+	"start-feishubot/services/settings"
+	"start-feishubot/services/tools"
 
+	lark "github.com/larksuite/oapi-sdk-go/v3"
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
@@ -24,23 +33,72 @@ func chain(data *ActionInfo, actions ...Action) bool {
 }
 
 type MessageHandler struct {
+	// app 所属飞书应用的名称, 顶层应用为空
+	app          string
+	client       *lark.Client
+	roles        *initialization.Roles
 	sessionCache services.SessionServiceCacheInterface
 	msgCache     services.MsgCacheInterface
-	gpt          *openai.ChatGPT
-	config       initialization.Config
+	userCache    services.UserCacheInterface
+	knowledge    *knowledge.Manager
+	scheduler    *scheduler.Scheduler
+	reminders    *reminder.Store
+	settings     *settings.Store
+	tools        *tools.Registry
+	reloader     *initialization.ConfigReloader
+	state        *handlerState
+	bot          *botIdentity
+}
+
+// handlerState 热更新时整体替换的配置和 OpenAI 客户端
+type handlerState struct {
+	mu     sync.RWMutex
+	config initialization.Config
+	gpt    *openai.ChatGPT
+}
+
+func (m MessageHandler) config() initialization.Config {
+	m.state.mu.RLock()
+	defer m.state.mu.RUnlock()
+	return m.state.config
+}
+
+func (m MessageHandler) gpt() *openai.ChatGPT {
+	m.state.mu.RLock()
+	defer m.state.mu.RUnlock()
+	return m.state.gpt
+}
+
+// background 不随事件请求结束的 ctx, 用于异步任务和定时任务
+func (m MessageHandler) background() context.Context {
+	return initialization.WithLarkClient(context.Background(), m.client)
+}
+
+// reload 替换配置, 并按新配置更新 OpenAI 的 key、地址和代理
+func (m MessageHandler) reload(config initialization.Config) {
+	config, ok := config.App(m.app)
+	if !ok {
+		// 应用已从配置中删除, 重启前继续使用原配置
+		return
+	}
+	gpt := m.gpt().Reloaded(config)
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	m.state.config = config
+	m.state.gpt = gpt
 }
 
 func (m MessageHandler) cardHandler(ctx context.Context,
 	cardAction *larkcard.CardAction) (interface{}, error) {
 	messageHandler := NewCardHandler(m)
-	return messageHandler(ctx, cardAction)
+	return messageHandler(initialization.WithLarkClient(ctx, m.client), cardAction)
 }
 
 func judgeMsgType(event *larkim.P2MessageReceiveV1) (string, error) {
 	msgType := event.Event.Message.MessageType
 
 	switch *msgType {
-	case "text", "image", "audio", "post":
+	case "text", "image", "audio", "post", "file", "media":
 		return *msgType, nil
 	default:
 		return "", fmt.Errorf("unknown message type: %v", *msgType)
@@ -48,6 +106,7 @@ func judgeMsgType(event *larkim.P2MessageReceiveV1) (string, error) {
 }
 
 func (m MessageHandler) msgReceivedHandler(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
+	ctx = initialization.WithLarkClient(ctx, m.client)
 	handlerType := judgeChatType(event)
 	if handlerType == "otherChat" {
 		fmt.Println("unknown chat type")
@@ -64,21 +123,34 @@ func (m MessageHandler) msgReceivedHandler(ctx context.Context, event *larkim.P2
 	content := event.Event.Message.Content
 	msgId := event.Event.Message.MessageId
 	rootId := event.Event.Message.RootId
+	parentId := event.Event.Message.ParentId
 	chatId := event.Event.Message.ChatId
 	mention := event.Event.Message.Mentions
+	userId := ""
+	if sender := event.Event.Sender; sender != nil && sender.SenderId != nil &&
+		sender.SenderId.OpenId != nil {
+		userId = *sender.SenderId.OpenId
+	}
 
 	sessionId := rootId
 	if sessionId == nil || *sessionId == "" {
 		sessionId = msgId
 	}
+	text := replaceMentions(*content, mention, func(mention *larkim.MentionEvent) bool {
+		return m.isBotMention(ctx, mention)
+	})
 	msgInfo := MsgInfo{
 		handlerType: handlerType,
 		msgType:     msgType,
 		msgId:       msgId,
 		chatId:      chatId,
-		qParsed:     strings.Trim(parseContent(*content, msgType), " "),
+		userId:      userId,
+		parentId:    parentId,
+		qParsed:     strings.Trim(parseContent(text, msgType), " "),
 		fileKey:     parseFileKey(*content),
+		fileName:    parseFileName(*content),
 		imageKey:    parseImageKey(*content),
+		imageKeys:   parsePostImageKeys(*content, msgType),
 		sessionId:   sessionId,
 		mention:     mention,
 	}
@@ -90,15 +162,26 @@ func (m MessageHandler) msgReceivedHandler(ctx context.Context, event *larkim.P2
 	actions := []Action{
 		&ProcessedUniqueAction{}, //避免重复处理
 		&ProcessMentionAction{},  //判断机器人是否应该被调用
+		&MinutesAction{},         //会议纪要处理
 		&AudioAction{},           //语音处理
+		&FileAction{},            //文档处理
 		&EmptyAction{},           //空消息处理
 		&ClearAction{},           //清除消息处理
 		&PicAction{},             //图片处理
 		&AIModeAction{},          //模式切换处理
+		&VoiceAction{},           //语音设置处理
+		&SettingsAction{},        //会话设置处理
 		&RoleListAction{},        //角色列表处理
+		&KnowledgeBaseAction{},   //知识库选择处理
+		&SummaryAction{},         //群聊总结处理
+		&ScheduleAction{},        //定时任务处理
+		&ReminderAction{},        //个人提醒处理
 		&HelpAction{},            //帮助处理
 		&BalanceAction{},         //余额处理
+		&ReloadConfigAction{},    //重新加载配置处理
 		&RolePlayAction{},        //角色扮演处理
+		&QuoteAction{},           //引用消息处理
+		&LarkDocAction{},         //飞书文档链接处理
 		&MessageAction{},         //消息处理
 
 	}
@@ -108,26 +191,167 @@ func (m MessageHandler) msgReceivedHandler(ctx context.Context, event *larkim.P2
 
 var _ MessageHandlerInterface = (*MessageHandler)(nil)
 
-func NewMessageHandler(gpt *openai.ChatGPT,
-	config initialization.Config) MessageHandlerInterface {
-	return &MessageHandler{
-		sessionCache: services.GetSessionCache(),
-		msgCache:     services.GetMsgCache(),
-		gpt:          gpt,
-		config:       config,
+// NewMessageHandler 创建名称为 app 的飞书应用的处理器. 每个应用使用独立的
+// 飞书客户端、OpenAI key、角色列表和会话缓存
+func NewMessageHandler(app string,
+	reloader *initialization.ConfigReloader) (MessageHandlerInterface, error) {
+	config, ok := reloader.Current().App(app)
+	if !ok {
+		return nil, fmt.Errorf("unknown app %q", app)
+	}
+	// 知识库索引共用, 各应用的选择记录保存在自己的数据目录
+	selections := filepath.Join(config.DataDir, "knowledge_selections.json")
+	m := &MessageHandler{
+		app:          app,
+		client:       initialization.NewLarkClient(config),
+		roles:        reloader.Roles(app),
+		sessionCache: services.NewSessionCache(),
+		msgCache:     services.NewMsgCache(),
+		userCache:    services.NewUserCache(),
+		knowledge:    knowledge.NewManager(config.KnowledgeBaseDir, selections),
+		reloader:     reloader,
+		state:        &handlerState{config: config, gpt: openai.NewChatGPT(config)},
+		bot:          &botIdentity{},
+	}
+
+	loc, err := time.LoadLocation(config.DefaultTimezone)
+	if err != nil {
+		fmt.Printf("unknown time zone %s, using local time\n", config.DefaultTimezone)
+		loc = time.Local
+	}
+	// 数据文件损坏时不能继续运行, 否则下次保存会用空数据覆盖原文件
+	m.reminders, err = reminder.NewStore(
+		filepath.Join(config.DataDir, "reminders.json"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reminders: %w", err)
+	}
+	m.settings, err = settings.NewStore(filepath.Join(config.DataDir, "settings.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat settings: %w", err)
+	}
+	m.scheduler = scheduler.New(
+		filepath.Join(config.DataDir, "schedules.json"), loc,
+		func(job scheduler.Job) { m.runScheduledJob(job, loc) })
+	if err := m.scheduler.Load(scheduleJobs(config.Schedules)); err != nil {
+		return nil, fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	m.tools = tools.NewRegistry()
+	if err := tools.RegisterBuiltins(m.tools, loc); err != nil {
+		fmt.Printf("failed to register tools: %v\n", err)
 	}
+	m.tools.Restrict(config.AdminTools...)
+
+	m.scheduler.Start()
+	go m.reminders.Run(30*time.Second, func(r reminder.Reminder) { m.fireReminder(r) })
+	go m.botOpenId(m.background())
+	reloader.OnReload(m.reload)
+	return m, nil
 }
 
-func (m MessageHandler) judgeIfMentionMe(mention []*larkim.
-	MentionEvent) bool {
-	if len(mention) != 1 {
-		return false
+// userTimezone 用户通过 /timezone 设置的时区, 未设置时为 DEFAULT_TIMEZONE.
+// 提醒、图片历史、角色模板等按用户时区显示时间的地方都通过这里获取
+func (m MessageHandler) userTimezone(userId string) *time.Location {
+	return m.reminders.Timezone(userId)
+}
+
+// isAdmin 未配置管理员时所有人都有管理权限
+func (m MessageHandler) isAdmin(openId string) bool {
+	if len(m.config().AdminUsers) == 0 {
+		return true
+	}
+	return m.isConfiguredAdmin(openId)
+}
+
+// isConfiguredAdmin 只有 ADMIN_USERS 中的用户才有权限, 用于重新加载配置、
+// 管理员工具等未配置管理员时也不应对所有人开放的操作
+func (m MessageHandler) isConfiguredAdmin(openId string) bool {
+	for _, admin := range m.config().AdminUsers {
+		if admin == openId {
+			return true
+		}
+	}
+	return false
+}
+
+// botInfoRetry 获取机器人信息失败后的重试间隔
+const botInfoRetry = time.Minute
+
+// botIdentity 机器人的 open_id, 获取失败时按 BOT_NAME 判断是否@机器人
+type botIdentity struct {
+	mu        sync.Mutex
+	openId    string
+	fetchedAt time.Time
+}
+
+// botOpenId 机器人的 open_id, 未获取到时返回空
+func (m MessageHandler) botOpenId(ctx context.Context) string {
+	m.bot.mu.Lock()
+	defer m.bot.mu.Unlock()
+	if m.bot.openId == "" && time.Since(m.bot.fetchedAt) > botInfoRetry {
+		m.bot.fetchedAt = time.Now()
+		info, err := getBotInfo(ctx)
+		if err != nil {
+			fmt.Printf("failed to get bot info, matching mentions by BOT_NAME: %v\n", err)
+			return ""
+		}
+		m.bot.openId = info.OpenId
+	}
+	return m.bot.openId
+}
+
+// isBotMention 是否@了机器人. 优先按 open_id 判断, 在飞书中修改机器人名称后仍然有效
+func (m MessageHandler) isBotMention(ctx context.Context,
+	mention *larkim.MentionEvent) bool {
+	if openId := m.botOpenId(ctx); openId != "" {
+		return mention.Id != nil && mention.Id.OpenId != nil &&
+			*mention.Id.OpenId == openId
+	}
+	return mention.Name != nil && *mention.Name == m.config().FeishuBotName
+}
+
+// mentionsMe 消息中的多个@中是否有机器人
+func (m MessageHandler) mentionsMe(ctx context.Context,
+	mentions []*larkim.MentionEvent) bool {
+	for _, mention := range mentions {
+		if m.isBotMention(ctx, mention) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupModes 群聊生效的触发方式, 会话设置优先于 GROUP_MODE
+func (m MessageHandler) groupModes(s settings.Settings) map[string]bool {
+	modes := map[string]bool{"mention": true}
+	values := m.config().GroupModes
+	if s.GroupMode != "" {
+		values = strings.Split(s.GroupMode, ",")
+	}
+	for _, mode := range values {
+		modes[strings.TrimSpace(mode)] = true
+	}
+	return modes
+}
+
+// engaged 机器人是否已参与该话题
+func (m MessageHandler) engaged(sessionId string) bool {
+	return m.msgCache.IfEngaged(sessionId) || m.sessionCache.Get(sessionId) != nil
+}
+
+// matchKeyword 消息是否包含 GROUP_KEYWORDS 中的关键词, 不区分大小写
+func (m MessageHandler) matchKeyword(text string) bool {
+	text = strings.ToLower(text)
+	for _, keyword := range m.config().GroupKeywords {
+		if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+			return true
+		}
 	}
-	return *mention[0].Name == m.config.FeishuBotName
+	return false
 }
 
 func AzureModeCheck(a *ActionInfo) bool {
-	if a.handler.config.AzureOn {
+	if a.handler.config().AzureOn {
 		//sendMsg(*a.ctx, "Azure Openai 接口下，暂不支持此功能", a.info.chatId)
 		return false
 	}
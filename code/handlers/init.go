@@ -3,9 +3,6 @@ package handlers
 import (
 	"context"
 
-	"start-feishubot/initialization"
-	"start-feishubot/services/openai"
-
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
@@ -22,15 +19,10 @@ const (
 	UserHandler  = "personal"
 )
 
-// handlers 所有消息类型类型的处理器
-var handlers MessageHandlerInterface
-
-func InitHandlers(gpt *openai.ChatGPT, config initialization.Config) {
-	handlers = NewMessageHandler(gpt, config)
-}
-
-func Handler(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
-	return handlers.msgReceivedHandler(ctx, event)
+// EventHandler 应用 h 的消息事件处理函数
+func EventHandler(h MessageHandlerInterface) func(ctx context.Context,
+	event *larkim.P2MessageReceiveV1) error {
+	return h.msgReceivedHandler
 }
 
 func ReadHandler(ctx context.Context, event *larkim.P2MessageReadV1) error {
@@ -39,11 +31,12 @@ func ReadHandler(ctx context.Context, event *larkim.P2MessageReadV1) error {
 	return nil
 }
 
-func CardHandler() func(ctx context.Context,
+// CardHandler 应用 h 的卡片回调处理函数
+func CardHandler(h MessageHandlerInterface) func(ctx context.Context,
 	cardAction *larkcard.CardAction) (interface{}, error) {
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
 		//handlerType := judgeCardType(cardAction)
-		return handlers.cardHandler(ctx, cardAction)
+		return h.cardHandler(ctx, cardAction)
 	}
 }
 
@@ -4,15 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	"start-feishubot/initialization"
 	"start-feishubot/services"
+	"start-feishubot/services/document"
 	"start-feishubot/services/openai"
+	"start-feishubot/services/reminder"
+	"start-feishubot/services/scheduler"
+	"start-feishubot/services/settings"
+	"start-feishubot/services/tools"
 
 	"github.com/google/uuid"
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
@@ -23,11 +34,22 @@ var (
 	ClearCardKind      = CardKind("clear")            // 清空上下文
 	PicModeChangeKind  = CardKind("pic_mode_change")  // 切换图片创作模式
 	PicResolutionKind  = CardKind("pic_resolution")   // 图片分辨率调整
+	PicSettingKind     = CardKind("pic_setting")      // 图片模型、尺寸等设置
 	PicTextMoreKind    = CardKind("pic_text_more")    // 重新根据文本生成图片
 	PicVarMoreKind     = CardKind("pic_var_more")     // 变量图片
+	PicHistoryKind     = CardKind("pic_history")      // 使用历史图片生成变体或修改
+	PicEditExitKind    = CardKind("pic_edit_exit")    // 退出图片修改, 回到文字生成图片
 	RoleTagsChooseKind = CardKind("role_tags_choose") // 内置角色所属标签选择
 	RoleChooseKind     = CardKind("role_choose")      // 内置角色选择
+	RoleConfirmKind    = CardKind("role_confirm")     // 确认使用角色
 	AIModeChooseKind   = CardKind("ai_mode_choose")   // AI模式选择
+	KnowledgeBaseKind  = CardKind("knowledge_base")   // 知识库选择
+	ScheduleCancelKind = CardKind("schedule_cancel")  // 取消定时任务
+	ReminderKind       = CardKind("reminder")         // 确认、修改、取消提醒
+	VisionAskKind      = CardKind("vision_ask")       // 针对图片提问
+	ReminderSnoozeKind = CardKind("reminder_snooze")  // 稍后提醒
+	VoiceSettingKind   = CardKind("voice_setting")    // 语音转写和语音回复设置
+	SettingsKind       = CardKind("settings")         // 会话设置
 )
 
 var (
@@ -41,6 +63,9 @@ type CardMsg struct {
 	Value     interface{}
 	SessionId string
 	MsgId     string
+	ChatId    string
+	// Optimized 图片卡片中的提示词是否经过扩写
+	Optimized bool
 }
 
 type MenuOption struct {
@@ -52,7 +77,7 @@ func replyCard(ctx context.Context,
 	msgId *string,
 	cardContent string,
 ) error {
-	client := initialization.GetLarkClient()
+	client := initialization.GetLarkClient(ctx)
 	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
 		MessageId(*msgId).
 		Body(larkim.NewReplyMessageReqBodyBuilder().
@@ -289,8 +314,8 @@ func withClearDoubleCheckBtn(sessionID *string) larkcard.MessageCardElement {
 	return actions
 }
 
-func withPicModeDoubleCheckBtn(sessionID *string) larkcard.
-	MessageCardElement {
+func withPicModeDoubleCheckBtn(sessionID *string, msgId *string,
+	imageKey string) larkcard.MessageCardElement {
 	confirmBtn := newBtn("Switch mode", map[string]interface{}{
 		"value":     "1",
 		"kind":      PicModeChangeKind,
@@ -298,6 +323,13 @@ func withPicModeDoubleCheckBtn(sessionID *string) larkcard.
 		"sessionId": *sessionID,
 	}, larkcard.MessageCardButtonTypeDanger,
 	)
+	askBtn := newBtn("Ask about this image", map[string]interface{}{
+		"value":     imageKey,
+		"kind":      VisionAskKind,
+		"chatType":  UserChatType,
+		"sessionId": *sessionID,
+		"msgId":     *msgId,
+	}, larkcard.MessageCardButtonTypePrimary)
 	cancelBtn := newBtn("let me think again", map[string]interface{}{
 		"value":     "0",
 		"kind":      PicModeChangeKind,
@@ -307,8 +339,8 @@ func withPicModeDoubleCheckBtn(sessionID *string) larkcard.
 		larkcard.MessageCardButtonTypeDefault)
 
 	actions := larkcard.NewMessageCardAction().
-		Actions([]larkcard.MessageCardActionElement{confirmBtn, cancelBtn}).
-		Layout(larkcard.MessageCardActionLayoutBisected.Ptr()).
+		Actions([]larkcard.MessageCardActionElement{confirmBtn, askBtn, cancelBtn}).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
 		Build()
 
 	return actions
@@ -325,37 +357,330 @@ func withOneBtn(btn *larkcard.MessageCardEmbedButton) larkcard.
 
 //新建对话按钮
 
-func withPicResolutionBtn(sessionID *string) larkcard.
-	MessageCardElement {
-	cancelMenu := newMenu("Default resolution",
-		map[string]interface{}{
-			"value":     "0",
-			"kind":      PicResolutionKind,
+// withPicSettingMenus 图片设置的下拉菜单和提示词扩写开关, value 为要修改的设置项
+func withPicSettingMenus(sessionID *string,
+	options openai.ImageOptions, optimize bool) larkcard.MessageCardElement {
+	settingValue := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"value":     field,
+			"kind":      PicSettingKind,
 			"sessionId": *sessionID,
 			"msgId":     *sessionID,
-		},
-		MenuOption{
-			label: "256x256",
-			value: string(services.Resolution256),
-		},
-		MenuOption{
-			label: "512x512",
-			value: string(services.Resolution512),
-		},
-		MenuOption{
-			label: "1024x1024",
-			value: string(services.Resolution1024),
-		},
-	)
+		}
+	}
+	toMenuOptions := func(values []string) []MenuOption {
+		var menuOptions []MenuOption
+		for _, v := range values {
+			menuOptions = append(menuOptions, MenuOption{value: v, label: v})
+		}
+		return menuOptions
+	}
+
+	spec, known := openai.ImageModels[options.Model]
+	menus := []larkcard.MessageCardActionElement{
+		newMenu("Model: "+options.Model, settingValue("model"),
+			toMenuOptions(openai.ImageModelNames)...),
+	}
+	if known {
+		menus = append(menus, newMenu("Size: "+options.Size,
+			settingValue("size"), toMenuOptions(spec.Sizes)...))
+		if len(spec.Qualities) > 1 {
+			menus = append(menus, newMenu("Quality: "+orDefault(options.Quality),
+				settingValue("quality"), toMenuOptions(spec.Qualities)...))
+		}
+		if len(spec.Styles) > 0 {
+			menus = append(menus, newMenu("Style: "+orDefault(options.Style),
+				settingValue("style"), toMenuOptions(spec.Styles)...))
+		}
+		if spec.MaxN > 1 {
+			var counts []string
+			for n := 1; n <= spec.MaxN && n <= maxPicCount; n++ {
+				counts = append(counts, strconv.Itoa(n))
+			}
+			menus = append(menus, newMenu(fmt.Sprintf("Count: %d", options.N),
+				settingValue("n"), toMenuOptions(counts)...))
+		}
+	}
+	optimizeLabel := "✨ Prompt optimizer: off"
+	if optimize {
+		optimizeLabel = "✨ Prompt optimizer: on"
+	}
+	menus = append(menus, newBtn(optimizeLabel, settingValue("optimize"),
+		larkcard.MessageCardButtonTypeDefault))
 
 	actions := larkcard.NewMessageCardAction().
-		Actions([]larkcard.MessageCardActionElement{cancelMenu}).
+		Actions(menus).
 		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
 		Build()
 	return actions
 }
 
-func withRoleTagsBtn(sessionID *string, tags ...string) larkcard.
+// autoLanguage 转写时自动识别语言
+const autoLanguage = "auto"
+
+// transcribeLanguages 设置卡片中可选的转写语言
+var transcribeLanguages = []string{autoLanguage, "zh", "en", "ja", "ko",
+	"fr", "de", "es", "ru"}
+
+// voiceSettings 会话的语音转写和语音回复设置
+type voiceSettings struct {
+	reply          bool
+	voice          string
+	language       string
+	transcribeOnly bool
+}
+
+func loadVoiceSettings(cache services.SessionServiceCacheInterface,
+	config initialization.Config, sessionId string) voiceSettings {
+	return voiceSettings{
+		reply:          cache.GetVoiceReply(sessionId, config.VoiceReply),
+		voice:          cache.GetVoice(sessionId, config.TTSVoice),
+		language:       cache.GetTranscribeLanguage(sessionId, config.TranscribeLanguage),
+		transcribeOnly: cache.GetTranscribeOnly(sessionId, config.TranscribeOnly),
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// newVoiceSettingCard 语音设置卡片: 转写语言、只转写开关、语音回复开关和声音选择
+func newVoiceSettingCard(sessionId *string, chatId string,
+	settings voiceSettings) (string, error) {
+	settingValue := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"value":     field,
+			"kind":      VoiceSettingKind,
+			"sessionId": *sessionId,
+			"msgId":     *sessionId,
+			"chatId":    chatId,
+		}
+	}
+	toMenuOptions := func(values []string) []MenuOption {
+		var menuOptions []MenuOption
+		for _, v := range values {
+			menuOptions = append(menuOptions, MenuOption{value: v, label: v})
+		}
+		return menuOptions
+	}
+	replyLabel := "🔊 Voice reply: " + onOff(settings.reply)
+	transcribeLabel := "📝 Transcribe only: " + onOff(settings.transcribeOnly)
+	actions := larkcard.NewMessageCardAction().
+		Actions([]larkcard.MessageCardActionElement{
+			newMenu("Language: "+settings.language, settingValue("language"),
+				toMenuOptions(transcribeLanguages)...),
+			newBtn(transcribeLabel, settingValue("transcribe_only"),
+				larkcard.MessageCardButtonTypeDefault),
+			newBtn(replyLabel, settingValue("toggle"),
+				larkcard.MessageCardButtonTypeDefault),
+			newMenu("Voice: "+settings.voice, settingValue("voice"),
+				toMenuOptions(openai.SpeechVoices)...),
+		}).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+	summary := fmt.Sprintf("**Transcription language**: %s\n**Transcribe only**: %s\n**Voice reply**: %s\n**Voice**: %s",
+		settings.language, onOff(settings.transcribeOnly), onOff(settings.reply),
+		settings.voice)
+	return newSendCard(
+		withHeader("🎤 Voice settings", larkcard.TemplateBlue),
+		withMainMd(summary),
+		actions,
+		withNote("remind：Transcribe only replies with the transcript without answering, for meeting notes。With voice reply on, every answer in this topic is also sent as a voice message。"))
+}
+
+func sendVoiceSettingCard(ctx context.Context, sessionId *string,
+	msgId *string, chatId string, settings voiceSettings) {
+	newCard, _ := newVoiceSettingCard(sessionId, chatId, settings)
+	replyCard(ctx, msgId, newCard)
+}
+
+// 会话设置卡片中可选的回答语言、温度和历史消息数
+var (
+	replyLanguages      = []string{"中文", "English", "日本語", "한국어", "Français", "Deutsch", "Español"}
+	settingTemperatures = []string{"0", "0.3", "0.5", "0.7", "1.0", "1.2"}
+	settingHistories    = []string{"2", "4", "10", "20", "50"}
+	settingGroupModes   = []string{"mention", "thread", "keyword", "thread,keyword"}
+)
+
+// settingsView 设置卡片展示的会话设置和可选项
+type settingsView struct {
+	settings settings.Settings
+	roles    []string
+	models   []string
+	// voiceReply 叠加全局配置后是否语音回复
+	voiceReply bool
+	// groupMode 叠加全局配置后群聊的触发方式
+	groupMode string
+}
+
+// newSettingsCard 会话设置卡片: 默认角色、模型、温度、回答语言、语音回复和历史消息数
+func newSettingsCard(msgId string, chatId string, handlerType HandlerType,
+	view settingsView) (string, error) {
+	chatType := UserChatType
+	if handlerType == GroupHandler {
+		chatType = GroupChatType
+	}
+	settingValue := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"value":    field,
+			"kind":     SettingsKind,
+			"chatType": chatType,
+			"chatId":   chatId,
+			"msgId":    msgId,
+		}
+	}
+	toMenuOptions := func(values []string) []MenuOption {
+		menuOptions := []MenuOption{{value: "default", label: "default"}}
+		for _, v := range values {
+			menuOptions = append(menuOptions, MenuOption{value: v, label: v})
+		}
+		return menuOptions
+	}
+	s := view.settings
+	role := orDefault(s.Role)
+	if s.SystemPrompt != "" {
+		role = "custom prompt"
+	}
+	temperature := "default"
+	if s.Temperature != nil {
+		temperature = strconv.FormatFloat(*s.Temperature, 'f', -1, 64)
+	}
+	history := "unlimited"
+	if s.MaxHistory > 0 {
+		history = fmt.Sprintf("%d messages", s.MaxHistory)
+	}
+	language := s.Language
+	if language == "" {
+		language = "same as the question"
+	}
+	menus := []larkcard.MessageCardActionElement{
+		newMenu("Role: "+role, settingValue("role"), toMenuOptions(view.roles)...),
+		newMenu("Model: "+orDefault(s.Model), settingValue("model"),
+			toMenuOptions(view.models)...),
+		newMenu("Temperature: "+temperature, settingValue("temperature"),
+			toMenuOptions(settingTemperatures)...),
+		newMenu("Language: "+orDefault(s.Language), settingValue("language"),
+			toMenuOptions(replyLanguages)...),
+		newMenu("History: "+history, settingValue("max_history"),
+			toMenuOptions(settingHistories)...),
+		newBtn("🔊 Voice reply: "+onOff(view.voiceReply), settingValue("voice_reply"),
+			larkcard.MessageCardButtonTypeDefault),
+	}
+	if handlerType == GroupHandler {
+		menus = append(menus, newMenu("Group mode: "+orDefault(s.GroupMode),
+			settingValue("group_mode"), toMenuOptions(settingGroupModes)...),
+			newBtn("💬 Answer without mention: "+
+				onOff(s.AnswerWithoutMention), settingValue("without_mention"),
+				larkcard.MessageCardButtonTypeDefault))
+	}
+	menus = append(menus, newBtn("Reset", settingValue("reset"),
+		larkcard.MessageCardButtonTypeDanger))
+	actions := larkcard.NewMessageCardAction().
+		Actions(menus).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+
+	summary := fmt.Sprintf("**Default role**: %s\n**Model**: %s\n**Temperature**: %s\n"+
+		"**Answer language**: %s\n**Voice reply**: %s\n**History**: %s",
+		role, orDefault(s.Model), temperature, language, onOff(view.voiceReply), history)
+	if handlerType == GroupHandler {
+		summary += fmt.Sprintf("\n**Group mode**: %s\n**Answer without mention**: %s",
+			view.groupMode, onOff(s.AnswerWithoutMention))
+	}
+	if s.SystemPrompt != "" {
+		summary += "\n**System prompt**: " + s.SystemPrompt
+	}
+	return newSendCard(
+		withHeader("⚙️ Chat settings", larkcard.TemplateBlue),
+		withMainMd(summary),
+		actions,
+		withNote("remind：Settings apply to every new topic in this chat and are kept until changed. Send /settings prompt <text> to set a custom system prompt. Only administrators can change the settings of a group。In thread mode the robot answers follow-ups in topics it joined without a mention, in keyword mode it answers messages with the configured keywords。"))
+}
+
+func sendSettingsCard(ctx context.Context, msgId *string, chatId string,
+	handlerType HandlerType, view settingsView) {
+	newCard, _ := newSettingsCard(*msgId, chatId, handlerType, view)
+	replyCard(ctx, msgId, newCard)
+}
+
+// maxPicCount 一次最多生成的图片数量, 避免卡片过长
+const maxPicCount = 4
+
+func orDefault(value string) string {
+	if value == "" {
+		return "default"
+	}
+	return value
+}
+
+// fromDefault 菜单中选择 default 时清除设置
+func fromDefault(option string) string {
+	if option == "default" {
+		return ""
+	}
+	return option
+}
+
+// newPicSettingCard 图片创作模式的设置卡片, warning 不为空时展示在卡片中
+func newPicSettingCard(sessionId *string, options openai.ImageOptions,
+	optimize bool, warning string) (string, error) {
+	optimizeState := "off"
+	if optimize {
+		optimizeState = "on"
+	}
+	summary := fmt.Sprintf("**Model**: %s\n**Size**: %s\n**Quality**: %s\n**Style**: %s\n**Count**: %d\n**Prompt optimizer**: %s",
+		options.Model, options.Size, orDefault(options.Quality),
+		orDefault(options.Style), options.N, optimizeState)
+	elements := []larkcard.MessageCardElement{
+		withMainMd(summary),
+		withPicSettingMenus(sessionId, options, optimize),
+	}
+	if warning != "" {
+		elements = append(elements, withMainMd("⚠️ "+warning))
+	}
+	elements = append(elements, withNote("remind：Reply text or picture，Let AI generate related pictures。After sending a picture, reply text instructions to edit it。"))
+	return newSendCard(
+		withHeader("🖼️ Enter the picture creation mode", larkcard.TemplateBlue),
+		elements...)
+}
+
+// imageCombination 飞书卡片的多图混排组件, SDK 中没有对应的结构
+type imageCombination struct {
+	imageKeys []string
+}
+
+func (imageCombination) Tag() string {
+	return "img_combination"
+}
+
+func (c imageCombination) MarshalJSON() ([]byte, error) {
+	// 两张或四张按两列排列, 其余按三列排列
+	mode := "trisect"
+	if len(c.imageKeys)%2 == 0 && len(c.imageKeys) <= 4 {
+		mode = "bisect"
+	}
+	var imgList []map[string]string
+	for _, key := range c.imageKeys {
+		imgList = append(imgList, map[string]string{"img_key": key})
+	}
+	return json.Marshal(map[string]interface{}{
+		"tag":              c.Tag(),
+		"combination_mode": mode,
+		"img_list":         imgList,
+	})
+}
+
+func withImageGrid(imageKeys []string) larkcard.MessageCardElement {
+	if len(imageKeys) == 1 {
+		return withImageDiv(imageKeys[0])
+	}
+	return imageCombination{imageKeys: imageKeys}
+}
+
+func withRoleTagsBtn(sessionID *string, chatId string, tags ...string) larkcard.
 	MessageCardElement {
 	var menuOptions []MenuOption
 
@@ -371,6 +696,7 @@ func withRoleTagsBtn(sessionID *string, tags ...string) larkcard.
 			"kind":      RoleTagsChooseKind,
 			"sessionId": *sessionID,
 			"msgId":     *sessionID,
+			"chatId":    chatId,
 		},
 		menuOptions...,
 	)
@@ -382,7 +708,7 @@ func withRoleTagsBtn(sessionID *string, tags ...string) larkcard.
 	return actions
 }
 
-func withRoleBtn(sessionID *string, titles ...string) larkcard.
+func withRoleBtn(sessionID *string, chatId string, titles ...string) larkcard.
 	MessageCardElement {
 	var menuOptions []MenuOption
 
@@ -398,6 +724,7 @@ func withRoleBtn(sessionID *string, titles ...string) larkcard.
 			"kind":      RoleChooseKind,
 			"sessionId": *sessionID,
 			"msgId":     *sessionID,
+			"chatId":    chatId,
 		},
 		menuOptions...,
 	)
@@ -435,12 +762,68 @@ func withAIModeBtn(sessionID *string, aiModeStrs []string) larkcard.MessageCardE
 	return actions
 }
 
+func withKnowledgeBaseBtn(sessionID *string, chatId *string,
+	names []string) larkcard.MessageCardElement {
+	menuOptions := []MenuOption{{
+		label: "Close knowledge base",
+		value: knowledgeBaseOff,
+	}}
+	for _, name := range names {
+		menuOptions = append(menuOptions, MenuOption{
+			label: name,
+			value: name,
+		})
+	}
+	cancelMenu := newMenu("Choose knowledge base",
+		map[string]interface{}{
+			"value":     "0",
+			"kind":      KnowledgeBaseKind,
+			"sessionId": *sessionID,
+			"msgId":     *sessionID,
+			"chatId":    *chatId,
+		},
+		menuOptions...,
+	)
+
+	actions := larkcard.NewMessageCardAction().
+		Actions([]larkcard.MessageCardActionElement{cancelMenu}).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+	return actions
+}
+
+type botInfo struct {
+	OpenId  string `json:"open_id"`
+	AppName string `json:"app_name"`
+}
+
+// getBotInfo 获取机器人的 open_id 和名称
+func getBotInfo(ctx context.Context) (*botInfo, error) {
+	resp, err := initialization.GetLarkClient(ctx).Get(ctx, "/open-apis/bot/v3/info",
+		nil, larkcore.AccessTokenTypeTenant)
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Code int     `json:"code"`
+		Msg  string  `json:"msg"`
+		Bot  botInfo `json:"bot"`
+	}
+	if err := json.Unmarshal(resp.RawBody, &body); err != nil {
+		return nil, err
+	}
+	if body.Code != 0 {
+		return nil, fmt.Errorf("getting bot info: %d %s", body.Code, body.Msg)
+	}
+	return &body.Bot, nil
+}
+
 func replyMsg(ctx context.Context, msg string, msgId *string) error {
 	msg, i := processMessage(msg)
 	if i != nil {
 		return i
 	}
-	client := initialization.GetLarkClient()
+	client := initialization.GetLarkClient(ctx)
 	content := larkim.NewTextMsgBuilder().
 		Text(msg).
 		Build()
@@ -468,14 +851,14 @@ func replyMsg(ctx context.Context, msg string, msgId *string) error {
 	return nil
 }
 
-func uploadImage(base64Str string) (*string, error) {
+func uploadImage(ctx context.Context, base64Str string) (*string, error) {
 	imageBytes, err := base64.StdEncoding.DecodeString(base64Str)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
 	}
-	client := initialization.GetLarkClient()
-	resp, err := client.Im.Image.Create(context.Background(),
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Im.Image.Create(ctx,
 		larkim.NewCreateImageReqBuilder().
 			Body(larkim.NewCreateImageReqBodyBuilder().
 				ImageType(larkim.ImageTypeMessage).
@@ -497,22 +880,107 @@ func uploadImage(base64Str string) (*string, error) {
 	return resp.Data.ImageKey, nil
 }
 
-func replyImage(ctx context.Context, ImageKey *string,
-	msgId *string) error {
-	//fmt.Println("sendMsg", ImageKey, msgId)
+// downloadImage 下载机器人上传的图片
+func downloadImage(ctx context.Context, imageKey string) ([]byte, error) {
+	req := larkim.NewGetImageReqBuilder().ImageKey(imageKey).Build()
+	resp, err := initialization.GetLarkClient(ctx).Im.Image.Get(ctx, req)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return nil, errors.New(resp.Msg)
+	}
+	return io.ReadAll(resp.File)
+}
 
-	msgImage := larkim.MessageImage{ImageKey: *ImageKey}
-	content, err := msgImage.String()
+// downloadMessageResource 下载消息中的图片或文件到内存
+func downloadMessageResource(ctx context.Context, msgId string,
+	fileKey string, resourceType string) ([]byte, error) {
+	req := larkim.NewGetMessageResourceReqBuilder().
+		MessageId(msgId).
+		FileKey(fileKey).
+		Type(resourceType).
+		Build()
+	resp, err := initialization.GetLarkClient(ctx).Im.MessageResource.Get(ctx, req)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return nil, errors.New(resp.Msg)
+	}
+	return io.ReadAll(resp.File)
+}
+
+// uploadAudio 上传 Ogg Opus 语音, duration 为时长(毫秒), 返回 file_key
+func uploadAudio(ctx context.Context, data []byte, duration int) (string, error) {
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Im.File.Create(ctx,
+		larkim.NewCreateFileReqBuilder().
+			Body(larkim.NewCreateFileReqBodyBuilder().
+				FileType(larkim.FileTypeOpus).
+				FileName("voice.opus").
+				Duration(duration).
+				File(bytes.NewReader(data)).
+				Build()).
+			Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return "", errors.New(resp.Msg)
+	}
+	return *resp.Data.FileKey, nil
+}
+
+// uploadFile 上传普通文件, 返回 file_key
+func uploadFile(ctx context.Context, data []byte, fileName string) (string, error) {
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Im.File.Create(ctx,
+		larkim.NewCreateFileReqBuilder().
+			Body(larkim.NewCreateFileReqBodyBuilder().
+				FileType(larkim.FileTypeStream).
+				FileName(fileName).
+				File(bytes.NewReader(data)).
+				Build()).
+			Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return "", errors.New(resp.Msg)
+	}
+	return *resp.Data.FileKey, nil
+}
+
+func replyFile(ctx context.Context, fileKey string, msgId *string) error {
+	msgFile := larkim.MessageFile{FileKey: fileKey}
+	content, err := msgFile.String()
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
-	client := initialization.GetLarkClient()
+	client := initialization.GetLarkClient(ctx)
 
 	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
 		MessageId(*msgId).
 		Body(larkim.NewReplyMessageReqBodyBuilder().
-			MsgType(larkim.MsgTypeImage).
+			MsgType(larkim.MsgTypeFile).
 			Uuid(uuid.New().String()).
 			Content(content).
 			Build()).
@@ -532,52 +1000,118 @@ func replyImage(ctx context.Context, ImageKey *string,
 	return nil
 }
 
-func replayImageCardByBase64(ctx context.Context, base64Str string,
-	msgId *string, sessionId *string, question string) error {
-	imageKey, err := uploadImage(base64Str)
+func replyAudio(ctx context.Context, fileKey string, msgId *string) error {
+	msgAudio := larkim.MessageAudio{FileKey: fileKey}
+	content, err := msgAudio.String()
 	if err != nil {
+		fmt.Println(err)
 		return err
 	}
-	//example := "img_v2_041b28e3-5680-48c2-9af2-497ace79333g"
-	//imageKey := &example
-	//fmt.Println("imageKey", *imageKey)
-	err = sendImageCard(ctx, *imageKey, msgId, sessionId, question)
+	client := initialization.GetLarkClient(ctx)
+
+	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
+		MessageId(*msgId).
+		Body(larkim.NewReplyMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeAudio).
+			Uuid(uuid.New().String()).
+			Content(content).
+			Build()).
+		Build())
+
+	// 处理错误
 	if err != nil {
+		fmt.Println(err)
 		return err
 	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return errors.New(resp.Msg)
+	}
 	return nil
 }
 
-func replayImagePlainByBase64(ctx context.Context, base64Str string,
+func replyImage(ctx context.Context, ImageKey *string,
 	msgId *string) error {
-	imageKey, err := uploadImage(base64Str)
+	//fmt.Println("sendMsg", ImageKey, msgId)
+
+	msgImage := larkim.MessageImage{ImageKey: *ImageKey}
+	content, err := msgImage.String()
 	if err != nil {
+		fmt.Println(err)
 		return err
 	}
-	//example := "img_v2_041b28e3-5680-48c2-9af2-497ace79333g"
-	//imageKey := &example
-	//fmt.Println("imageKey", *imageKey)
-	err = replyImage(ctx, imageKey, msgId)
+	client := initialization.GetLarkClient(ctx)
+
+	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
+		MessageId(*msgId).
+		Body(larkim.NewReplyMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeImage).
+			Uuid(uuid.New().String()).
+			Content(content).
+			Build()).
+		Build())
+
+	// 处理错误
 	if err != nil {
+		fmt.Println(err)
 		return err
 	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return errors.New(resp.Msg)
+	}
 	return nil
 }
 
-func replayVariantImageByBase64(ctx context.Context, base64Str string,
-	msgId *string, sessionId *string) error {
-	imageKey, err := uploadImage(base64Str)
+// replayImagesCardByBase64 上传所有图片, 在一张卡片中展示, 返回上传后的 image_key;
+// optimized 为 true 时在卡片中展示扩写后的提示词 question
+func replayImagesCardByBase64(ctx context.Context, base64Strs []string,
+	msgId *string, sessionId *string, question string,
+	optimized bool) ([]string, error) {
+	var imageKeys []string
+	for _, base64Str := range base64Strs {
+		imageKey, err := uploadImage(ctx, base64Str)
+		if err != nil {
+			return nil, err
+		}
+		imageKeys = append(imageKeys, *imageKey)
+	}
+	return imageKeys, sendImagesCard(ctx, imageKeys, msgId, sessionId,
+		question, optimized)
+}
+
+func replayImagePlainByBase64(ctx context.Context, base64Str string,
+	msgId *string) (string, error) {
+	imageKey, err := uploadImage(ctx, base64Str)
 	if err != nil {
-		return err
+		return "", err
 	}
 	//example := "img_v2_041b28e3-5680-48c2-9af2-497ace79333g"
 	//imageKey := &example
 	//fmt.Println("imageKey", *imageKey)
-	err = sendVarImageCard(ctx, *imageKey, msgId, sessionId)
+	err = replyImage(ctx, imageKey, msgId)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return *imageKey, nil
+}
+
+// replayVariantImageByBase64 回复变体卡片, sourceKey 为生成变体的原图
+func replayVariantImageByBase64(ctx context.Context, base64Str string,
+	msgId *string, sessionId *string, sourceKey string) (string, error) {
+	imageKey, err := uploadImage(ctx, base64Str)
+	if err != nil {
+		return "", err
+	}
+	err = sendVarImageCard(ctx, *imageKey, sourceKey, msgId, sessionId)
+	if err != nil {
+		return "", err
+	}
+	return *imageKey, nil
 }
 
 func sendMsg(ctx context.Context, msg string, chatId *string) error {
@@ -586,7 +1120,7 @@ func sendMsg(ctx context.Context, msg string, chatId *string) error {
 	if i != nil {
 		return i
 	}
-	client := initialization.GetLarkClient()
+	client := initialization.GetLarkClient(ctx)
 	content := larkim.NewTextMsgBuilder().
 		Text(msg).
 		Build()
@@ -616,6 +1150,37 @@ func sendMsg(ctx context.Context, msg string, chatId *string) error {
 	return nil
 }
 
+func sendCard(ctx context.Context, cardContent string, chatId *string) error {
+	return sendCardTo(ctx, cardContent, larkim.ReceiveIdTypeChatId, *chatId)
+}
+
+// sendCardTo 按 receiveIdType 发送卡片, 例如用 open_id 私聊用户
+func sendCardTo(ctx context.Context, cardContent string,
+	receiveIdType string, receiveId string) error {
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Im.Message.Create(ctx, larkim.NewCreateMessageReqBuilder().
+		ReceiveIdType(receiveIdType).
+		Body(larkim.NewCreateMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeInteractive).
+			ReceiveId(receiveId).
+			Content(cardContent).
+			Build()).
+		Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return errors.New(resp.Msg)
+	}
+	return nil
+}
+
 func sendClearCacheCheckCard(ctx context.Context,
 	sessionId *string, msgId *string) {
 	newCard, _ := newSendCard(
@@ -636,21 +1201,36 @@ func sendSystemInstructionCard(ctx context.Context,
 }
 
 func sendPicCreateInstructionCard(ctx context.Context,
-	sessionId *string, msgId *string) {
-	newCard, _ := newSendCard(
-		withHeader("🖼️ Enter the picture creation mode", larkcard.TemplateBlue),
-		withPicResolutionBtn(sessionId),
-		withNote("remind：Reply text or picture，Let AI generate related pictures。"))
+	sessionId *string, msgId *string, options openai.ImageOptions,
+	optimize bool) {
+	newCard, _ := newPicSettingCard(sessionId, options, optimize, "")
 	replyCard(ctx, msgId, newCard)
 }
 
 func sendPicModeCheckCard(ctx context.Context,
-	sessionId *string, msgId *string) {
+	sessionId *string, msgId *string, imageKey string) {
 	newCard, _ := newSendCard(
 		withHeader("🖼️ Robot reminder", larkcard.TemplateBlue),
-		withMainMd("Receive the picture, do you enter the picture creation mode?"),
-		withNote("Please note that this will start a brand new conversation. You will be unable to use the historical information of the previous topic"),
-		withPicModeDoubleCheckBtn(sessionId))
+		withMainMd("Receive the picture, do you enter the picture creation mode, or ask questions about it?"),
+		withNote("Please note that switching mode will start a brand new conversation. You will be unable to use the historical information of the previous topic"),
+		withPicModeDoubleCheckBtn(sessionId, msgId, imageKey))
+	replyCard(ctx, msgId, newCard)
+}
+
+// sendPicEditCard 进入图片修改时的提示, 按钮用于回到文字生成图片
+func sendPicEditCard(ctx context.Context,
+	sessionId *string, msgId *string, tip string) {
+	newCard, _ := newSendCard(
+		withHeader("🖌️ Picture editing", larkcard.TemplateBlue),
+		withMainMd(tip),
+		withNote("Reply Stop editing or /stop_edit to generate new pictures from text again。"),
+		withOneBtn(newBtn("Stop editing", map[string]interface{}{
+			"value":     "0",
+			"kind":      PicEditExitKind,
+			"chatType":  UserChatType,
+			"sessionId": *sessionId,
+			"msgId":     *msgId,
+		}, larkcard.MessageCardButtonTypeDefault)))
 	replyCard(ctx, msgId, newCard)
 }
 
@@ -663,6 +1243,276 @@ func sendNewTopicCard(ctx context.Context,
 	replyCard(ctx, msgId, newCard)
 }
 
+func sendDocumentLoadedCard(ctx context.Context,
+	sessionId *string, msgId *string, doc *document.Document) {
+	newCard, _ := newSendCard(
+		withHeader("📄 Document loaded", larkcard.TemplateBlue),
+		withMainMd(fmt.Sprintf("**%s**\nParsed %d text chunks, about %d characters",
+			doc.Name, len(doc.Chunks), doc.Length())),
+		withNote("Reminder: Reply to this message to ask questions about the document, answers will cite the page or section"))
+	replyCard(ctx, msgId, newCard)
+}
+
+func SendKnowledgeBaseCard(ctx context.Context,
+	sessionId *string, msgId *string, chatId *string,
+	current string, names []string) {
+	if current == "" {
+		current = "none"
+	}
+	newCard, _ := newSendCard(
+		withHeader("📚 Knowledge base", larkcard.TemplateIndigo),
+		withMainMd(fmt.Sprintf("Current knowledge base: **%s**", current)),
+		withKnowledgeBaseBtn(sessionId, chatId, names),
+		withNote("Reminder: Answers in this chat will refer to the selected knowledge base and cite their sources"))
+	replyCard(ctx, msgId, newCard)
+}
+
+func sendDocPermissionCard(ctx context.Context,
+	sessionId *string, msgId *string, url string, botName string) {
+	newCard, _ := newSendCard(
+		withHeader("🔒 No permission to read the document", larkcard.TemplateRed),
+		withMainMd(fmt.Sprintf("I can't read [this document](%s) yet.", url)),
+		withMainMd(fmt.Sprintf("Please open the document, click **Share** and add **%s** "+
+			"as a reader, then send your question again.", botName)),
+		withNote("Reminder: Wiki pages need the bot to be added to the knowledge space or the page"))
+	replyCard(ctx, msgId, newCard)
+}
+
+// withSummaryElements 总结、决定、待办和待解决问题
+func withSummaryElements(summary *ChatSummary) []larkcard.MessageCardElement {
+	elements := []larkcard.MessageCardElement{
+		withMainMd(summary.Summary),
+	}
+	if len(summary.Decisions) > 0 {
+		elements = append(elements, withSplitLine(),
+			withMainMd("✅ **Decisions**\n- "+strings.Join(summary.Decisions, "\n- ")))
+	}
+	if len(summary.ActionItems) > 0 {
+		var items []string
+		for _, item := range summary.ActionItems {
+			owner := item.Owner
+			if owner == "" {
+				owner = "unassigned"
+			}
+			items = append(items, fmt.Sprintf("- **%s**: %s", owner, item.Task))
+		}
+		elements = append(elements, withSplitLine(),
+			withMainMd("📌 **Action items**\n"+strings.Join(items, "\n")))
+	}
+	if len(summary.OpenQuestions) > 0 {
+		elements = append(elements, withSplitLine(),
+			withMainMd("❓ **Open questions**\n- "+strings.Join(summary.OpenQuestions, "\n- ")))
+	}
+	return elements
+}
+
+func newSummaryCard(summary *ChatSummary, count int,
+	since time.Time) (string, error) {
+	elements := append(withSummaryElements(summary), withNote(fmt.Sprintf(
+		"Summarized %d messages since %s", count, since.Format("2006-01-02 15:04"))))
+	return newSendCard(
+		withHeader("📋 Chat summary", larkcard.TemplateTurquoise),
+		elements...)
+}
+
+func sendSummaryCard(ctx context.Context, msgId *string,
+	summary *ChatSummary, count int, since time.Time) {
+	newCard, _ := newSummaryCard(summary, count, since)
+	replyCard(ctx, msgId, newCard)
+}
+
+func sendSummaryCardToChat(ctx context.Context, chatId *string,
+	summary *ChatSummary, count int, since time.Time) {
+	newCard, _ := newSummaryCard(summary, count, since)
+	sendCard(ctx, newCard, chatId)
+}
+
+func sendMinutesCard(ctx context.Context, msgId *string,
+	summary *ChatSummary, fileName string, transcription *openai.Transcription) {
+	note := fmt.Sprintf("%s · %s", fileName, formatTimestamp(transcription.Duration))
+	if transcription.Language != "" {
+		note += " · " + transcription.Language
+	}
+	elements := append(withSummaryElements(summary),
+		withNote(note+" · the full transcript is attached below"))
+	newCard, _ := newSendCard(
+		withHeader("📝 Meeting notes", larkcard.TemplateTurquoise),
+		elements...)
+	replyCard(ctx, msgId, newCard)
+}
+
+func sendScheduleListCard(ctx context.Context, sessionId *string,
+	msgId *string, s *scheduler.Scheduler, chatId string) {
+	jobs := s.List(chatId)
+	elements := []larkcard.MessageCardElement{}
+	if len(jobs) == 0 {
+		elements = append(elements, withMainMd("There are no schedules in this chat"))
+	}
+	for _, job := range jobs {
+		content := fmt.Sprintf("**%s** `%s`\nID: %s, next run: %s",
+			job.Name, job.Spec, job.Id,
+			s.Next(job.Id).Format("2006-01-02 15:04"))
+		if job.FromConfig {
+			elements = append(elements, withMainMd(content+"\n(defined in config)"))
+			continue
+		}
+		elements = append(elements, withMdAndExtraBtn(content,
+			newBtn("Cancel", map[string]interface{}{
+				"value":     job.Id,
+				"kind":      ScheduleCancelKind,
+				"chatType":  GroupChatType,
+				"sessionId": *sessionId,
+				"msgId":     *msgId,
+				"chatId":    chatId,
+			}, larkcard.MessageCardButtonTypeDanger)))
+	}
+	elements = append(elements, withNote("Reminder: Send /schedule add <cron> | <prompt> to add a schedule"))
+	newCard, _ := newSendCard(
+		withHeader("⏰ Schedules", larkcard.TemplateIndigo),
+		elements...)
+	replyCard(ctx, msgId, newCard)
+}
+
+func reminderValue(kind CardKind, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"value":    value,
+		"kind":     kind,
+		"chatType": UserChatType,
+	}
+}
+
+func withReminderTimePicker(r *reminder.Reminder,
+	loc *time.Location) larkcard.MessageCardElement {
+	picker := larkcard.NewMessageCardEmbedPickerDatetime().
+		MessageCardEmbedPickerDatetime(larkcard.NewMessageCardEmbedDatePickerBase().
+			InitialDatetime(r.DueAt.In(loc).Format(reminderTimeLayout)).
+			Placeholder(larkcard.NewMessageCardPlainText().
+				Content("Change time").
+				Build()).
+			Value(reminderValue(ReminderKind, "time:"+r.Id)).
+			Build()).
+		Build()
+	actions := larkcard.NewMessageCardAction().
+		Actions([]larkcard.MessageCardActionElement{
+			picker,
+			newBtn("Confirm", reminderValue(ReminderKind, "confirm:"+r.Id),
+				larkcard.MessageCardButtonTypePrimary),
+			newBtn("Cancel", reminderValue(ReminderKind, "cancel:"+r.Id),
+				larkcard.MessageCardButtonTypeDanger),
+		}).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+	return actions
+}
+
+func withReminderSnoozeBtn(r reminder.Reminder) larkcard.MessageCardElement {
+	actions := larkcard.NewMessageCardAction().
+		Actions([]larkcard.MessageCardActionElement{
+			newBtn("In 10 minutes", reminderValue(ReminderSnoozeKind, "10m:"+r.Id),
+				larkcard.MessageCardButtonTypeDefault),
+			newBtn("In 1 hour", reminderValue(ReminderSnoozeKind, "1h:"+r.Id),
+				larkcard.MessageCardButtonTypeDefault),
+			newBtn("Tomorrow", reminderValue(ReminderSnoozeKind, "24h:"+r.Id),
+				larkcard.MessageCardButtonTypeDefault),
+			newBtn("Done", reminderValue(ReminderKind, "done:"+r.Id),
+				larkcard.MessageCardButtonTypePrimary),
+		}).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+	return actions
+}
+
+// newReminderStatusCard 根据提醒状态生成确认卡片
+func newReminderStatusCard(r *reminder.Reminder, loc *time.Location) (string, error) {
+	content := fmt.Sprintf("**%s**\n⏰ %s", r.Content,
+		r.DueAt.In(loc).Format(reminderTimeLayout))
+	switch r.Status {
+	case reminder.StatusActive:
+		return newSendCard(
+			withHeader("✅ Reminder set", larkcard.TemplateGreen),
+			withMainMd(content),
+			withOneBtn(newBtn("Cancel", reminderValue(ReminderKind, "cancel:"+r.Id),
+				larkcard.MessageCardButtonTypeDanger)),
+			withNote("I will send you a private message at that time"))
+	case reminder.StatusCancel:
+		return newSendCard(
+			withHeader("🚫 Reminder cancelled", larkcard.TemplateGrey),
+			withMainMd(content))
+	case reminder.StatusDone:
+		return newSendCard(
+			withHeader("👌 Reminder done", larkcard.TemplateGrey),
+			withMainMd(content))
+	default:
+		return newSendCard(
+			withHeader("⏰ Confirm the reminder", larkcard.TemplateIndigo),
+			withMainMd(content),
+			withReminderTimePicker(r, loc),
+			withNote(fmt.Sprintf("Times are in %s, send /timezone to change it", loc)))
+	}
+}
+
+func sendReminderConfirmCard(ctx context.Context, msgId *string,
+	r *reminder.Reminder, loc *time.Location) {
+	newCard, _ := newReminderStatusCard(r, loc)
+	replyCard(ctx, msgId, newCard)
+}
+
+// sendReminderCard 到期时私聊发送提醒
+func sendReminderCard(ctx context.Context, r reminder.Reminder, loc *time.Location) {
+	newCard, _ := newSendCard(
+		withHeader("⏰ Reminder", larkcard.TemplateOrange),
+		withMainMd(fmt.Sprintf("**%s**\n%s", r.Content,
+			r.DueAt.In(loc).Format(reminderTimeLayout))),
+		withReminderSnoozeBtn(r))
+	if err := sendCardTo(ctx, newCard,
+		larkim.ReceiveIdTypeOpenId, r.UserId); err != nil {
+		fmt.Printf("failed to send reminder %s: %v\n", r.Id, err)
+	}
+}
+
+func sendReminderListCard(ctx context.Context, msgId *string,
+	reminders []reminder.Reminder, loc *time.Location) {
+	elements := []larkcard.MessageCardElement{}
+	if len(reminders) == 0 {
+		elements = append(elements, withMainMd("You have no reminders"))
+	}
+	for _, r := range reminders {
+		elements = append(elements, withMdAndExtraBtn(
+			fmt.Sprintf("**%s**\n⏰ %s", r.Content,
+				r.DueAt.In(loc).Format(reminderTimeLayout)),
+			newBtn("Cancel", reminderValue(ReminderKind, "cancel:"+r.Id),
+				larkcard.MessageCardButtonTypeDanger)))
+	}
+	elements = append(elements, withNote(fmt.Sprintf(
+		"Times are in %s. Send /remind <when> <what> to add a reminder", loc)))
+	newCard, _ := newSendCard(
+		withHeader("⏰ Reminders", larkcard.TemplateIndigo),
+		elements...)
+	replyCard(ctx, msgId, newCard)
+}
+
+// sendToolRecordsCard 展示本次回答调用过的工具
+func sendToolRecordsCard(ctx context.Context, msgId *string,
+	records []tools.Record) {
+	var lines []string
+	for _, record := range records {
+		status := "✅"
+		if record.Failed {
+			status = "⚠️"
+		}
+		result := []rune(record.Result)
+		if len(result) > 200 {
+			result = append(result[:200], []rune("...")...)
+		}
+		lines = append(lines, fmt.Sprintf("%s **%s** `%s`\n%s", status,
+			record.Name, record.Arguments, string(result)))
+	}
+	newCard, _ := newSendCard(
+		withHeader("🧰 Tools used", larkcard.TemplateGrey),
+		withMainMd(strings.Join(lines, "\n")))
+	replyCard(ctx, msgId, newCard)
+}
+
 func sendHelpCard(ctx context.Context,
 	sessionId *string, msgId *string) {
 	newCard, _ := newSendCard(
@@ -684,12 +1534,38 @@ func sendHelpCard(ctx context.Context,
 		withSplitLine(),
 		withMainMd("🥷 **Role -playing mode**\nText reply* role -playing* or */system*+Space+character information"),
 		withSplitLine(),
-		withMainMd("🎤 **AI voice dialogue**\nSend voice directly in the private chat mode"),
+		withMainMd("🎤 **AI voice dialogue**\nSend voice in the private chat, in a topic the robot joined, or reply to a voice message and mention the robot"),
+		withSplitLine(),
+		withMainMd("⚙️ **Chat settings**\nText reply *Settings* or */settings* to set the default role, model, temperature, language and history of this chat"),
+		withSplitLine(),
+		withMainMd("🔊 **Voice settings**\nText reply *Voice reply* or */voice* to set the transcription language, transcribe only or hear the answers"),
+		withSplitLine(),
+		withMainMd("📝 **Meeting notes**\nReply to an audio or video file with *Meeting notes* or */minutes* to get a summary, action items and a timestamped transcript"),
+		withSplitLine(),
+		withMainMd("👀 **Image Q&A**\nSend a picture and choose *Ask about this image*, or send a rich text message with pictures"),
+		withSplitLine(),
+		withMainMd("📄 **Document Q&A**\nSend a pdf/docx/txt/md file, then reply to it with your questions"),
+		withSplitLine(),
+		withMainMd("🔔 **Reminders**\nSay e.g. *remind me tomorrow at 3pm to send the report*, or */remind list*"),
+		withSplitLine(),
+		withMainMd("⏰ **Schedules**\nText reply */schedule* to list, add or cancel recurring prompts"),
+		withSplitLine(),
+		withMainMd("📋 **Chat summary**\nIn groups, text reply */summary* [N | since 2h | since 09:00]"),
+		withSplitLine(),
+		withMainMd("📝 **Feishu documents**\nSend a docx or wiki link with your question, e.g. summarize this doc"),
+		withSplitLine(),
+		withMainMd("📚 **Knowledge base**\nText reply *knowledge base* or */kb*"),
 		withSplitLine(),
 		withMainMd("🎨 **Photo creation mode**\nReply* Picture creation* or */picture*"),
 		withSplitLine(),
+		withMainMd("🗂 **Picture history**\nReply* Picture history* or */images* to reuse pictures of this topic"),
+		withSplitLine(),
+		withMainMd("🖌️ **Stop editing pictures**\nReply* Stop editing* or */stop_edit* to generate new pictures from text again"),
+		withSplitLine(),
 		withMainMd("🎰 **Token balance query**\nReply* balance* or */balance*"),
 		withSplitLine(),
+		withMainMd("🔄 **Reload config**\nAdministrators reply */reload-config* after editing the config or role list"),
+		withSplitLine(),
 		withMainMd("🔃️ **Historical topics** 🚧\n"+" Reply to the topic of the topic, text reply * recovery * or */reload*"),
 		withSplitLine(),
 		withMainMd("📤 **Topic content export** 🚧\n"+" Text reply * Export * or */export*"),
@@ -701,40 +1577,96 @@ func sendHelpCard(ctx context.Context,
 	replyCard(ctx, msgId, newCard)
 }
 
-func sendImageCard(ctx context.Context, imageKey string,
-	msgId *string, sessionId *string, question string) error {
-	newCard, _ := newSimpleSendCard(
-		withImageDiv(imageKey),
+func sendImagesCard(ctx context.Context, imageKeys []string,
+	msgId *string, sessionId *string, question string, optimized bool) error {
+	elements := []larkcard.MessageCardElement{withImageGrid(imageKeys)}
+	if optimized {
+		elements = append(elements, withNote("✨ Prompt: "+question))
+	}
+	elements = append(elements,
 		withSplitLine(),
-		//再来一张
+		//再来一张, 直接使用扩写后的提示词
 		withOneBtn(newBtn("One more piece", map[string]interface{}{
 			"value":     question,
 			"kind":      PicTextMoreKind,
 			"chatType":  UserChatType,
 			"msgId":     *msgId,
 			"sessionId": *sessionId,
+			"optimized": optimized,
 		}, larkcard.MessageCardButtonTypePrimary)),
 	)
+	newCard, _ := newSimpleSendCard(elements...)
 	replyCard(ctx, msgId, newCard)
 	return nil
 }
 
-func sendVarImageCard(ctx context.Context, imageKey string,
+// sendVarImageCard 展示变体, "再来一张" 使用原图 sourceKey 重新生成
+func sendVarImageCard(ctx context.Context, imageKey string, sourceKey string,
 	msgId *string, sessionId *string) error {
 	newCard, _ := newSimpleSendCard(
 		withImageDiv(imageKey),
 		withSplitLine(),
-		//再来一张
-		withOneBtn(newBtn("One more piece", map[string]interface{}{
-			"value":     imageKey,
-			"kind":      PicVarMoreKind,
+		withPicHistoryBtn(sessionId, msgId, imageKey, sourceKey),
+	)
+	replyCard(ctx, msgId, newCard)
+	return nil
+}
+
+// withPicHistoryBtn 图片下方的按钮, sourceKey 不为空时 "再来一张" 使用原图生成变体
+func withPicHistoryBtn(sessionId *string, msgId *string,
+	imageKey string, sourceKey string) larkcard.MessageCardElement {
+	value := func(kind CardKind, v string) map[string]interface{} {
+		return map[string]interface{}{
+			"value":     v,
+			"kind":      kind,
 			"chatType":  UserChatType,
 			"msgId":     *msgId,
 			"sessionId": *sessionId,
-		}, larkcard.MessageCardButtonTypePrimary)),
+		}
+	}
+	var btns []larkcard.MessageCardActionElement
+	if sourceKey != "" {
+		//再来一张
+		btns = append(btns, newBtn("Another variation",
+			value(PicVarMoreKind, sourceKey),
+			larkcard.MessageCardButtonTypePrimary))
+	}
+	btns = append(btns,
+		newBtn("Vary this picture", value(PicHistoryKind, "vary:"+imageKey),
+			larkcard.MessageCardButtonTypeDefault),
+		newBtn("Edit this picture", value(PicHistoryKind, "edit:"+imageKey),
+			larkcard.MessageCardButtonTypeDefault),
 	)
+	return larkcard.NewMessageCardAction().
+		Actions(btns).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
+// sendPicHistoryCard 列出会话中的图片, 最新的在前
+func sendPicHistoryCard(ctx context.Context, sessionId *string,
+	msgId *string, history []services.PicHistoryItem, loc *time.Location) {
+	elements := []larkcard.MessageCardElement{}
+	for i := len(history) - 1; i >= 0; i-- {
+		item := history[i]
+		desc := "Received picture"
+		if item.MsgId == "" {
+			desc = "Generated picture"
+		}
+		if item.Prompt != "" {
+			desc += ": " + item.Prompt
+		}
+		elements = append(elements,
+			withMainMd(fmt.Sprintf("**%s** %s", item.CreatedAt.In(loc).Format("01-02 15:04"), desc)),
+			withImageDiv(item.ImageKey),
+			withPicHistoryBtn(sessionId, msgId, item.ImageKey, ""),
+			withSplitLine())
+	}
+	elements = append(elements, withNote("Choose a picture to generate variations or edit it with text instructions"))
+	newCard, _ := newSendCard(
+		withHeader("🖼️ Picture history", larkcard.TemplateBlue),
+		elements...)
 	replyCard(ctx, msgId, newCard)
-	return nil
 }
 
 func sendBalanceCard(ctx context.Context, msgId *string,
@@ -753,23 +1685,67 @@ func sendBalanceCard(ctx context.Context, msgId *string,
 }
 
 func SendRoleTagsCard(ctx context.Context,
-	sessionId *string, msgId *string, roleTags []string) {
+	sessionId *string, msgId *string, chatId string, roleTags []string) {
 	newCard, _ := newSendCard(
 		withHeader("🛖 Please select the character category", larkcard.TemplateIndigo),
-		withRoleTagsBtn(sessionId, roleTags...),
+		withRoleTagsBtn(sessionId, chatId, roleTags...),
 		withNote("Reminder: Select the classification of the character so that we recommend more related characters for you。"))
 	replyCard(ctx, msgId, newCard)
 }
 
 func SendRoleListCard(ctx context.Context,
-	sessionId *string, msgId *string, roleTag string, roleList []string) {
+	sessionId *string, msgId *string, chatId string, roleTag string,
+	roleList []string) {
 	newCard, _ := newSendCard(
 		withHeader("🛖 Corner list"+" - "+roleTag, larkcard.TemplateIndigo),
-		withRoleBtn(sessionId, roleList...),
+		withRoleBtn(sessionId, chatId, roleList...),
 		withNote("Reminder: Choose the built -in scene and quickly enter the role -playing mode。"))
 	replyCard(ctx, msgId, newCard)
 }
 
+// roleDetail 角色详情卡片的内容, 没有简介时展示提示词
+func roleDetail(role initialization.Role) string {
+	var b strings.Builder
+	if role.Description != "" {
+		b.WriteString(role.Description)
+	} else {
+		b.WriteString(role.Content)
+	}
+	if role.Author != "" {
+		b.WriteString("\n\n**Author:** " + role.Author)
+	}
+	if role.Example != "" {
+		b.WriteString("\n**Example:** " + role.Example)
+	}
+	if len(role.Examples) > 0 {
+		b.WriteString(fmt.Sprintf("\n**Sample dialogues:** %d", len(role.Examples)))
+	}
+	if role.Model != "" {
+		b.WriteString("\n**Model:** " + role.Model)
+	}
+	if role.Temperature != nil {
+		b.WriteString(fmt.Sprintf("\n**Temperature:** %v", *role.Temperature))
+	}
+	return b.String()
+}
+
+// sendRoleDetailCard 角色详情, 点击按钮后使用该角色开始新话题
+func sendRoleDetailCard(ctx context.Context,
+	sessionId *string, msgId *string, chatId string, role initialization.Role) {
+	newCard, _ := newSendCard(
+		withHeader("🥷  "+role.Title, larkcard.TemplateIndigo),
+		withMainMd(roleDetail(role)),
+		withOneBtn(newBtn("Use this role", map[string]interface{}{
+			"value":     role.Title,
+			"kind":      RoleConfirmKind,
+			"sessionId": *sessionId,
+			"msgId":     *msgId,
+			"chatId":    chatId,
+		}, larkcard.MessageCardButtonTypePrimary)),
+		withNote("Using the role will start a brand new conversation。"))
+	replyCard(ctx, msgId, newCard)
+}
+
 func SendAIModeListsCard(ctx context.Context,
 	sessionId *string, msgId *string, aiModeStrs []string) {
 	newCard, _ := newSendCard(
@@ -1,8 +1,11 @@
 package initialization
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -26,13 +29,83 @@ type Config struct {
 	AzureOn                    bool
 	AzureApiVersion            string
 	AzureDeploymentName        string
+	AzureEmbeddingDeployment   string
 	AzureResourceName          string
 	AzureOpenaiToken           string
+	KnowledgeBaseDir           string
+	KnowledgeBaseTopK          int
+	DataDir                    string
+	AdminUsers                 []string
+	DefaultTimezone            string
+	VisionModel                string
+	PictureFit                 string
+	PicturePromptOptimize      bool
+	PicturePromptTranslate     bool
+	TranscribeLanguage         string
+	TranscribeOnly             bool
+	VoiceReply                 bool
+	TTSModel                   string
+	TTSVoice                   string
+	TTSSpeed                   float64
+	ToolsEnabled               bool
+	ToolMaxIterations          int
+	AdminTools                 []string
+	Schedules                  []ScheduleConfig
+	RoleFile                   string
+	// ChatModels 会话设置中可选的对话模型, 为空时使用内置列表
+	ChatModels []string
+	// GroupModes 群聊中除@机器人外的触发方式: thread 机器人参与的话题中无需@, keyword 包含关键词
+	GroupModes    []string
+	GroupKeywords []string
+	// AppName 所属飞书应用的名称, 顶层配置的应用为空
+	AppName string
+	Apps    []AppConfig
+	// problems 读取配置时发现的问题, 由 Validate 统一报告
+	problems []string
+}
+
+// ScheduleConfig 配置文件中定义的定时任务
+type ScheduleConfig struct {
+	Name   string `mapstructure:"name"`
+	Spec   string `mapstructure:"spec"`
+	ChatId string `mapstructure:"chat_id"`
+	Kind   string `mapstructure:"kind"`
+	Prompt string `mapstructure:"prompt"`
+}
+
+// loadProblems 收集 LoadConfig 过程中各个取值函数发现的问题
+var loadProblems []string
+
+// AppConfig 同一进程中托管的其他飞书应用. 应用凭证需要单独填写,
+// 其他未填写的项沿用顶层配置
+type AppConfig struct {
+	Name              string `mapstructure:"name"`
+	AppId             string `mapstructure:"app_id"`
+	AppSecret         string `mapstructure:"app_secret"`
+	EncryptKey        string `mapstructure:"app_encrypt_key"`
+	VerificationToken string `mapstructure:"app_verification_token"`
+	BotName           string `mapstructure:"bot_name"`
+	OpenaiKey         string `mapstructure:"openai_key"`
+	RoleFile          string `mapstructure:"role_file"`
+	// DataDir 为空时使用顶层 DATA_DIR 下以应用名称命名的目录
+	DataDir    string `mapstructure:"data_dir"`
+	AdminUsers string `mapstructure:"admin_users"`
 }
 
 func LoadConfig(cfg string) *Config {
+	loadProblems = nil
+	// 重新加载时不保留上一次读到的配置
+	viper.Reset()
 	viper.SetConfigFile(cfg)
-	viper.ReadInConfig()
+	if err := viper.ReadInConfig(); err != nil {
+		// 没有配置文件时可以只用环境变量配置
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("Config file %s not found, using environment variables\n", cfg)
+		} else {
+			loadProblems = append(loadProblems,
+				fmt.Sprintf("reading config file %s: %v", cfg, err))
+		}
+	}
 	viper.AutomaticEnv()
 	//content, err := ioutil.ReadFile("config.yaml")
 	//if err != nil {
@@ -57,13 +130,92 @@ func LoadConfig(cfg string) *Config {
 		AzureOn:                    getViperBoolValue("AZURE_ON", false),
 		AzureApiVersion:            getViperStringValue("AZURE_API_VERSION", "2023-03-15-preview"),
 		AzureDeploymentName:        getViperStringValue("AZURE_DEPLOYMENT_NAME", ""),
+		AzureEmbeddingDeployment:   getViperStringValue("AZURE_EMBEDDING_DEPLOYMENT_NAME", ""),
 		AzureResourceName:          getViperStringValue("AZURE_RESOURCE_NAME", ""),
 		AzureOpenaiToken:           getViperStringValue("AZURE_OPENAI_TOKEN", ""),
+		KnowledgeBaseDir:           getViperStringValue("KNOWLEDGE_BASE_DIR", "./knowledge"),
+		KnowledgeBaseTopK:          getViperIntValue("KNOWLEDGE_BASE_TOP_K", 4),
+		DataDir:                    getViperStringValue("DATA_DIR", "./data"),
+		AdminUsers:                 getViperStringList("ADMIN_USERS"),
+		DefaultTimezone:            getViperStringValue("DEFAULT_TIMEZONE", "Asia/Shanghai"),
+		VisionModel:                getViperStringValue("VISION_MODEL", "gpt-4o"),
+		PictureFit:                 getViperStringValue("PICTURE_FIT", "crop"),
+		PicturePromptOptimize:      getViperBoolValue("PICTURE_PROMPT_OPTIMIZE", false),
+		PicturePromptTranslate:     getViperBoolValue("PICTURE_PROMPT_TRANSLATE", true),
+		TranscribeLanguage:         getViperStringValue("TRANSCRIBE_LANGUAGE", "auto"),
+		TranscribeOnly:             getViperBoolValue("TRANSCRIBE_ONLY", false),
+		VoiceReply:                 getViperBoolValue("VOICE_REPLY", false),
+		TTSModel:                   getViperStringValue("TTS_MODEL", "tts-1"),
+		TTSVoice:                   getViperStringValue("TTS_VOICE", "alloy"),
+		TTSSpeed:                   getViperFloatValue("TTS_SPEED", 1.0),
+		ToolsEnabled:               getViperBoolValue("TOOLS_ENABLED", false),
+		ToolMaxIterations:          getViperIntValue("TOOL_MAX_ITERATIONS", 5),
+		AdminTools:                 getViperStringList("ADMIN_TOOLS"),
+		Schedules:                  getViperSchedules("SCHEDULES"),
+		RoleFile:                   getViperStringValue("ROLE_FILE", "role_list.yaml"),
+		ChatModels:                 getViperStringList("CHAT_MODELS"),
+		GroupModes:                 getViperStringList("GROUP_MODE"),
+		GroupKeywords:              getViperStringList("GROUP_KEYWORDS"),
+		Apps:                       getViperApps("APPS"),
 	}
+	config.problems = loadProblems
 
 	return config
 }
 
+// AppConfigs 每个飞书应用各自生效的配置. 顶层配置了 APP_ID 时也作为一个应用, 名称为空
+func (config Config) AppConfigs() []Config {
+	var configs []Config
+	if config.FeishuAppId != "" || len(config.Apps) == 0 {
+		base := config
+		base.Apps = nil
+		configs = append(configs, base)
+	}
+	for _, app := range config.Apps {
+		configs = append(configs, config.forApp(app))
+	}
+	return configs
+}
+
+// App 名称为 name 的应用生效的配置
+func (config Config) App(name string) (Config, bool) {
+	for _, app := range config.AppConfigs() {
+		if app.AppName == name {
+			return app, true
+		}
+	}
+	return Config{}, false
+}
+
+func (config Config) forApp(app AppConfig) Config {
+	c := config
+	c.Apps = nil
+	c.AppName = app.Name
+	c.FeishuAppId = app.AppId
+	c.FeishuAppSecret = app.AppSecret
+	c.FeishuAppEncryptKey = app.EncryptKey
+	c.FeishuAppVerificationToken = app.VerificationToken
+	// 顶层的定时任务属于顶层应用
+	c.Schedules = nil
+	c.DataDir = filepath.Join(config.DataDir, app.Name)
+	if app.DataDir != "" {
+		c.DataDir = app.DataDir
+	}
+	if app.BotName != "" {
+		c.FeishuBotName = app.BotName
+	}
+	if app.OpenaiKey != "" {
+		c.OpenaiApiKeys, _ = filterFormatKey(strings.Split(app.OpenaiKey, ","))
+	}
+	if app.RoleFile != "" {
+		c.RoleFile = app.RoleFile
+	}
+	if app.AdminUsers != "" {
+		c.AdminUsers = splitList(app.AdminUsers)
+	}
+	return c
+}
+
 func getViperStringValue(key string, defaultValue string) string {
 	value := viper.GetString(key)
 	if value == "" {
@@ -80,7 +232,48 @@ func getViperStringArray(key string, defaultValue []string) []string {
 		return defaultValue
 	}
 	raw := strings.Split(value, ",")
-	return filterFormatKey(raw)
+	keys, invalid := filterFormatKey(raw)
+	for _, invalidKey := range invalid {
+		loadProblems = append(loadProblems, fmt.Sprintf(
+			"%s: key %s does not start with sk- or fk", key, maskSecret(invalidKey)))
+	}
+	return keys
+}
+
+// ADMIN_USERS: ou_xxx,ou_xxx
+// result:[ou_xxx ou_xxx]
+func getViperStringList(key string) []string {
+	return splitList(viper.GetString(key))
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func getViperSchedules(key string) []ScheduleConfig {
+	var schedules []ScheduleConfig
+	if err := viper.UnmarshalKey(key, &schedules); err != nil {
+		loadProblems = append(loadProblems,
+			fmt.Sprintf("%s: invalid value: %v", key, err))
+		return nil
+	}
+	return schedules
+}
+
+func getViperApps(key string) []AppConfig {
+	var apps []AppConfig
+	if err := viper.UnmarshalKey(key, &apps); err != nil {
+		loadProblems = append(loadProblems,
+			fmt.Sprintf("%s: invalid value: %v", key, err))
+		return nil
+	}
+	return apps
 }
 
 func getViperIntValue(key string, defaultValue int) int {
@@ -90,12 +283,27 @@ func getViperIntValue(key string, defaultValue int) int {
 	}
 	intValue, err := strconv.Atoi(value)
 	if err != nil {
-		fmt.Printf("Invalid value for %s, using default value %d\n", key, defaultValue)
+		loadProblems = append(loadProblems,
+			fmt.Sprintf("%s: %q is not an integer", key, value))
 		return defaultValue
 	}
 	return intValue
 }
 
+func getViperFloatValue(key string, defaultValue float64) float64 {
+	value := viper.GetString(key)
+	if value == "" {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		loadProblems = append(loadProblems,
+			fmt.Sprintf("%s: %q is not a number", key, value))
+		return defaultValue
+	}
+	return floatValue
+}
+
 func getViperBoolValue(key string, defaultValue bool) bool {
 	value := viper.GetString(key)
 	if value == "" {
@@ -103,7 +311,8 @@ func getViperBoolValue(key string, defaultValue bool) bool {
 	}
 	boolValue, err := strconv.ParseBool(value)
 	if err != nil {
-		fmt.Printf("Invalid value for %s, using default value %v\n", key, defaultValue)
+		loadProblems = append(loadProblems,
+			fmt.Sprintf("%s: %q is not true or false", key, value))
 		return defaultValue
 	}
 	return boolValue
@@ -131,15 +340,20 @@ func (config *Config) GetKeyFile() string {
 	return config.KeyFile
 }
 
-// 过滤出 "sk-" 开头的 key
-func filterFormatKey(keys []string) []string {
-	var result []string
+// 过滤出 "sk-" 或 "fk" 开头的 key, 同时返回格式不对的 key
+func filterFormatKey(keys []string) ([]string, []string) {
+	var result, invalid []string
 	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
 		if strings.HasPrefix(key, "sk-") || strings.HasPrefix(key,
 			"fk") {
 			result = append(result, key)
+		} else {
+			invalid = append(invalid, key)
 		}
 	}
-	return result
-
+	return result, invalid
 }
@@ -0,0 +1,267 @@
+package initialization
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ConfigError 汇总配置中的全部问题, 一次提示便于一起修正
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// GroupModes 可选的群聊触发方式
+var GroupModes = []string{"mention", "thread", "keyword"}
+
+// scheduleParser 与 services/scheduler 相同的 cron 表达式格式
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom |
+	cron.Month | cron.Dow | cron.Descriptor)
+
+// appNamePattern 应用名称用于回调地址 /webhook/event/:app
+var appNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Validate 校验启动所需的配置, 有问题时返回 *ConfigError
+func (config *Config) Validate() error {
+	problems := append([]string{}, config.problems...)
+	names := make(map[string]bool)
+	for i, app := range config.Apps {
+		switch {
+		case app.Name == "":
+			problems = append(problems, fmt.Sprintf("APPS[%d]: name is required", i))
+		case !appNamePattern.MatchString(app.Name):
+			problems = append(problems, fmt.Sprintf(
+				"APPS[%s]: name may only contain letters, digits, - and _", app.Name))
+		case names[app.Name]:
+			problems = append(problems, fmt.Sprintf("APPS[%s]: duplicate name", app.Name))
+		}
+		names[app.Name] = true
+		if app.OpenaiKey != "" {
+			_, invalid := filterFormatKey(strings.Split(app.OpenaiKey, ","))
+			for _, key := range invalid {
+				problems = append(problems, fmt.Sprintf(
+					"APPS[%s].openai_key: key %s does not start with sk- or fk",
+					app.Name, maskSecret(key)))
+			}
+		}
+	}
+
+	appIds := make(map[string]bool)
+	for _, app := range config.AppConfigs() {
+		// 顶层应用使用大写的配置名, 其他应用使用 APPS 中的字段名
+		key := func(top string, field string) string {
+			if app.AppName == "" {
+				return top
+			}
+			return fmt.Sprintf("APPS[%s].%s", app.AppName, field)
+		}
+		if strings.TrimSpace(app.FeishuAppId) == "" {
+			problems = append(problems, key("APP_ID", "app_id")+" is required")
+		} else if appIds[app.FeishuAppId] {
+			problems = append(problems, key("APP_ID", "app_id")+
+				" is used by another app")
+		}
+		appIds[app.FeishuAppId] = true
+		if strings.TrimSpace(app.FeishuAppSecret) == "" {
+			problems = append(problems, key("APP_SECRET", "app_secret")+" is required")
+		}
+		if !config.AzureOn && len(app.OpenaiApiKeys) == 0 {
+			problems = append(problems, key("OPENAI_KEY", "openai_key")+
+				" has no usable key, separate multiple keys with commas")
+		}
+	}
+
+	if config.AzureOn {
+		reason := " when AZURE_ON is true"
+		require := func(key string, value string) {
+			if strings.TrimSpace(value) == "" {
+				problems = append(problems, key+" is required"+reason)
+			}
+		}
+		require("AZURE_RESOURCE_NAME", config.AzureResourceName)
+		require("AZURE_DEPLOYMENT_NAME", config.AzureDeploymentName)
+		require("AZURE_API_VERSION", config.AzureApiVersion)
+		require("AZURE_OPENAI_TOKEN", config.AzureOpenaiToken)
+	}
+	// Azure 接口不支持语音合成, 语音回复需要返回 Ogg Opus 的 /v1/audio/speech 接口
+	if config.VoiceReply && config.AzureOn {
+		problems = append(problems, "VOICE_REPLY is not supported when AZURE_ON is true, "+
+			"it needs a /v1/audio/speech endpoint that supports response_format opus")
+	}
+	if config.TTSSpeed < 0.25 || config.TTSSpeed > 4 {
+		problems = append(problems, fmt.Sprintf("TTS_SPEED: %v is not between 0.25 and 4.0",
+			config.TTSSpeed))
+	}
+	if _, err := url.ParseRequestURI(config.OpenaiApiUrl); err != nil {
+		problems = append(problems, fmt.Sprintf("API_URL: %v", err))
+	}
+
+	checkPort := func(key string, port int) {
+		if port <= 0 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("%s: %d is not a valid port", key, port))
+		}
+	}
+	checkPort("HTTP_PORT", config.HttpPort)
+	if config.UseHttps {
+		checkPort("HTTPS_PORT", config.HttpsPort)
+		for _, file := range [][2]string{
+			{"CERT_FILE", config.CertFile}, {"KEY_FILE", config.KeyFile}} {
+			if _, err := os.Stat(file[1]); err != nil {
+				problems = append(problems, fmt.Sprintf(
+					"%s: %v, it is required when USE_HTTPS is true", file[0], err))
+			}
+		}
+	}
+	for _, mode := range config.GroupModes {
+		if !contains(GroupModes, mode) {
+			problems = append(problems, fmt.Sprintf("GROUP_MODE: unknown mode %s, use %s",
+				mode, strings.Join(GroupModes, ", ")))
+		}
+	}
+	if contains(config.GroupModes, "keyword") && len(config.GroupKeywords) == 0 {
+		problems = append(problems, "GROUP_KEYWORDS is required when GROUP_MODE includes keyword")
+	}
+	if _, err := time.LoadLocation(config.DefaultTimezone); err != nil {
+		problems = append(problems, fmt.Sprintf("DEFAULT_TIMEZONE: %v", err))
+	}
+	for i, job := range config.Schedules {
+		key := fmt.Sprintf("SCHEDULES[%d]", i)
+		if job.Name != "" {
+			key = fmt.Sprintf("SCHEDULES[%s]", job.Name)
+		}
+		if _, err := scheduleParser.Parse(job.Spec); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.spec: %v", key, err))
+		}
+		if job.ChatId == "" {
+			problems = append(problems, key+".chat_id is required")
+		}
+		switch job.Kind {
+		case "", "prompt":
+			if job.Prompt == "" {
+				problems = append(problems, key+".prompt is required")
+			}
+		case "summary":
+		default:
+			problems = append(problems, fmt.Sprintf("%s.kind: unknown kind %s, use prompt or summary",
+				key, job.Kind))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ConfigError{Problems: problems}
+}
+
+// Summary 生效的主要配置, 密钥只显示首尾几位
+func (config *Config) Summary() string {
+	keys := make([]string, 0, len(config.OpenaiApiKeys))
+	for _, key := range config.OpenaiApiKeys {
+		keys = append(keys, maskSecret(key))
+	}
+	rows := [][2]string{
+		{"APP_ID", config.FeishuAppId},
+		{"APP_SECRET", maskSecret(config.FeishuAppSecret)},
+		{"APP_ENCRYPT_KEY", maskSecret(config.FeishuAppEncryptKey)},
+		{"APP_VERIFICATION_TOKEN", maskSecret(config.FeishuAppVerificationToken)},
+		{"BOT_NAME", config.FeishuBotName},
+	}
+	if config.AzureOn {
+		rows = append(rows,
+			[2]string{"AZURE_RESOURCE_NAME", config.AzureResourceName},
+			[2]string{"AZURE_DEPLOYMENT_NAME", config.AzureDeploymentName},
+			[2]string{"AZURE_EMBEDDING_DEPLOYMENT_NAME", config.AzureEmbeddingDeployment},
+			[2]string{"AZURE_API_VERSION", config.AzureApiVersion},
+			[2]string{"AZURE_OPENAI_TOKEN", maskSecret(config.AzureOpenaiToken)})
+	} else {
+		rows = append(rows,
+			[2]string{"OPENAI_KEY", fmt.Sprintf("%d keys %s", len(keys),
+				strings.Join(keys, ", "))},
+			[2]string{"API_URL", config.OpenaiApiUrl})
+	}
+	rows = append(rows,
+		[2]string{"HTTP_PROXY", redactURL(config.HttpProxy)},
+		[2]string{"HTTP_PORT", fmt.Sprint(config.HttpPort)})
+	if config.UseHttps {
+		rows = append(rows,
+			[2]string{"HTTPS_PORT", fmt.Sprint(config.HttpsPort)},
+			[2]string{"CERT_FILE", config.CertFile},
+			[2]string{"KEY_FILE", config.KeyFile})
+	}
+	rows = append(rows,
+		[2]string{"DATA_DIR", config.DataDir},
+		[2]string{"KNOWLEDGE_BASE_DIR", config.KnowledgeBaseDir},
+		[2]string{"ADMIN_USERS", fmt.Sprintf("%d users", len(config.AdminUsers))},
+		[2]string{"DEFAULT_TIMEZONE", config.DefaultTimezone},
+		[2]string{"VISION_MODEL", config.VisionModel},
+		[2]string{"TOOLS_ENABLED", fmt.Sprint(config.ToolsEnabled)},
+		[2]string{"TRANSCRIBE_LANGUAGE", config.TranscribeLanguage},
+		[2]string{"VOICE_REPLY", fmt.Sprintf("%v (%s, %s, %v)", config.VoiceReply,
+			config.TTSModel, config.TTSVoice, config.TTSSpeed)},
+		[2]string{"SCHEDULES", fmt.Sprintf("%d jobs", len(config.Schedules))},
+		[2]string{"ROLE_FILE", config.RoleFile},
+		[2]string{"CHAT_MODELS", strings.Join(config.ChatModels, ", ")},
+		[2]string{"GROUP_MODE", strings.Join(config.GroupModes, ", ")},
+		[2]string{"GROUP_KEYWORDS", strings.Join(config.GroupKeywords, ", ")})
+	for _, app := range config.Apps {
+		rows = append(rows, [2]string{"APPS[" + app.Name + "]", fmt.Sprintf(
+			"app_id %s, app_secret %s, bot %s, role_file %s", app.AppId,
+			maskSecret(app.AppSecret), orInherited(app.BotName), orInherited(app.RoleFile))})
+	}
+
+	var b strings.Builder
+	b.WriteString("Effective config:\n")
+	for _, row := range rows {
+		value := row[1]
+		if value == "" {
+			value = "(empty)"
+		}
+		fmt.Fprintf(&b, "  %-24s %s\n", row[0], value)
+	}
+	return b.String()
+}
+
+// maskSecret 只保留密钥的前 3 位和后 4 位
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 10 {
+		return "****"
+	}
+	return secret[:3] + "****" + secret[len(secret)-4:]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func orInherited(value string) string {
+	if value == "" {
+		return "(inherited)"
+	}
+	return value
+}
+
+// redactURL 隐藏代理地址中的密码
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -1,15 +1,24 @@
 package initialization
 
 import (
+	"context"
+
 	lark "github.com/larksuite/oapi-sdk-go/v3"
 )
 
-var larkClient *lark.Client
+type larkClientKey struct{}
+
+// NewLarkClient 每个飞书应用使用独立的客户端
+func NewLarkClient(config Config) *lark.Client {
+	return lark.NewClient(config.FeishuAppId, config.FeishuAppSecret)
+}
 
-func LoadLarkClient(config Config) {
-	larkClient = lark.NewClient(config.FeishuAppId, config.FeishuAppSecret)
+// WithLarkClient 把应用的客户端放入 ctx, 处理消息时按 ctx 找到所属应用的客户端
+func WithLarkClient(ctx context.Context, client *lark.Client) context.Context {
+	return context.WithValue(ctx, larkClientKey{}, client)
 }
 
-func GetLarkClient() *lark.Client {
-	return larkClient
+func GetLarkClient(ctx context.Context) *lark.Client {
+	client, _ := ctx.Value(larkClientKey{}).(*lark.Client)
+	return client
 }
@@ -0,0 +1,235 @@
+package initialization
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay 编辑器保存文件时会触发多次事件, 合并后只重新加载一次
+const reloadDelay = 500 * time.Millisecond
+
+// ConfigReloader 重新加载配置文件和角色文件, 校验通过后才替换当前配置,
+// 失败时保留上一次可用的版本
+type ConfigReloader struct {
+	path     string
+	mu       sync.Mutex
+	current  Config
+	roles    map[string]*Roles
+	onReload []func(Config)
+}
+
+// NewConfigReloader 加载每个应用的角色文件, 任一文件无效时返回错误
+func NewConfigReloader(path string, config Config) (*ConfigReloader, error) {
+	r := &ConfigReloader{path: path, current: config, roles: make(map[string]*Roles)}
+	lists, err := readAppRoles(config)
+	if err != nil {
+		return nil, err
+	}
+	for app, list := range lists {
+		r.roles[app] = &Roles{list: list}
+	}
+	return r, nil
+}
+
+// Roles 应用的角色列表, 重新加载后原地更新
+func (r *ConfigReloader) Roles(app string) *Roles {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	roles, ok := r.roles[app]
+	if !ok {
+		roles = &Roles{}
+		r.roles[app] = roles
+	}
+	return roles
+}
+
+// readAppRoles 读取每个应用的角色文件
+func readAppRoles(config Config) (map[string][]Role, error) {
+	lists := make(map[string][]Role)
+	for _, app := range config.AppConfigs() {
+		list, err := ReadRoleList(app.RoleFile)
+		if err != nil {
+			if app.AppName != "" {
+				return nil, fmt.Errorf("loading roles of %s: %w", app.AppName, err)
+			}
+			return nil, fmt.Errorf("loading roles: %w", err)
+		}
+		lists[app.AppName] = list
+	}
+	return lists, nil
+}
+
+// Current 当前生效的配置
+func (r *ConfigReloader) Current() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// OnReload 注册配置替换后的回调, 回调按注册顺序执行
+func (r *ConfigReloader) OnReload(fn func(Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = append(r.onReload, fn)
+}
+
+// Reload 重新读取配置和角色文件. 成功时返回需要重启才能生效的配置项
+func (r *ConfigReloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	config := LoadConfig(r.path)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	lists, err := readAppRoles(*config)
+	if err != nil {
+		return nil, err
+	}
+	restart := restartRequired(r.current, *config)
+	r.current = *config
+	for app, list := range lists {
+		roles, ok := r.roles[app]
+		if !ok {
+			roles = &Roles{}
+			r.roles[app] = roles
+		}
+		roles.Set(list)
+	}
+	for _, fn := range r.onReload {
+		fn(*config)
+	}
+	return restart, nil
+}
+
+// restartRequired 启动时就已使用, 修改后需要重启进程的配置项
+func restartRequired(old Config, new Config) []string {
+	var keys []string
+	for _, item := range []struct {
+		key      string
+		old, new interface{}
+	}{
+		{"APP_ID", old.FeishuAppId, new.FeishuAppId},
+		{"APP_SECRET", old.FeishuAppSecret, new.FeishuAppSecret},
+		{"APP_ENCRYPT_KEY", old.FeishuAppEncryptKey, new.FeishuAppEncryptKey},
+		{"APP_VERIFICATION_TOKEN", old.FeishuAppVerificationToken, new.FeishuAppVerificationToken},
+		{"HTTP_PORT", old.HttpPort, new.HttpPort},
+		{"HTTPS_PORT", old.HttpsPort, new.HttpsPort},
+		{"USE_HTTPS", old.UseHttps, new.UseHttps},
+		{"CERT_FILE", old.CertFile, new.CertFile},
+		{"KEY_FILE", old.KeyFile, new.KeyFile},
+		{"KNOWLEDGE_BASE_DIR", old.KnowledgeBaseDir, new.KnowledgeBaseDir},
+		{"DATA_DIR", old.DataDir, new.DataDir},
+		{"DEFAULT_TIMEZONE", old.DefaultTimezone, new.DefaultTimezone},
+		{"ADMIN_TOOLS", old.AdminTools, new.AdminTools},
+		{"SCHEDULES", old.Schedules, new.Schedules},
+		{"APPS", appCredentials(old), appCredentials(new)},
+	} {
+		if !reflect.DeepEqual(item.old, item.new) {
+			keys = append(keys, item.key)
+		}
+	}
+	return keys
+}
+
+// appCredentials 各应用的名称、凭证和数据目录, 增删应用或修改凭证需要重启
+func appCredentials(config Config) [][]string {
+	var apps [][]string
+	for _, app := range config.Apps {
+		c := config.forApp(app)
+		apps = append(apps, []string{c.AppName, c.FeishuAppId, c.FeishuAppSecret,
+			c.FeishuAppEncryptKey, c.FeishuAppVerificationToken, c.DataDir})
+	}
+	return apps
+}
+
+// Watch 监听配置文件和角色文件所在的目录, 文件变化后自动重新加载.
+// 监听目录而不是文件, 编辑器先删除再写入新文件时也能收到事件
+func (r *ConfigReloader) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := make(map[string]bool)
+	watchDir := func(file string) error {
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			return nil
+		}
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+		dirs[dir] = true
+		return nil
+	}
+	watched := func() map[string]bool {
+		paths := []string{r.path}
+		for _, app := range r.Current().AppConfigs() {
+			paths = append(paths, app.RoleFile)
+		}
+		files := make(map[string]bool)
+		for _, file := range paths {
+			if abs, err := filepath.Abs(file); err == nil {
+				files[abs] = true
+			}
+		}
+		return files
+	}
+	for file := range watched() {
+		if err := watchDir(file); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		var timer *time.Timer
+		reload := make(chan struct{}, 1)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if abs, err := filepath.Abs(event.Name); err != nil || !watched()[abs] {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDelay, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			case <-reload:
+				restart, err := r.Reload()
+				if err != nil {
+					fmt.Printf("config reload rejected, keeping the previous config: %v\n", err)
+					continue
+				}
+				fmt.Println("config reloaded")
+				if len(restart) > 0 {
+					fmt.Printf("restart to apply changes to %v\n", restart)
+				}
+				// 角色文件路径可能已修改
+				for file := range watched() {
+					if err := watchDir(file); err != nil {
+						fmt.Printf("failed to watch %s: %v\n", file, err)
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Printf("config watcher error: %v\n", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,174 @@
+package initialization
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRoles = "- title: 周报生成\n  content: 请帮我写周报\n  tags:\n    - 日常办公\n"
+
+func TestReadRoleList(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", testRoles, ""},
+		{"empty", "", "no roles defined"},
+		{"no title", "- content: hi\n", "role #1 has no title"},
+		{"duplicate", testRoles + testRoles, "duplicate role title 周报生成"},
+		{"broken yaml", "- title: [a\n", "parsing"},
+		{"template", "- title: t\n  content: 用{{ language }}回答{{user_name}}, 今天是{{date}}\n", ""},
+		{"unknown variable", "- title: t\n  content: hi {{name}}\n",
+			"role t uses unknown variable {{name}}"},
+		{"incomplete example", "- title: t\n  content: hi\n  examples:\n    - user: a\n",
+			"example #1 of role t needs both user and assistant"},
+		{"temperature", "- title: t\n  content: hi\n  temperature: 3\n",
+			"temperature 3 is not between 0 and 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".yaml")
+			os.WriteFile(path, []byte(tt.content), 0o644)
+			_, err := ReadRoleList(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ReadRoleList() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ReadRoleList() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ReadRoleList("../role_list.yaml"); err != nil {
+		t.Errorf("the bundled role list is invalid: %v", err)
+	}
+}
+
+func TestRoleRender(t *testing.T) {
+	role := Role{Content: "请用{{ language }}回答{{user_name}}的问题, 今天是{{date}}, {{other}}"}
+	got := role.Render(map[string]string{"language": "English", "user_name": "Alice",
+		"date": "2026-10-18"})
+	want := "请用English回答Alice的问题, 今天是2026-10-18, {{other}}"
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestConfigReloader(t *testing.T) {
+	dir := t.TempDir()
+	roleFile := filepath.Join(dir, "roles.yaml")
+	os.WriteFile(roleFile, []byte(testRoles), 0o644)
+	base := "APP_ID: cli_a\nAPP_SECRET: s\nROLE_FILE: " + roleFile + "\n"
+	path := writeConfig(t, base+"OPENAI_KEY: sk-a\n")
+	reloader, err := NewConfigReloader(path, *LoadConfig(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := reloader.Roles("")
+	var reloaded []Config
+	reloader.OnReload(func(c Config) { reloaded = append(reloaded, c) })
+
+	// 无效的配置不生效
+	os.WriteFile(path, []byte(base+"OPENAI_KEY: \"\"\n"), 0o644)
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("Reload() should reject a config without keys")
+	}
+	if keys := reloader.Current().OpenaiApiKeys; len(keys) != 1 || keys[0] != "sk-a" {
+		t.Errorf("keys after a rejected reload = %v, want the previous keys", keys)
+	}
+
+	// 无效的角色文件同样不生效
+	os.WriteFile(path, []byte(base+"OPENAI_KEY: sk-b\n"), 0o644)
+	os.WriteFile(roleFile, []byte("- title: broken\n"), 0o644)
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("Reload() should reject an invalid role list")
+	}
+	if len(reloaded) != 0 || roles.GetRoleByTitle("周报生成") == nil {
+		t.Errorf("rejected reloads should keep the previous config and roles")
+	}
+
+	os.WriteFile(roleFile, []byte(testRoles+"- title: 翻译\n  content: 翻译成英文\n"), 0o644)
+	os.WriteFile(path, []byte(base+"OPENAI_KEY: sk-b,sk-c\nHTTP_PORT: 9100\n"), 0o644)
+	restart, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(restart) != 1 || restart[0] != "HTTP_PORT" {
+		t.Errorf("restart required for %v, want [HTTP_PORT]", restart)
+	}
+	if len(reloaded) != 1 || len(reloaded[0].OpenaiApiKeys) != 2 {
+		t.Errorf("OnReload got %v, want the new keys", reloaded)
+	}
+	if roles.GetRoleByTitle("翻译") == nil {
+		t.Errorf("the new role should be loaded")
+	}
+}
+
+func TestConfigReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	roleFile := filepath.Join(dir, "roles.yaml")
+	os.WriteFile(roleFile, []byte(testRoles), 0o644)
+	base := "APP_ID: cli_a\nAPP_SECRET: s\nROLE_FILE: " + roleFile + "\n"
+	path := writeConfig(t, base+"OPENAI_KEY: sk-a\n")
+	reloader, err := NewConfigReloader(path, *LoadConfig(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan Config, 1)
+	reloader.OnReload(func(c Config) {
+		select {
+		case done <- c:
+		default:
+		}
+	})
+	if err := reloader.Watch(); err != nil {
+		t.Skipf("file watching is not available: %v", err)
+	}
+
+	os.WriteFile(path, []byte(base+"OPENAI_KEY: sk-new\n"), 0o644)
+	select {
+	case c := <-done:
+		if len(c.OpenaiApiKeys) != 1 || c.OpenaiApiKeys[0] != "sk-new" {
+			t.Errorf("reloaded keys = %v, want [sk-new]", c.OpenaiApiKeys)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the config was not reloaded after the file changed")
+	}
+}
+
+func TestConfigReloaderApps(t *testing.T) {
+	dir := t.TempDir()
+	roleFile := filepath.Join(dir, "roles.yaml")
+	salesRoles := filepath.Join(dir, "sales.yaml")
+	os.WriteFile(roleFile, []byte(testRoles), 0o644)
+	os.WriteFile(salesRoles, []byte("- title: 报价\n  content: 帮我写报价单\n"), 0o644)
+	base := "APP_ID: cli_a\nAPP_SECRET: s\nOPENAI_KEY: sk-a\nROLE_FILE: " + roleFile +
+		"\nAPPS:\n  - name: sales\n    app_id: cli_b\n    app_secret: t\n    role_file: " +
+		salesRoles + "\n"
+	path := writeConfig(t, base)
+	reloader, err := NewConfigReloader(path, *LoadConfig(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloader.Roles("").GetRoleByTitle("报价") != nil ||
+		reloader.Roles("sales").GetRoleByTitle("报价") == nil {
+		t.Errorf("each app should only see its own roles")
+	}
+
+	os.WriteFile(path, []byte(strings.Replace(base, "cli_b", "cli_c", 1)), 0o644)
+	restart, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(restart) != 1 || restart[0] != "APPS" {
+		t.Errorf("restart required for %v, want [APPS]", restart)
+	}
+}
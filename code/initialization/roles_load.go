@@ -2,8 +2,11 @@ package initialization
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/duke-git/lancet/v2/slice"
 	"github.com/duke-git/lancet/v2/validator"
@@ -11,41 +14,126 @@ import (
 )
 
 type Role struct {
-	Title   string   `yaml:"title"`
-	Content string   `yaml:"content"`
-	Tags    []string `yaml:"tags"`
+	Title string `yaml:"title"`
+	// Content 系统提示词, 可以使用 RoleVariables 中的模板变量, 例如 {{language}}
+	Content     string `yaml:"content"`
+	Description string `yaml:"description"`
+	// Example 示例提问, 在角色详情卡片中展示
+	Example string `yaml:"example"`
+	Author  string `yaml:"author"`
+	// Examples 选择角色后加入会话的示例对话
+	Examples []RoleExample `yaml:"examples"`
+	// Model 和 Temperature 选择角色后会话使用的模型和温度, 为空时不修改
+	Model       string   `yaml:"model"`
+	Temperature *float64 `yaml:"temperature"`
+	Tags        []string `yaml:"tags"`
 }
 
-var RoleList *[]Role
+// RoleExample 一轮示例对话
+type RoleExample struct {
+	User      string `yaml:"user"`
+	Assistant string `yaml:"assistant"`
+}
+
+// RoleVariables 角色提示词中可用的模板变量, 选择角色时填入
+var RoleVariables = []string{"language", "user_name", "date"}
+
+var roleVariablePattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Render 填入模板变量, 未提供的变量保持原样
+func (role Role) Render(vars map[string]string) string {
+	return roleVariablePattern.ReplaceAllStringFunc(role.Content, func(match string) string {
+		name := roleVariablePattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
 
-// InitRoleList 加载Prompt
-func InitRoleList() *[]Role {
-	data, err := ioutil.ReadFile("role_list.yaml")
+// Roles 一个飞书应用的角色列表, 热更新时整体替换
+type Roles struct {
+	mu   sync.RWMutex
+	list []Role
+}
+
+// ReadRoleList 加载Prompt, 读取并校验角色文件
+func ReadRoleList(path string) ([]Role, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	var roles []Role
+	if err = yaml.Unmarshal(data, &roles); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
 	}
+	if err = validateRoles(roles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return roles, nil
+}
 
-	err = yaml.Unmarshal(data, &RoleList)
-	if err != nil {
-		log.Fatal(err)
+// Set 替换角色列表
+func (r *Roles) Set(roles []Role) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.list = roles
+}
+
+func validateRoles(roles []Role) error {
+	if len(roles) == 0 {
+		return errors.New("no roles defined")
+	}
+	titles := make(map[string]bool)
+	for i, role := range roles {
+		if strings.TrimSpace(role.Title) == "" {
+			return fmt.Errorf("role #%d has no title", i+1)
+		}
+		if strings.TrimSpace(role.Content) == "" {
+			return fmt.Errorf("role %s has no content", role.Title)
+		}
+		if titles[role.Title] {
+			return fmt.Errorf("duplicate role title %s", role.Title)
+		}
+		for _, match := range roleVariablePattern.FindAllStringSubmatch(role.Content, -1) {
+			if !contains(RoleVariables, match[1]) {
+				return fmt.Errorf("role %s uses unknown variable %s, available: %s",
+					role.Title, match[0], strings.Join(RoleVariables, ", "))
+			}
+		}
+		for j, example := range role.Examples {
+			if strings.TrimSpace(example.User) == "" ||
+				strings.TrimSpace(example.Assistant) == "" {
+				return fmt.Errorf("example #%d of role %s needs both user and assistant",
+					j+1, role.Title)
+			}
+		}
+		if t := role.Temperature; t != nil && (*t < 0 || *t > 2) {
+			return fmt.Errorf("role %s: temperature %v is not between 0 and 2",
+				role.Title, *t)
+		}
+		titles[role.Title] = true
 	}
-	return RoleList
+	return nil
 }
 
-func GetRoleList() *[]Role {
-	return RoleList
+func (r *Roles) GetRoleList() *[]Role {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := r.list
+	return &list
 }
-func GetAllUniqueTags() *[]string {
+func (r *Roles) GetAllUniqueTags() *[]string {
 	tags := make([]string, 0)
-	for _, role := range *RoleList {
+	for _, role := range *r.GetRoleList() {
 		tags = append(tags, role.Tags...)
 	}
 	result := slice.Union(tags)
 	return &result
 }
 
-func GetRoleByTitle(title string) *Role {
-	for _, role := range *RoleList {
+func (r *Roles) GetRoleByTitle(title string) *Role {
+	for _, role := range *r.GetRoleList() {
 		if role.Title == title {
 			return &role
 		}
@@ -53,10 +141,9 @@ func GetRoleByTitle(title string) *Role {
 	return nil
 }
 
-func GetTitleListByTag(tags string) *[]string {
+func (r *Roles) GetTitleListByTag(tags string) *[]string {
 	roles := make([]string, 0)
-	//pp.Println(RoleList)
-	for _, role := range *RoleList {
+	for _, role := range *r.GetRoleList() {
 		for _, roleTag := range role.Tags {
 			if roleTag == tags && !validator.IsEmptyString(role.
 				Title) {
@@ -67,8 +154,8 @@ func GetTitleListByTag(tags string) *[]string {
 	return &roles
 }
 
-func GetFirstRoleContentByTitle(title string) (string, error) {
-	for _, role := range *RoleList {
+func (r *Roles) GetFirstRoleContentByTitle(title string) (string, error) {
+	for _, role := range *r.GetRoleList() {
 		if role.Title == title {
 			return role.Content, nil
 		}
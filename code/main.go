@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	"start-feishubot/handlers"
 	"start-feishubot/initialization"
+	"start-feishubot/services/knowledge"
 	"start-feishubot/services/openai"
 
 	"github.com/gin-gonic/gin"
@@ -17,27 +21,63 @@ import (
 )
 
 var (
-	cfg = pflag.StringP("config", "c", "./config.yaml", "apiserver config file path.")
+	cfg    = pflag.StringP("config", "c", "./config.yaml", "apiserver config file path.")
+	ingest = pflag.String("ingest", "", "markdown directory to build a knowledge base from, then exit.")
+	kbName = pflag.String("kb", "default", "knowledge base name used with --ingest.")
+	check  = pflag.Bool("check-config", false, "validate the config, print the effective settings, then exit.")
 )
 
 func main() {
-	initialization.InitRoleList()
 	pflag.Parse()
 	config := initialization.LoadConfig(*cfg)
-	initialization.LoadLarkClient(*config)
-	gpt := openai.NewChatGPT(*config)
-	handlers.InitHandlers(gpt, *config)
-
-	eventHandler := dispatcher.NewEventDispatcher(
-		config.FeishuAppVerificationToken, config.FeishuAppEncryptKey).
-		OnP2MessageReceiveV1(handlers.Handler).
-		OnP2MessageReadV1(func(ctx context.Context, event *larkim.P2MessageReadV1) error {
-			return handlers.ReadHandler(ctx, event)
-		})
+	err := config.Validate()
+	var reloader *initialization.ConfigReloader
+	if err == nil {
+		reloader, err = initialization.NewConfigReloader(*cfg, *config)
+	}
+	fmt.Print(config.Summary())
+	if *check {
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("config is valid")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *ingest != "" {
+		if err := ingestKnowledgeBase(openai.NewChatGPT(*config), *config); err != nil {
+			log.Fatalf("failed to ingest knowledge base: %v", err)
+		}
+		return
+	}
 
-	cardHandler := larkcard.NewCardActionHandler(
-		config.FeishuAppVerificationToken, config.FeishuAppEncryptKey,
-		handlers.CardHandler())
+	// 每个飞书应用使用独立的处理器, 回调地址为 /webhook/event/:app 和
+	// /webhook/card/:app, 顶层应用同时使用不带名称的地址
+	eventHandlers := make(map[string]gin.HandlerFunc)
+	cardHandlers := make(map[string]gin.HandlerFunc)
+	for _, app := range config.AppConfigs() {
+		h, err := handlers.NewMessageHandler(app.AppName, reloader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		eventHandler := dispatcher.NewEventDispatcher(
+			app.FeishuAppVerificationToken, app.FeishuAppEncryptKey).
+			OnP2MessageReceiveV1(handlers.EventHandler(h)).
+			OnP2MessageReadV1(func(ctx context.Context, event *larkim.P2MessageReadV1) error {
+				return handlers.ReadHandler(ctx, event)
+			})
+		cardHandler := larkcard.NewCardActionHandler(
+			app.FeishuAppVerificationToken, app.FeishuAppEncryptKey,
+			handlers.CardHandler(h))
+		eventHandlers[app.AppName] = sdkginext.NewEventHandlerFunc(eventHandler)
+		cardHandlers[app.AppName] = sdkginext.NewCardActionHandlerFunc(cardHandler)
+	}
+	if err := reloader.Watch(); err != nil {
+		fmt.Printf("config hot reload is disabled: %v\n", err)
+	}
 
 	r := gin.Default()
 	r.GET("/ping", func(c *gin.Context) {
@@ -45,13 +85,39 @@ func main() {
 			"message": "pong",
 		})
 	})
-	r.POST("/webhook/event",
-		sdkginext.NewEventHandlerFunc(eventHandler))
-	r.POST("/webhook/card",
-		sdkginext.NewCardActionHandlerFunc(
-			cardHandler))
+	r.POST("/webhook/event", appHandler(eventHandlers))
+	r.POST("/webhook/event/:app", appHandler(eventHandlers))
+	r.POST("/webhook/card", appHandler(cardHandlers))
+	r.POST("/webhook/card/:app", appHandler(cardHandlers))
 
 	if err := initialization.StartServer(*config, r); err != nil {
 		log.Fatalf("failed to start server: %v", err)
 	}
 }
+
+// appHandler 按路径中的应用名称分发回调, 未配置的应用返回 404
+func appHandler(byApp map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h, ok := byApp[c.Param("app")]
+		if !ok {
+			c.JSON(404, gin.H{"message": "unknown app"})
+			return
+		}
+		h(c)
+	}
+}
+
+func ingestKnowledgeBase(gpt *openai.ChatGPT, config initialization.Config) error {
+	manager := knowledge.NewManager(config.KnowledgeBaseDir,
+		filepath.Join(config.DataDir, "knowledge_selections.json"))
+	idx, err := knowledge.Ingest(*kbName, *ingest, gpt)
+	if err != nil {
+		return err
+	}
+	if err := manager.Save(idx); err != nil {
+		return err
+	}
+	fmt.Printf("knowledge base %s saved to %s with %d chunks\n",
+		idx.Name, manager.IndexPath(idx.Name), len(idx.Entries))
+	return nil
+}
@@ -0,0 +1,146 @@
+package document
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// 单个分块的最大字符数
+	chunkSize = 600
+	// 分块之间重叠的字符数, 避免句子被切断后丢失上下文
+	chunkOverlap = 80
+	// 文档文件的最大体积
+	MaxFileSize = 20 * 1024 * 1024
+)
+
+// Chunk 文档分块, Location 用于回答时引用页码或章节
+type Chunk struct {
+	Index    int    `json:"index"`
+	Location string `json:"location"`
+	Content  string `json:"content"`
+}
+
+type Document struct {
+	Name   string  `json:"name"`
+	Format string  `json:"format"`
+	Chunks []Chunk `json:"chunks"`
+	// Source 文档来源, 如飞书文档链接, 用于判断是否已经读取过
+	Source string `json:"source,omitempty"`
+}
+
+// section 解析器输出的原始段落, 之后统一切分成 Chunk
+type section struct {
+	location string
+	text     string
+}
+
+var parsers = map[string]func(data []byte) ([]section, error){
+	".pdf":      parsePdf,
+	".docx":     parseDocx,
+	".txt":      parseText,
+	".md":       parseMarkdown,
+	".markdown": parseMarkdown,
+}
+
+// IsSupported 判断文件名后缀是否支持解析
+func IsSupported(fileName string) bool {
+	_, ok := parsers[strings.ToLower(filepath.Ext(fileName))]
+	return ok
+}
+
+// SupportedFormats 返回支持的文件后缀, 用于提示用户
+func SupportedFormats() []string {
+	return []string{"pdf", "docx", "txt", "md"}
+}
+
+// Parse 根据文件名后缀解析文档并切分为分块
+func Parse(fileName string, data []byte) (*Document, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	parser, ok := parsers[ext]
+	if !ok {
+		return nil, fmt.Errorf("unsupported file format: %s", ext)
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("file too large, must be under %d MB",
+			MaxFileSize/1024/1024)
+	}
+	sections, err := parser(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		Name:   fileName,
+		Format: strings.TrimPrefix(ext, "."),
+	}
+	for _, s := range sections {
+		for _, text := range splitText(s.text, chunkSize, chunkOverlap) {
+			doc.Chunks = append(doc.Chunks, Chunk{
+				Index:    len(doc.Chunks),
+				Location: s.location,
+				Content:  text,
+			})
+		}
+	}
+	if len(doc.Chunks) == 0 {
+		return nil, fmt.Errorf("no text found in %s", fileName)
+	}
+	return doc, nil
+}
+
+// Length 文档总字符数
+func (d *Document) Length() int {
+	total := 0
+	for _, c := range d.Chunks {
+		total += len([]rune(c.Content))
+	}
+	return total
+}
+
+// splitText 按段落优先切分文本, 超长段落按字符硬切
+func splitText(text string, size int, overlap int) []string {
+	var chunks []string
+	var current []rune
+	// current 中是否有尚未输出的新内容
+	fresh := false
+	flush := func() {
+		if fresh {
+			chunks = append(chunks, strings.TrimSpace(string(current)))
+		}
+		if len(current) > overlap {
+			current = append([]rune{}, current[len(current)-overlap:]...)
+		} else {
+			current = nil
+		}
+		fresh = false
+	}
+	for _, para := range strings.Split(text, "\n") {
+		runes := []rune(strings.TrimSpace(para))
+		if len(runes) == 0 {
+			continue
+		}
+		runes = append(runes, '\n')
+		for len(runes) > 0 {
+			room := size - len(current)
+			if len(runes) <= room {
+				current = append(current, runes...)
+				// 只剩段落末尾的换行时不算新内容, 避免输出只有重叠部分的分块
+				fresh = fresh || len(runes) > 1
+				break
+			}
+			// 段落放得进下一个分块, 则另起一块
+			if fresh && len(runes) <= size-overlap {
+				flush()
+				continue
+			}
+			current = append(current, runes[:room]...)
+			runes = runes[room:]
+			fresh = true
+			flush()
+		}
+	}
+	flush()
+	return chunks
+}
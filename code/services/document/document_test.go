@@ -0,0 +1,159 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		size    int
+		overlap int
+		want    []string
+	}{
+		{"empty", "", 10, 2, nil},
+		{"blank lines only", "\n  \n\n", 10, 2, nil},
+		{"fits in one chunk", "abc\ndef", 10, 2, []string{"abc\ndef"}},
+		{"paragraphs start a new chunk with overlap", "aaaaaa\nbbbbbb", 10, 3,
+			[]string{"aaaaaa", "aa\nbbbbbb"}},
+		{"long paragraph is cut", "abcdefghijklmnop", 6, 2,
+			[]string{"abcdef", "efghij", "ijklmn", "mnop"}},
+		{"no overlap", "abcdefgh", 4, 0, []string{"abcd", "efgh"}},
+		{"no chunk with only the overlap", "abcdefghij", 6, 2, []string{"abcdef", "efghij"}},
+		{"multibyte runes", "一二三四五六七八", 4, 1, []string{"一二三四", "四五六七", "七八"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.text, tt.size, tt.overlap)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitText() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("chunk %d = %q, want %q", i, got[i], tt.want[i])
+				}
+				if n := len([]rune(got[i])); n > tt.size {
+					t.Errorf("chunk %d has %d runes, limit %d", i, n, tt.size)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitTextKeepsAllContent(t *testing.T) {
+	var paras []string
+	for i := 0; i < 50; i++ {
+		paras = append(paras, strings.Repeat(string(rune('a'+i%26)), 10+i*7))
+	}
+	chunks := splitText(strings.Join(paras, "\n"), chunkSize, chunkOverlap)
+	joined := strings.Join(chunks, "\n")
+	for i, para := range paras {
+		// 超长段落会被切断, 只检查开头
+		if !strings.Contains(joined, para[:10]) {
+			t.Errorf("paragraph %d is missing from the chunks", i)
+		}
+	}
+	for i, c := range chunks {
+		if n := len([]rune(c)); n > chunkSize {
+			t.Errorf("chunk %d has %d runes, limit %d", i, n, chunkSize)
+		}
+	}
+}
+
+func newDocx(t *testing.T, documentXml string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(documentXml))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	docx := newDocx(t, `<w:document xmlns:w="w"><w:body>`+
+		`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Intro</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Hello</w:t><w:tab/><w:t>world</w:t></w:r></w:p>`+
+		`<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Usage</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Run it</w:t></w:r></w:p>`+
+		`</w:body></w:document>`)
+	tests := []struct {
+		name          string
+		fileName      string
+		data          []byte
+		wantFormat    string
+		wantLocations []string
+		wantErr       string
+	}{
+		{"markdown", "notes.MD", []byte("intro\n# Setup\ninstall\n```\n# not a heading\n```\n## Run\nstart\r\n"),
+			"md", []string{"section 1", "section 2: Setup", "section 3: Run"}, ""},
+		{"text", "a.txt", []byte("first\n\n\nsecond\r\n\r\nthird"),
+			"txt", []string{"paragraph 1", "paragraph 2", "paragraph 3"}, ""},
+		{"docx", "a.docx", docx,
+			"docx", []string{"section 1: Intro", "section 2: Usage"}, ""},
+		{"unsupported", "a.xlsx", []byte("x"), "", nil, "unsupported file format"},
+		{"empty", "a.txt", []byte(" \n\n "), "", nil, "no text found"},
+		{"invalid utf-8", "a.md", []byte{0xff, 0xfe}, "", nil, "utf-8"},
+		{"invalid docx", "a.docx", []byte("not a zip"), "", nil, "failed to open docx"},
+		{"docx without body", "a.docx", newDocxWithout(t), "", nil, "word/document.xml not found"},
+		{"invalid pdf", "a.pdf", []byte("%PDF-1.4 broken"), "", nil, "pdf"},
+		{"too large", "a.txt", make([]byte, MaxFileSize+1), "", nil, "file too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.fileName, tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if doc.Format != tt.wantFormat {
+				t.Errorf("Format = %s, want %s", doc.Format, tt.wantFormat)
+			}
+			var locations []string
+			for i, c := range doc.Chunks {
+				if c.Index != i {
+					t.Errorf("chunk %d has index %d", i, c.Index)
+				}
+				locations = append(locations, c.Location)
+			}
+			if strings.Join(locations, "|") != strings.Join(tt.wantLocations, "|") {
+				t.Errorf("locations = %q, want %q", locations, tt.wantLocations)
+			}
+		})
+	}
+}
+
+func newDocxWithout(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	if _, err := w.Create("word/styles.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestIsSupported(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.pdf": true, "B.DOCX": true, "c.markdown": true, "d.doc": false, "noext": false,
+	} {
+		if got := IsSupported(name); got != want {
+			t.Errorf("IsSupported(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
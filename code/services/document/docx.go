@@ -0,0 +1,95 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseDocx 读取 word/document.xml, 以标题样式的段落划分章节
+func parseDocx(data []byte) ([]section, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open docx: %w", err)
+	}
+	var body io.ReadCloser
+	for _, f := range archive.File {
+		if f.Name == "word/document.xml" {
+			body, err = f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read docx: %w", err)
+			}
+			break
+		}
+	}
+	if body == nil {
+		return nil, fmt.Errorf("invalid docx: word/document.xml not found")
+	}
+	defer body.Close()
+
+	var sections []section
+	current := section{location: "section 1"}
+	var para strings.Builder
+	isHeading := false
+
+	decoder := xml.NewDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse docx: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				isHeading = false
+			case "pStyle":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "val" &&
+						strings.HasPrefix(strings.ToLower(attr.Value), "heading") {
+						isHeading = true
+					}
+				}
+			case "tab":
+				para.WriteString("\t")
+			case "br":
+				para.WriteString("\n")
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse docx: %w", err)
+				}
+				para.WriteString(text)
+			}
+		case xml.EndElement:
+			if t.Name.Local != "p" {
+				continue
+			}
+			text := strings.TrimSpace(para.String())
+			if text == "" {
+				continue
+			}
+			if isHeading {
+				if strings.TrimSpace(current.text) != "" {
+					sections = append(sections, current)
+				}
+				current = section{
+					location: fmt.Sprintf("section %d: %s",
+						len(sections)+1, text),
+				}
+			}
+			current.text += text + "\n"
+		}
+	}
+	if strings.TrimSpace(current.text) != "" {
+		sections = append(sections, current)
+	}
+	return sections, nil
+}
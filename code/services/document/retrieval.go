@@ -0,0 +1,113 @@
+package document
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Search 用 BM25 对分块打分, 返回与问题最相关的 topK 个分块(按原文顺序)
+func (d *Document) Search(query string, topK int) []Chunk {
+	if topK <= 0 || len(d.Chunks) == 0 {
+		return nil
+	}
+	if len(d.Chunks) <= topK {
+		return d.Chunks
+	}
+
+	queryTerms := terms(query)
+	chunkTerms := make([]map[string]int, len(d.Chunks))
+	docFreq := make(map[string]int)
+	totalLen := 0
+	for i, c := range d.Chunks {
+		tf := make(map[string]int)
+		for _, t := range terms(c.Content) {
+			tf[t]++
+			totalLen++
+		}
+		for t := range tf {
+			docFreq[t]++
+		}
+		chunkTerms[i] = tf
+	}
+	avgLen := float64(totalLen) / float64(len(d.Chunks))
+
+	type scored struct {
+		index int
+		score float64
+	}
+	scores := make([]scored, len(d.Chunks))
+	n := float64(len(d.Chunks))
+	for i, tf := range chunkTerms {
+		length := 0
+		for _, c := range tf {
+			length += c
+		}
+		var score float64
+		for _, t := range queryTerms {
+			f := float64(tf[t])
+			if f == 0 {
+				continue
+			}
+			df := float64(docFreq[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * f * (bm25K1 + 1) /
+				(f + bm25K1*(1-bm25B+bm25B*float64(length)/avgLen))
+		}
+		scores[i] = scored{index: i, score: score}
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].score > scores[j].score
+	})
+
+	picked := make([]int, 0, topK)
+	for _, s := range scores[:topK] {
+		picked = append(picked, s.index)
+	}
+	sort.Ints(picked)
+	result := make([]Chunk, 0, topK)
+	for _, i := range picked {
+		result = append(result, d.Chunks[i])
+	}
+	return result
+}
+
+// terms 拉丁文字按单词切分, 中日韩文字按单字和相邻二元组切分
+func terms(text string) []string {
+	var result []string
+	var word []rune
+	var prevCJK rune
+	flushWord := func() {
+		if len(word) > 1 {
+			result = append(result, string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flushWord()
+			result = append(result, string(r))
+			if prevCJK != 0 {
+				result = append(result, string([]rune{prevCJK, r}))
+			}
+			prevCJK = r
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			prevCJK = 0
+			word = append(word, r)
+		default:
+			prevCJK = 0
+			flushWord()
+		}
+	}
+	flushWord()
+	return result
+}
@@ -0,0 +1,65 @@
+package document
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	doc := &Document{Chunks: []Chunk{
+		{Index: 0, Content: "The office opens at nine in the morning."},
+		{Index: 1, Content: "Expense reports are due on the first Monday of each month."},
+		{Index: 2, Content: "Vacation requests need approval from your manager."},
+		{Index: 3, Content: "报销单需要在每月第一个周一之前提交。"},
+		{Index: 4, Content: "Parking is free for employees."},
+	}}
+	tests := []struct {
+		name  string
+		query string
+		topK  int
+		want  []int
+	}{
+		{"best match", "when are expense reports due", 1, []int{1}},
+		{"chinese bigrams", "报销什么时候提交", 1, []int{3}},
+		{"results keep document order", "manager approval for expense reports", 2, []int{1, 2}},
+		{"topK covers everything", "anything", 10, []int{0, 1, 2, 3, 4}},
+		{"zero topK", "expense", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := doc.Search(tt.query, tt.topK)
+			var indexes []int
+			for _, c := range got {
+				indexes = append(indexes, c.Index)
+			}
+			if len(indexes) != len(tt.want) {
+				t.Fatalf("Search() = %v, want %v", indexes, tt.want)
+			}
+			for i := range indexes {
+				if indexes[i] != tt.want[i] {
+					t.Fatalf("Search() = %v, want %v", indexes, tt.want)
+				}
+			}
+		})
+	}
+	if got := (&Document{}).Search("x", 3); got != nil {
+		t.Errorf("Search() on an empty document = %v, want nil", got)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello, World! a 42", "hello world 42"},
+		{"中文检索", "中 文 中文 检 文检 索 检索"},
+		{"go语言", "go 语 言 语言"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(terms(tt.text), " "); got != tt.want {
+			t.Errorf("terms(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
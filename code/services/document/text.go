@@ -0,0 +1,59 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseText 纯文本没有结构, 按空行分段并以段落序号定位
+func parseText(data []byte) ([]section, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("text file must be utf-8 encoded")
+	}
+	var sections []section
+	for _, block := range strings.Split(normalizeNewLine(string(data)), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		sections = append(sections, section{
+			location: fmt.Sprintf("paragraph %d", len(sections)+1),
+			text:     block,
+		})
+	}
+	return sections, nil
+}
+
+// parseMarkdown 以 # 标题划分章节
+func parseMarkdown(data []byte) ([]section, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("markdown file must be utf-8 encoded")
+	}
+	var sections []section
+	current := section{location: "section 1"}
+	inCode := false
+	for _, line := range strings.Split(normalizeNewLine(string(data)), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+		}
+		if !inCode && strings.HasPrefix(trimmed, "#") {
+			title := strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			if strings.TrimSpace(current.text) != "" {
+				sections = append(sections, current)
+			}
+			current = section{
+				location: fmt.Sprintf("section %d: %s", len(sections)+1, title),
+			}
+		}
+		current.text += line + "\n"
+	}
+	if strings.TrimSpace(current.text) != "" {
+		sections = append(sections, current)
+	}
+	return sections, nil
+}
+
+func normalizeNewLine(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
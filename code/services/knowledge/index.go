@@ -0,0 +1,85 @@
+package knowledge
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Entry 知识库中的一个分块及其向量
+type Entry struct {
+	Source   string    `json:"source"`
+	Location string    `json:"location"`
+	Content  string    `json:"content"`
+	Vector   []float64 `json:"vector"`
+}
+
+type Index struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Entries   []Entry   `json:"entries"`
+}
+
+type Result struct {
+	Entry
+	Score float64
+}
+
+// Search 余弦相似度检索, 返回得分最高的 topK 个分块
+func (idx *Index) Search(vector []float64, topK int) []Result {
+	results := make([]Result, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		results = append(results, Result{Entry: e, Score: cosine(vector, e.Vector)})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// Save 原子写入索引文件
+func (idx *Index) Save(path string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func LoadIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("invalid knowledge base %s: %w", path, err)
+	}
+	return idx, nil
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
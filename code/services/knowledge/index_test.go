@@ -0,0 +1,79 @@
+package knowledge
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"identical", []float64{1, 2}, []float64{1, 2}, 1},
+		{"scaled", []float64{1, 1}, []float64{3, 3}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, 0}, []float64{-1, 0}, -1},
+		{"different length", []float64{1, 0}, []float64{1}, 0},
+		{"zero vector", []float64{0, 0}, []float64{1, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cosine(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("cosine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := &Index{Entries: []Entry{
+		{Source: "a.md", Vector: []float64{1, 0, 0}},
+		{Source: "b.md", Vector: []float64{0.8, 0.6, 0}},
+		{Source: "c.md", Vector: []float64{0, 0, 1}},
+	}}
+	got := idx.Search([]float64{1, 0.1, 0}, 2)
+	if len(got) != 2 || got[0].Source != "a.md" || got[1].Source != "b.md" {
+		t.Fatalf("Search() = %+v, want a.md then b.md", got)
+	}
+	if got[0].Score < got[1].Score {
+		t.Errorf("results should be sorted by score")
+	}
+	if got := idx.Search([]float64{0, 0, 1}, 10); len(got) != 3 || got[0].Source != "c.md" {
+		t.Errorf("Search() with large topK = %+v", got)
+	}
+	if got := (&Index{}).Search([]float64{1}, 3); len(got) != 0 {
+		t.Errorf("Search() on an empty index = %+v", got)
+	}
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kb.kb.json")
+	idx := &Index{Name: "kb", Entries: []Entry{
+		{Source: "a.md", Location: "section 1", Content: "hello", Vector: []float64{0.5, 1}},
+	}}
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "kb" || len(loaded.Entries) != 1 ||
+		loaded.Entries[0].Content != "hello" || loaded.Entries[0].Vector[1] != 1 {
+		t.Errorf("LoadIndex() = %+v", loaded)
+	}
+
+	if _, err := LoadIndex(filepath.Join(t.TempDir(), "missing.kb.json")); err == nil {
+		t.Errorf("LoadIndex() of a missing file should fail")
+	}
+	broken := filepath.Join(t.TempDir(), "broken.kb.json")
+	os.WriteFile(broken, []byte("{"), 0644)
+	if _, err := LoadIndex(broken); err == nil {
+		t.Errorf("LoadIndex() of an invalid file should fail")
+	}
+}
@@ -0,0 +1,67 @@
+package knowledge
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"start-feishubot/services/document"
+)
+
+type Embedder interface {
+	Embeddings(input []string) ([][]float64, error)
+}
+
+// Ingest 遍历目录下的 Markdown 文件, 分块后计算向量生成索引
+func Ingest(name string, dir string, embedder Embedder) (*Index, error) {
+	idx := &Index{Name: name, CreatedAt: time.Now()}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		source, _ := filepath.Rel(dir, path)
+		doc, err := document.Parse(path, data)
+		if err != nil {
+			fmt.Printf("skip %s: %v\n", source, err)
+			return nil
+		}
+		for _, c := range doc.Chunks {
+			idx.Entries = append(idx.Entries, Entry{
+				Source:   filepath.ToSlash(source),
+				Location: c.Location,
+				Content:  c.Content,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(idx.Entries) == 0 {
+		return nil, fmt.Errorf("no markdown content found in %s", dir)
+	}
+
+	texts := make([]string, len(idx.Entries))
+	for i, e := range idx.Entries {
+		texts[i] = e.Source + " " + e.Location + "\n" + e.Content
+	}
+	vectors, err := embedder.Embeddings(texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute embeddings: %w", err)
+	}
+	for i := range idx.Entries {
+		idx.Entries[i].Vector = vectors[i]
+	}
+	return idx, nil
+}
@@ -0,0 +1,94 @@
+package knowledge
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// keywordEmbedder 每个关键词对应一个维度, 便于断言检索结果
+type keywordEmbedder struct {
+	keywords []string
+	err      error
+}
+
+func (e keywordEmbedder) Embeddings(input []string) ([][]float64, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	vectors := make([][]float64, len(input))
+	for i, text := range input {
+		vectors[i] = make([]float64, len(e.keywords))
+		for j, k := range e.keywords {
+			vectors[i][j] = float64(strings.Count(strings.ToLower(text), k))
+		}
+	}
+	return vectors, nil
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestIngest(t *testing.T) {
+	embedder := keywordEmbedder{keywords: []string{"vacation", "expense"}}
+	dir := writeFiles(t, map[string]string{
+		"hr/leave.md":      "# Vacation\nVacation requests need approval.",
+		"finance.markdown": "# Expense\nSubmit expense reports monthly.",
+		"notes.txt":        "vacation vacation vacation",
+		"empty.md":         "   ",
+	})
+	idx, err := Ingest("handbook", dir, embedder)
+	if err != nil {
+		t.Fatalf("Ingest() error = %v", err)
+	}
+	if idx.Name != "handbook" || len(idx.Entries) != 2 {
+		t.Fatalf("Ingest() = %+v, want 2 markdown entries", idx)
+	}
+	for _, e := range idx.Entries {
+		if len(e.Vector) != 2 || e.Location == "" {
+			t.Errorf("entry %+v should have a vector and a location", e)
+		}
+	}
+
+	vector, _ := embedder.Embeddings([]string{"how many vacation days"})
+	if got := idx.Search(vector[0], 1); len(got) != 1 || got[0].Source != "hr/leave.md" {
+		t.Errorf("Search() = %+v, want hr/leave.md", got)
+	}
+}
+
+func TestIngestErrors(t *testing.T) {
+	failing := keywordEmbedder{err: errors.New("quota exceeded")}
+	tests := []struct {
+		name     string
+		dir      string
+		embedder Embedder
+		wantErr  string
+	}{
+		{"no markdown", writeFiles(t, map[string]string{"a.txt": "hello"}),
+			keywordEmbedder{}, "no markdown content"},
+		{"missing dir", filepath.Join(t.TempDir(), "missing"), keywordEmbedder{}, "missing"},
+		{"embedding fails", writeFiles(t, map[string]string{"a.md": "hello"}),
+			failing, "quota exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Ingest("kb", tt.dir, tt.embedder)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Ingest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
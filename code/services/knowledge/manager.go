@@ -0,0 +1,129 @@
+package knowledge
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const indexExt = ".kb.json"
+
+// Manager 管理知识库目录下的索引, 以及每个会话群选择的知识库.
+// 索引可以由多个应用共用, 选择记录保存在各应用自己的 selectionPath 中
+type Manager struct {
+	dir           string
+	selectionPath string
+	mu            sync.RWMutex
+	indexes       map[string]*Index
+	selections    map[string]string
+}
+
+func NewManager(dir string, selectionPath string) *Manager {
+	m := &Manager{
+		dir:           dir,
+		selectionPath: selectionPath,
+		indexes:       make(map[string]*Index),
+		selections:    make(map[string]string),
+	}
+	if data, err := os.ReadFile(selectionPath); err == nil {
+		_ = json.Unmarshal(data, &m.selections)
+	}
+	return m
+}
+
+func (m *Manager) IndexPath(name string) string {
+	return filepath.Join(m.dir, name+indexExt)
+}
+
+// List 列出目录下所有可用的知识库
+func (m *Manager) List() []string {
+	files, err := filepath.Glob(filepath.Join(m.dir, "*"+indexExt))
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(f), indexExt))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get 加载并缓存知识库索引
+func (m *Manager) Get(name string) (*Index, error) {
+	m.mu.RLock()
+	idx, ok := m.indexes[name]
+	m.mu.RUnlock()
+	if ok {
+		return idx, nil
+	}
+	idx, err := LoadIndex(m.IndexPath(name))
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.indexes[name] = idx
+	m.mu.Unlock()
+	return idx, nil
+}
+
+// Save 保存新生成的索引并替换缓存
+func (m *Manager) Save(idx *Index) error {
+	if !validName(idx.Name) {
+		return errors.New("invalid knowledge base name: " + idx.Name)
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	if err := idx.Save(m.IndexPath(idx.Name)); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.indexes[idx.Name] = idx
+	m.mu.Unlock()
+	return nil
+}
+
+// Selected 返回会话群当前使用的知识库, 未选择时为空
+func (m *Manager) Selected(chatId string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.selections[chatId]
+}
+
+// Select 为会话群选择知识库, name 为空表示关闭
+func (m *Manager) Select(chatId string, name string) error {
+	if name != "" {
+		if !validName(name) {
+			return errors.New("invalid knowledge base name: " + name)
+		}
+		if _, err := os.Stat(m.IndexPath(name)); err != nil {
+			return errors.New("knowledge base not found: " + name)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name == "" {
+		delete(m.selections, chatId)
+	} else {
+		m.selections[chatId] = name
+	}
+	data, err := json.Marshal(m.selections)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.selectionPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(m.selectionPath, data, 0644)
+}
+
+// validName 知识库名称会用作文件名, 不允许包含路径
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) &&
+		!strings.Contains(name, "..")
+}
@@ -0,0 +1,67 @@
+package knowledge
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManagerSelectionsPerApp(t *testing.T) {
+	kbDir := t.TempDir()
+	dataDir := t.TempDir()
+	sales := filepath.Join(dataDir, "sales", "knowledge_selections.json")
+	support := filepath.Join(dataDir, "support", "knowledge_selections.json")
+
+	shared := NewManager(kbDir, "")
+	for _, name := range []string{"handbook", "faq"} {
+		if err := shared.Save(&Index{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 两个应用共用索引目录, 同一个会话群各自选择不同的知识库
+	a := NewManager(kbDir, sales)
+	b := NewManager(kbDir, support)
+	if err := a.Select("oc_1", "handbook"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Select("oc_1", "faq"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Select("oc_2", "handbook"); err != nil {
+		t.Fatal(err)
+	}
+
+	a = NewManager(kbDir, sales)
+	b = NewManager(kbDir, support)
+	tests := []struct {
+		manager *Manager
+		chatId  string
+		want    string
+	}{
+		{a, "oc_1", "handbook"},
+		{a, "oc_2", ""},
+		{b, "oc_1", "faq"},
+		{b, "oc_2", "handbook"},
+	}
+	for _, tt := range tests {
+		if got := tt.manager.Selected(tt.chatId); got != tt.want {
+			t.Errorf("%s: Selected(%s) = %q, want %q",
+				tt.manager.selectionPath, tt.chatId, got, tt.want)
+		}
+	}
+	if got := a.List(); len(got) != 2 || got[0] != "faq" || got[1] != "handbook" {
+		t.Errorf("List() = %v, want [faq handbook]", got)
+	}
+}
+
+func TestManagerSelectInvalid(t *testing.T) {
+	m := NewManager(t.TempDir(), filepath.Join(t.TempDir(), "selections.json"))
+	for _, name := range []string{"missing", "../etc", `a\b`} {
+		if err := m.Select("oc_1", name); err == nil {
+			t.Errorf("Select(%q) should fail", name)
+		}
+	}
+	if err := m.Select("oc_1", ""); err != nil {
+		t.Errorf("clearing the selection should succeed: %v", err)
+	}
+}
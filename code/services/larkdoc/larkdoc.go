@@ -0,0 +1,216 @@
+package larkdoc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"start-feishubot/initialization"
+
+	larkdocx "github.com/larksuite/oapi-sdk-go/v3/service/docx/v1"
+	larkwiki "github.com/larksuite/oapi-sdk-go/v3/service/wiki/v2"
+)
+
+type LinkKind string
+
+const (
+	KindDocx LinkKind = "docx"
+	KindWiki LinkKind = "wiki"
+)
+
+// ErrPermissionDenied 机器人没有文档的阅读权限
+var ErrPermissionDenied = errors.New("no permission to read the document")
+
+// ErrUnsupported 链接指向的不是新版文档, 例如表格或多维表格
+var ErrUnsupported = errors.New("only docx documents are supported")
+
+// 无权限或文档不存在时的错误码
+var permissionCodes = map[int]bool{
+	1770002:  true, // docx not found
+	1770032:  true, // docx forbidden
+	131005:   true, // wiki node not found
+	131006:   true, // wiki permission denied
+	99991672: true, // app scope not granted
+}
+
+var linkRegex = regexp.MustCompile(
+	`https?://[\w.-]+\.(?:feishu\.cn|larksuite\.com|larkoffice\.com)/(docx|wiki)/([A-Za-z0-9]+)`)
+
+type Link struct {
+	Kind  LinkKind
+	Token string
+	Url   string
+}
+
+type Doc struct {
+	Title    string
+	Url      string
+	Markdown string
+}
+
+// ParseLinks 提取消息中的飞书文档和知识库链接, 重复的链接只保留一个
+func ParseLinks(text string) []Link {
+	var links []Link
+	seen := make(map[string]bool)
+	for _, match := range linkRegex.FindAllStringSubmatch(text, -1) {
+		if seen[match[2]] {
+			continue
+		}
+		seen[match[2]] = true
+		links = append(links, Link{
+			Kind:  LinkKind(match[1]),
+			Token: match[2],
+			Url:   match[0],
+		})
+	}
+	return links
+}
+
+// Fetch 以应用身份读取文档, 知识库链接先解析出对应的文档
+func Fetch(ctx context.Context, link Link) (*Doc, error) {
+	documentId := link.Token
+	title := ""
+	if link.Kind == KindWiki {
+		node, err := getWikiNode(ctx, link.Token)
+		if err != nil {
+			return nil, err
+		}
+		if node.ObjType == nil || *node.ObjType != "docx" {
+			return nil, ErrUnsupported
+		}
+		documentId = *node.ObjToken
+		if node.Title != nil {
+			title = *node.Title
+		}
+	}
+
+	blocks, err := listBlocks(ctx, documentId)
+	if err != nil {
+		return nil, err
+	}
+	markdown, pageTitle := blocksToMarkdown(blocks)
+	if title == "" {
+		title = pageTitle
+	}
+	return &Doc{Title: title, Url: link.Url, Markdown: markdown}, nil
+}
+
+func getWikiNode(ctx context.Context, token string) (*larkwiki.Node, error) {
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Wiki.Space.GetNode(ctx,
+		larkwiki.NewGetNodeSpaceReqBuilder().Token(token).Build())
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success() {
+		return nil, codeError(resp.Code, resp.Msg)
+	}
+	if resp.Data == nil || resp.Data.Node == nil || resp.Data.Node.ObjToken == nil {
+		return nil, fmt.Errorf("wiki node %s not found", token)
+	}
+	return resp.Data.Node, nil
+}
+
+func listBlocks(ctx context.Context, documentId string) ([]*larkdocx.Block, error) {
+	client := initialization.GetLarkClient(ctx)
+	var blocks []*larkdocx.Block
+	pageToken := ""
+	for {
+		builder := larkdocx.NewListDocumentBlockReqBuilder().
+			DocumentId(documentId).
+			PageSize(500)
+		if pageToken != "" {
+			builder.PageToken(pageToken)
+		}
+		resp, err := client.Docx.DocumentBlock.List(ctx, builder.Build())
+		if err != nil {
+			return nil, err
+		}
+		if !resp.Success() {
+			return nil, codeError(resp.Code, resp.Msg)
+		}
+		blocks = append(blocks, resp.Data.Items...)
+		if resp.Data.HasMore == nil || !*resp.Data.HasMore ||
+			resp.Data.PageToken == nil {
+			break
+		}
+		pageToken = *resp.Data.PageToken
+	}
+	return blocks, nil
+}
+
+func codeError(code int, msg string) error {
+	if permissionCodes[code] {
+		return fmt.Errorf("%w: %d %s", ErrPermissionDenied, code, msg)
+	}
+	return fmt.Errorf("feishu api error: %d %s", code, msg)
+}
+
+// blocksToMarkdown 将文档块按顺序转换为 Markdown, 同时返回文档标题
+func blocksToMarkdown(blocks []*larkdocx.Block) (string, string) {
+	var sb strings.Builder
+	title := ""
+	ordered := 0
+	for _, b := range blocks {
+		if b.BlockType == nil {
+			continue
+		}
+		if *b.BlockType != 13 {
+			ordered = 0
+		}
+		switch *b.BlockType {
+		case 1:
+			title = textOf(b.Page)
+			sb.WriteString("# " + title + "\n\n")
+		case 2:
+			if text := textOf(b.Text); text != "" {
+				sb.WriteString(text + "\n\n")
+			}
+		case 3, 4, 5, 6, 7, 8, 9, 10, 11:
+			level := *b.BlockType - 1
+			if level > 6 {
+				level = 6
+			}
+			heading := []*larkdocx.Text{b.Heading1, b.Heading2, b.Heading3,
+				b.Heading4, b.Heading5, b.Heading6, b.Heading7, b.Heading8,
+				b.Heading9}[*b.BlockType-3]
+			sb.WriteString(strings.Repeat("#", level) + " " + textOf(heading) + "\n\n")
+		case 12:
+			sb.WriteString("- " + textOf(b.Bullet) + "\n")
+		case 13:
+			ordered++
+			sb.WriteString(fmt.Sprintf("%d. %s\n", ordered, textOf(b.Ordered)))
+		case 14:
+			sb.WriteString("```\n" + textOf(b.Code) + "\n```\n\n")
+		case 15:
+			sb.WriteString("> " + textOf(b.Quote) + "\n\n")
+		case 17:
+			sb.WriteString("- [ ] " + textOf(b.Todo) + "\n")
+		case 22:
+			sb.WriteString("---\n\n")
+		case 27:
+			sb.WriteString("[image]\n\n")
+		}
+	}
+	return strings.TrimSpace(sb.String()), title
+}
+
+func textOf(text *larkdocx.Text) string {
+	if text == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, e := range text.Elements {
+		switch {
+		case e.TextRun != nil && e.TextRun.Content != nil:
+			sb.WriteString(*e.TextRun.Content)
+		case e.MentionDoc != nil && e.MentionDoc.Title != nil:
+			sb.WriteString(*e.MentionDoc.Title)
+		case e.Equation != nil && e.Equation.Content != nil:
+			sb.WriteString(*e.Equation.Content)
+		}
+	}
+	return sb.String()
+}
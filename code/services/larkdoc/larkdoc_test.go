@@ -0,0 +1,106 @@
+package larkdoc
+
+import (
+	"errors"
+	"testing"
+
+	larkdocx "github.com/larksuite/oapi-sdk-go/v3/service/docx/v1"
+)
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Link
+	}{
+		{"docx", "summarize https://abc.feishu.cn/docx/Doc123 please",
+			[]Link{{KindDocx, "Doc123", "https://abc.feishu.cn/docx/Doc123"}}},
+		{"wiki on lark", "see https://team.larksuite.com/wiki/Wiki9?from=x",
+			[]Link{{KindWiki, "Wiki9", "https://team.larksuite.com/wiki/Wiki9"}}},
+		{"duplicates and several links",
+			"https://a.feishu.cn/docx/One https://a.feishu.cn/docx/One http://b.larkoffice.com/wiki/Two",
+			[]Link{{KindDocx, "One", "https://a.feishu.cn/docx/One"},
+				{KindWiki, "Two", "http://b.larkoffice.com/wiki/Two"}}},
+		{"unsupported kinds and hosts",
+			"https://a.feishu.cn/sheets/S1 https://example.com/docx/X1 https://feishu.cn.evil.com/docx/X2", nil},
+		{"no links", "hello", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseLinks(tt.text)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseLinks() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("link %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func text(parts ...string) *larkdocx.Text {
+	t := &larkdocx.Text{}
+	for _, p := range parts {
+		content := p
+		t.Elements = append(t.Elements, &larkdocx.TextElement{
+			TextRun: &larkdocx.TextRun{Content: &content}})
+	}
+	return t
+}
+
+func block(blockType int, set func(b *larkdocx.Block)) *larkdocx.Block {
+	b := &larkdocx.Block{BlockType: &blockType}
+	if set != nil {
+		set(b)
+	}
+	return b
+}
+
+func TestBlocksToMarkdown(t *testing.T) {
+	mention := "Other doc"
+	blocks := []*larkdocx.Block{
+		block(1, func(b *larkdocx.Block) { b.Page = text("Weekly") }),
+		block(3, func(b *larkdocx.Block) { b.Heading1 = text("Goals") }),
+		block(2, func(b *larkdocx.Block) {
+			b.Text = text("Ship ", "v2")
+			b.Text.Elements = append(b.Text.Elements, &larkdocx.TextElement{
+				MentionDoc: &larkdocx.MentionDoc{Title: &mention}})
+		}),
+		block(2, func(b *larkdocx.Block) { b.Text = text() }),
+		block(13, func(b *larkdocx.Block) { b.Ordered = text("first") }),
+		block(13, func(b *larkdocx.Block) { b.Ordered = text("second") }),
+		block(12, func(b *larkdocx.Block) { b.Bullet = text("note") }),
+		block(13, func(b *larkdocx.Block) { b.Ordered = text("restart") }),
+		block(11, func(b *larkdocx.Block) { b.Heading9 = text("Deep") }),
+		block(14, func(b *larkdocx.Block) { b.Code = text("go test") }),
+		block(15, func(b *larkdocx.Block) { b.Quote = text("quoted") }),
+		block(17, func(b *larkdocx.Block) { b.Todo = text("todo") }),
+		block(22, nil),
+		block(27, nil),
+		block(999, nil),
+		{},
+	}
+	markdown, title := blocksToMarkdown(blocks)
+	want := "# Weekly\n\n## Goals\n\nShip v2Other doc\n\n1. first\n2. second\n- note\n1. restart\n" +
+		"###### Deep\n\n```\ngo test\n```\n\n> quoted\n\n- [ ] todo\n---\n\n[image]"
+	if markdown != want {
+		t.Errorf("blocksToMarkdown() =\n%s\nwant\n%s", markdown, want)
+	}
+	if title != "Weekly" {
+		t.Errorf("title = %q, want Weekly", title)
+	}
+	if markdown, title := blocksToMarkdown(nil); markdown != "" || title != "" {
+		t.Errorf("blocksToMarkdown(nil) = %q, %q", markdown, title)
+	}
+}
+
+func TestCodeError(t *testing.T) {
+	if err := codeError(1770032, "forbidden"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("codeError(1770032) = %v, want ErrPermissionDenied", err)
+	}
+	if err := codeError(500, "internal"); errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("codeError(500) = %v, should not be a permission error", err)
+	}
+}
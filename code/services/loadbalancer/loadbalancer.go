@@ -20,11 +20,7 @@ type LoadBalancer struct {
 
 func NewLoadBalancer(keys []string) *LoadBalancer {
 	lb := &LoadBalancer{}
-	for _, key := range keys {
-		lb.apis = append(lb.apis, &API{Key: key})
-	}
-	//SetAvailabilityForAll true
-	lb.SetAvailabilityForAll(true)
+	lb.SetKeys(keys)
 	return lb
 }
 
@@ -38,6 +34,9 @@ func (lb *LoadBalancer) GetAPI() *API {
 			availableAPIs = append(availableAPIs, api)
 		}
 	}
+	if len(lb.apis) == 0 {
+		return nil
+	}
 	if len(availableAPIs) == 0 {
 		//随机复活一个
 		fmt.Printf("No available API, revive one randomly\n")
@@ -87,6 +86,36 @@ func (lb *LoadBalancer) RegisterAPI(key string) {
 	lb.apis = append(lb.apis, &API{Key: key})
 }
 
+// SetKeys 整体替换 key 列表, 保留仍在使用的 key 的调用次数和可用状态
+func (lb *LoadBalancer) SetKeys(keys []string) {
+	existing := make(map[string]*API)
+	lb.mu.RLock()
+	for _, api := range lb.apis {
+		existing[api.Key] = api
+	}
+	lb.mu.RUnlock()
+
+	apis := make([]*API, 0, len(keys))
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		// 重复的 key 只保留一个
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if api, ok := existing[key]; ok {
+			apis = append(apis, api)
+			delete(existing, key)
+			continue
+		}
+		apis = append(apis, &API{Key: key, Available: true})
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.apis = apis
+}
+
 func (lb *LoadBalancer) SetAvailabilityForAll(available bool) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
@@ -0,0 +1,29 @@
+package loadbalancer
+
+import "testing"
+
+func TestSetKeys(t *testing.T) {
+	lb := NewLoadBalancer([]string{"sk-a", "sk-b"})
+	lb.SetAvailability("sk-b", false)
+	lb.GetAPI()
+
+	lb.SetKeys([]string{"sk-b", "sk-c", "sk-c"})
+	apis := lb.GetAPIs()
+	if len(apis) != 2 || apis[0].Key != "sk-b" || apis[1].Key != "sk-c" {
+		t.Fatalf("keys after SetKeys = %v", apis)
+	}
+	if apis[0].Available {
+		t.Errorf("sk-b should stay unavailable after the swap")
+	}
+	if !apis[1].Available {
+		t.Errorf("new key sk-c should be available")
+	}
+	if api := lb.GetAPI(); api == nil || api.Key != "sk-c" {
+		t.Errorf("GetAPI() = %v, want sk-c", api)
+	}
+
+	lb.SetKeys(nil)
+	if api := lb.GetAPI(); api != nil {
+		t.Errorf("GetAPI() without keys = %v, want nil", api)
+	}
+}
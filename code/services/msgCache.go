@@ -13,10 +13,12 @@ type MsgCacheInterface interface {
 	IfProcessed(msgId string) bool
 	TagProcessed(msgId string)
 	Clear(userId string) bool
+	TagEngaged(rootId string)
+	IfEngaged(rootId string) bool
+	SetTranscript(msgId string, text string)
+	GetTranscript(msgId string) (string, bool)
 }
 
-var msgService *MsgService
-
 func (u MsgService) IfProcessed(msgId string) bool {
 	_, found := u.cache.Get(msgId)
 	return found
@@ -25,14 +27,34 @@ func (u MsgService) TagProcessed(msgId string) {
 	u.cache.Set(msgId, true, time.Minute*30)
 }
 
+// TagEngaged 记录机器人已参与的话题, 与会话缓存一样保留 12 小时
+func (u MsgService) TagEngaged(rootId string) {
+	u.cache.Set("engaged:"+rootId, true, time.Hour*12)
+}
+
+func (u MsgService) IfEngaged(rootId string) bool {
+	_, found := u.cache.Get("engaged:" + rootId)
+	return found
+}
+
+// SetTranscript 缓存语音消息的转写结果, 话题中再次引用同一条语音时不重复转写
+func (u MsgService) SetTranscript(msgId string, text string) {
+	u.cache.Set("transcript:"+msgId, text, time.Hour*12)
+}
+
+func (u MsgService) GetTranscript(msgId string) (string, bool) {
+	text, found := u.cache.Get("transcript:" + msgId)
+	if !found {
+		return "", false
+	}
+	return text.(string), true
+}
+
 func (u MsgService) Clear(userId string) bool {
 	u.cache.Delete(userId)
 	return true
 }
 
-func GetMsgCache() MsgCacheInterface {
-	if msgService == nil {
-		msgService = &MsgService{cache: cache.New(30*time.Minute, 30*time.Minute)}
-	}
-	return msgService
+func NewMsgCache() MsgCacheInterface {
+	return &MsgService{cache: cache.New(30*time.Minute, 30*time.Minute)}
 }
@@ -6,30 +6,78 @@ import (
 	"io"
 	"mime/multipart"
 	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"start-feishubot/utils/audio"
 )
 
 type AudioToTextRequestBody struct {
-	File           string `json:"file"`
+	File string `json:"file"`
+	// Data 不为空时直接上传内存中的音频, FileName 决定接口识别的格式
+	Data           []byte `json:"-"`
+	FileName       string `json:"-"`
 	Model          string `json:"model"`
 	ResponseFormat string `json:"response_format"`
+	// Language ISO-639-1 语言代码, 为空时自动识别
+	Language string `json:"language,omitempty"`
+	// Prompt 提示转写风格或延续上一段的内容
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// TranscribeOptions 语音转写的可选参数
+type TranscribeOptions struct {
+	Language string
+	Prompt   string
+	// ChunkSeconds 长录音每段的最大时长, 为 0 时使用 maxTranscribeSeconds
+	ChunkSeconds int
 }
 
 type AudioToTextResponseBody struct {
 	Text string `json:"text"`
+	// 以下字段只在 response_format 为 verbose_json 时返回
+	Language string              `json:"language,omitempty"`
+	Duration float64             `json:"duration,omitempty"`
+	Segments []TranscriptSegment `json:"segments,omitempty"`
+}
+
+// TranscriptSegment 带时间戳的一句转写结果, Start 和 End 为秒数
+type TranscriptSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Transcription 带时间戳的完整转写结果
+type Transcription struct {
+	Text     string
+	Language string
+	Duration float64
+	Segments []TranscriptSegment
 }
 
 func audioMultipartForm(request AudioToTextRequestBody, w *multipart.Writer) error {
-	f, err := os.Open(request.File)
-	if err != nil {
-		return fmt.Errorf("opening audio file: %w", err)
+	var file io.Reader
+	fileName := request.FileName
+	if request.Data != nil {
+		file = bytes.NewReader(request.Data)
+	} else {
+		f, err := os.Open(request.File)
+		if err != nil {
+			return fmt.Errorf("opening audio file: %w", err)
+		}
+		defer f.Close()
+		file = f
+		fileName = f.Name()
 	}
 
-	fw, err := w.CreateFormFile("file", f.Name())
+	fw, err := w.CreateFormFile("file", fileName)
 	if err != nil {
 		return fmt.Errorf("creating form file: %w", err)
 	}
 
-	if _, err = io.Copy(fw, f); err != nil {
+	if _, err = io.Copy(fw, file); err != nil {
 		return fmt.Errorf("reading from opened audio file: %w", err)
 	}
 
@@ -42,17 +90,143 @@ func audioMultipartForm(request AudioToTextRequestBody, w *multipart.Writer) err
 	if _, err = io.Copy(fw, modelName); err != nil {
 		return fmt.Errorf("writing model name: %w", err)
 	}
+	for field, value := range map[string]string{
+		"response_format": request.ResponseFormat,
+		"language":        request.Language,
+		"prompt":          request.Prompt,
+	} {
+		if value == "" {
+			continue
+		}
+		if err = w.WriteField(field, value); err != nil {
+			return fmt.Errorf("writing %s: %w", field, err)
+		}
+	}
 	w.Close()
 
 	return nil
 }
 
 func (gpt *ChatGPT) AudioToText(audio string) (string, error) {
-	requestBody := AudioToTextRequestBody{
+	return gpt.audioToText(AudioToTextRequestBody{
 		File:           audio,
 		Model:          "whisper-1",
-		ResponseFormat: "text",
+		ResponseFormat: "json",
+	})
+}
+
+// AudioDataToText 转写内存中的音频, fileName 的扩展名需要是接口支持的格式
+func (gpt *ChatGPT) AudioDataToText(data []byte, fileName string,
+	options TranscribeOptions) (string, error) {
+	return gpt.audioToText(AudioToTextRequestBody{
+		Data:           data,
+		FileName:       fileName,
+		Model:          "whisper-1",
+		ResponseFormat: "json",
+		Language:       options.Language,
+		Prompt:         options.Prompt,
+	})
+}
+
+// maxTranscribeSeconds 每段的默认最大时长, 16kHz 的 WAV 约 19MB, 低于接口 25MB 的限制
+const maxTranscribeSeconds = 600
+
+// transcriptContext 作为下一段提示词的上一段末尾的字符数
+const transcriptContext = 200
+
+// TranscribePCM 转写 16 位单声道 PCM. 超过单次限制的长录音在停顿处切分,
+// 逐段转写后拼接, 每段以上一段的末尾作为提示词保持连贯
+func (gpt *ChatGPT) TranscribePCM(pcm []int16, sampleRate int,
+	options TranscribeOptions) (string, error) {
+	chunkSeconds := options.ChunkSeconds
+	if chunkSeconds <= 0 {
+		chunkSeconds = maxTranscribeSeconds
 	}
+	parts, err := audio.WavParts(audio.Resample(pcm, sampleRate, audio.SpeechSampleRate),
+		audio.SpeechSampleRate, chunkSeconds*audio.SpeechSampleRate)
+	if err != nil {
+		return "", err
+	}
+	transcription, err := gpt.TranscribeParts(parts, options)
+	if err != nil {
+		return "", err
+	}
+	return transcription.Text, nil
+}
+
+// TranscribeParts 逐段转写切分后的录音, 各段的时间戳加上该段的起始时间,
+// 合并为一份完整的带时间戳的转写结果
+func (gpt *ChatGPT) TranscribeParts(parts []audio.Part,
+	options TranscribeOptions) (*Transcription, error) {
+	result := &Transcription{}
+	var texts []string
+	prompt := options.Prompt
+	for i, part := range parts {
+		body := &AudioToTextResponseBody{}
+		err := gpt.sendRequestWithBodyType(gpt.ApiUrl+"/v1/audio/transcriptions",
+			"POST", formVoiceDataBody, AudioToTextRequestBody{
+				Data:           part.Data,
+				FileName:       fmt.Sprintf("part%d%s", i+1, part.Ext),
+				Model:          "whisper-1",
+				ResponseFormat: "verbose_json",
+				Language:       options.Language,
+				Prompt:         prompt,
+			}, body)
+		if err != nil {
+			return nil, fmt.Errorf("transcribing part %d of %d: %w", i+1,
+				len(parts), err)
+		}
+		if result.Language == "" {
+			result.Language = body.Language
+		}
+		if end := part.Offset + body.Duration; end > result.Duration {
+			result.Duration = end
+		}
+		for _, segment := range body.Segments {
+			segment.Start += part.Offset
+			segment.End += part.Offset
+			segment.Text = strings.TrimSpace(segment.Text)
+			if segment.Text != "" {
+				result.Segments = append(result.Segments, segment)
+			}
+		}
+		text := strings.TrimSpace(body.Text)
+		if text == "" {
+			continue
+		}
+		texts = append(texts, text)
+		runes := []rune(text)
+		if len(runes) > transcriptContext {
+			runes = runes[len(runes)-transcriptContext:]
+		}
+		prompt = string(runes)
+	}
+	result.Text = joinTranscripts(texts)
+	return result, nil
+}
+
+// joinTranscripts 拼接各段的转写结果, 中日韩文字之间不加空格
+func joinTranscripts(texts []string) string {
+	var b strings.Builder
+	for i, text := range texts {
+		if i > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(b.String())
+			next, _ := utf8.DecodeRuneInString(text)
+			if !isCJK(prev) && !isCJK(next) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana,
+		unicode.Hangul) || (r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+func (gpt *ChatGPT) audioToText(requestBody AudioToTextRequestBody) (string, error) {
 	audioToTextResponseBody := &AudioToTextResponseBody{}
 	err := gpt.sendRequestWithBodyType(gpt.ApiUrl+"/v1/audio/transcriptions",
 		"POST", formVoiceDataBody, requestBody, audioToTextResponseBody)
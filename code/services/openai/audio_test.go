@@ -0,0 +1,136 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"start-feishubot/services/loadbalancer"
+	"start-feishubot/utils/audio"
+)
+
+type transcribeRequest struct {
+	fileName string
+	size     int64
+	language string
+	prompt   string
+}
+
+func TestTranscribePCM(t *testing.T) {
+	var requests []transcribeRequest
+	replies := []string{"第一段", "第二段", "and the end."}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			http.NotFound(w, r)
+			return
+		}
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("missing file: %v", err)
+		}
+		requests = append(requests, transcribeRequest{
+			fileName: header.Filename,
+			size:     header.Size,
+			language: r.FormValue("language"),
+			prompt:   r.FormValue("prompt"),
+		})
+		json.NewEncoder(w).Encode(AudioToTextResponseBody{Text: replies[len(requests)-1]})
+	}))
+	t.Cleanup(server.Close)
+	gpt := &ChatGPT{
+		Lb:       loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+		ApiUrl:   server.URL,
+		Platform: OpenAI,
+	}
+
+	// 48kHz 下 25 秒的静音, 每段 10 秒
+	pcm := make([]int16, 25*48000)
+	text, err := gpt.TranscribePCM(pcm, 48000, TranscribeOptions{
+		Language: "zh", ChunkSeconds: 10})
+	if err != nil {
+		t.Fatalf("TranscribePCM() error = %v", err)
+	}
+	if text != "第一段第二段and the end." {
+		t.Errorf("TranscribePCM() = %q", text)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(requests))
+	}
+	for i, req := range requests {
+		// 16kHz 16 位, 每段不超过 10 秒加 WAV 头
+		if req.size > 10*16000*2+44 {
+			t.Errorf("part %d is %d bytes, too large", i+1, req.size)
+		}
+		if req.language != "zh" {
+			t.Errorf("part %d language = %q, want zh", i+1, req.language)
+		}
+	}
+	if requests[0].prompt != "" || requests[1].prompt != "第一段" ||
+		requests[2].prompt != "第二段" {
+		t.Errorf("prompts should carry the previous part, got %q, %q, %q",
+			requests[0].prompt, requests[1].prompt, requests[2].prompt)
+	}
+	if requests[0].fileName != "part1.wav" {
+		t.Errorf("file name = %q, want part1.wav", requests[0].fileName)
+	}
+}
+
+func TestJoinTranscripts(t *testing.T) {
+	tests := []struct {
+		texts []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"hello", "world"}, "hello world"},
+		{[]string{"你好，", "世界"}, "你好，世界"},
+		{[]string{"会议开始", "OK let's go"}, "会议开始OK let's go"},
+		{[]string{"OK", "开始"}, "OK开始"},
+	}
+	for _, tt := range tests {
+		if got := joinTranscripts(tt.texts); got != tt.want {
+			t.Errorf("joinTranscripts(%q) = %q, want %q", tt.texts, got, tt.want)
+		}
+	}
+}
+
+func TestTranscribeParts(t *testing.T) {
+	var formats []string
+	replies := []AudioToTextResponseBody{
+		{Text: " Good morning. ", Language: "english", Duration: 600,
+			Segments: []TranscriptSegment{{0, 2.5, " Good morning."}, {590, 600, " "}}},
+		{Text: "Let's start.", Language: "english", Duration: 30.5,
+			Segments: []TranscriptSegment{{1, 3, "Let's start."}}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		formats = append(formats, r.FormValue("response_format"))
+		json.NewEncoder(w).Encode(replies[len(formats)-1])
+	}))
+	t.Cleanup(server.Close)
+	gpt := &ChatGPT{
+		Lb:       loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+		ApiUrl:   server.URL,
+		Platform: OpenAI,
+	}
+
+	got, err := gpt.TranscribeParts([]audio.Part{
+		{Data: []byte("a"), Ext: ".m4a"},
+		{Data: []byte("b"), Ext: ".m4a", Offset: 600},
+	}, TranscribeOptions{})
+	if err != nil {
+		t.Fatalf("TranscribeParts() error = %v", err)
+	}
+	want := &Transcription{
+		Text:     "Good morning. Let's start.",
+		Language: "english",
+		Duration: 630.5,
+		Segments: []TranscriptSegment{{0, 2.5, "Good morning."}, {601, 603, "Let's start."}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TranscribeParts() = %+v, want %+v", got, want)
+	}
+	if len(formats) != 2 || formats[0] != "verbose_json" {
+		t.Errorf("response formats = %q, want verbose_json", formats)
+	}
+}
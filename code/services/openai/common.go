@@ -32,6 +32,8 @@ type AzureConfig struct {
 	DeploymentName string
 	ApiVersion     string
 	ApiToken       string
+	// EmbeddingDeploymentName 向量模型的部署, 与对话模型的部署不同
+	EmbeddingDeploymentName string
 }
 
 type ChatGPT struct {
@@ -41,6 +43,9 @@ type ChatGPT struct {
 	HttpProxy   string
 	Platform    PlatForm
 	AzureConfig AzureConfig
+	VisionModel string
+	// Model 对话使用的模型, 为空时使用默认模型
+	Model string
 }
 type requestBodyType int
 
@@ -82,7 +87,7 @@ func (gpt *ChatGPT) doAPIRequestWithRetry(url, method string,
 	case formPictureDataBody:
 		formBody := &bytes.Buffer{}
 		writer = multipart.NewWriter(formBody)
-		err = pictureMultipartForm(requestBody.(ImageVariantRequestBody), writer)
+		err = pictureMultipartForm(requestBody.(pictureFormRequest), writer)
 		if err != nil {
 			return err
 		}
@@ -156,8 +161,10 @@ func (gpt *ChatGPT) doAPIRequestWithRetry(url, method string,
 		return err
 	}
 
-	err = json.Unmarshal(body, responseBody)
-	if err != nil {
+	// 语音等二进制响应直接返回原始数据
+	if raw, ok := responseBody.(*[]byte); ok {
+		*raw = body
+	} else if err = json.Unmarshal(body, responseBody); err != nil {
 		return err
 	}
 
@@ -192,14 +199,15 @@ func (gpt *ChatGPT) sendRequestWithBodyType(link, method string,
 	return err
 }
 
-func NewChatGPT(config initialization.Config) *ChatGPT {
-	var lb *loadbalancer.LoadBalancer
+func apiKeys(config initialization.Config) []string {
 	if config.AzureOn {
-		keys := []string{config.AzureOpenaiToken}
-		lb = loadbalancer.NewLoadBalancer(keys)
-	} else {
-		lb = loadbalancer.NewLoadBalancer(config.OpenaiApiKeys)
+		return []string{config.AzureOpenaiToken}
 	}
+	return config.OpenaiApiKeys
+}
+
+func NewChatGPT(config initialization.Config) *ChatGPT {
+	lb := loadbalancer.NewLoadBalancer(apiKeys(config))
 	platform := OpenAI
 
 	if config.AzureOn {
@@ -207,21 +215,49 @@ func NewChatGPT(config initialization.Config) *ChatGPT {
 	}
 
 	return &ChatGPT{
-		Lb:        lb,
-		ApiKey:    config.OpenaiApiKeys,
-		ApiUrl:    config.OpenaiApiUrl,
-		HttpProxy: config.HttpProxy,
-		Platform:  platform,
+		Lb:          lb,
+		ApiKey:      config.OpenaiApiKeys,
+		ApiUrl:      config.OpenaiApiUrl,
+		HttpProxy:   config.HttpProxy,
+		Platform:    platform,
+		VisionModel: config.VisionModel,
 		AzureConfig: AzureConfig{
 			BaseURL:        AzureApiUrlV1,
 			ResourceName:   config.AzureResourceName,
 			DeploymentName: config.AzureDeploymentName,
 			ApiVersion:     config.AzureApiVersion,
 			ApiToken:       config.AzureOpenaiToken,
+			// 知识库使用单独的向量模型部署
+			EmbeddingDeploymentName: config.AzureEmbeddingDeployment,
 		},
 	}
 }
 
+// Reloaded 按新配置创建客户端, 沿用原有的负载均衡器, 保留 key 的可用状态
+func (gpt *ChatGPT) Reloaded(config initialization.Config) *ChatGPT {
+	gpt.Lb.SetKeys(apiKeys(config))
+	next := NewChatGPT(config)
+	next.Lb = gpt.Lb
+	return next
+}
+
+// WithModel 使用指定对话模型的客户端, 与原客户端共用 key 和负载均衡器
+func (gpt *ChatGPT) WithModel(model string) *ChatGPT {
+	if model == "" || model == gpt.Model {
+		return gpt
+	}
+	next := *gpt
+	next.Model = model
+	return &next
+}
+
+func (gpt *ChatGPT) chatModel() string {
+	if gpt.Model == "" {
+		return engine
+	}
+	return gpt.Model
+}
+
 func (gpt *ChatGPT) FullUrl(suffix string) string {
 	var url string
 	switch gpt.Platform {
@@ -0,0 +1,106 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	embeddingEngine = "text-embedding-ada-002"
+	// 单次请求最多携带的文本数量
+	maxEmbeddingBatch = 64
+)
+
+type EmbeddingRequestBody struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingResponseBody struct {
+	Object string `json:"object"`
+	Data   []struct {
+		Object    string    `json:"object"`
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Model string                 `json:"model"`
+	Usage map[string]interface{} `json:"usage"`
+}
+
+// ErrNoEmbeddingDeployment Azure 下未配置向量模型的部署
+var ErrNoEmbeddingDeployment = errors.New(
+	"AZURE_EMBEDDING_DEPLOYMENT_NAME is required to compute embeddings on Azure")
+
+// SupportsEmbeddings 是否可以计算向量, Azure 下需要单独的向量模型部署
+func (gpt *ChatGPT) SupportsEmbeddings() bool {
+	return gpt.Platform != Azure || gpt.AzureConfig.EmbeddingDeploymentName != ""
+}
+
+// embeddingUrl Azure 下使用向量模型的部署, 而不是对话模型的部署
+func (gpt *ChatGPT) embeddingUrl() (string, error) {
+	if gpt.Platform != Azure {
+		return gpt.FullUrl("embeddings"), nil
+	}
+	if !gpt.SupportsEmbeddings() {
+		return "", ErrNoEmbeddingDeployment
+	}
+	azure := *gpt
+	azure.AzureConfig.DeploymentName = gpt.AzureConfig.EmbeddingDeploymentName
+	return azure.FullUrl("embeddings"), nil
+}
+
+// Embeddings 计算文本向量, 返回结果与输入一一对应
+func (gpt *ChatGPT) Embeddings(input []string) ([][]float64, error) {
+	result := make([][]float64, 0, len(input))
+	for start := 0; start < len(input); start += maxEmbeddingBatch {
+		end := start + maxEmbeddingBatch
+		if end > len(input) {
+			end = len(input)
+		}
+		vectors, err := gpt.embeddingBatch(input[start:end])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, vectors...)
+	}
+	return result, nil
+}
+
+// Embedding 计算单条文本的向量
+func (gpt *ChatGPT) Embedding(text string) ([]float64, error) {
+	vectors, err := gpt.Embeddings([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (gpt *ChatGPT) embeddingBatch(input []string) ([][]float64, error) {
+	requestBody := EmbeddingRequestBody{
+		Model: embeddingEngine,
+		Input: input,
+	}
+	embeddingResponseBody := &EmbeddingResponseBody{}
+	url, err := gpt.embeddingUrl()
+	if err != nil {
+		return nil, err
+	}
+	err = gpt.sendRequestWithBodyType(url, "POST", jsonBody,
+		requestBody, embeddingResponseBody)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddingResponseBody.Data) != len(input) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d",
+			len(input), len(embeddingResponseBody.Data))
+	}
+
+	vectors := make([][]float64, len(input))
+	for _, data := range embeddingResponseBody.Data {
+		if data.Index < 0 || data.Index >= len(input) {
+			return nil, fmt.Errorf("invalid embedding index %d", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	return vectors, nil
+}
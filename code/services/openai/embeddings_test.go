@@ -0,0 +1,50 @@
+package openai
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEmbeddingUrl(t *testing.T) {
+	azure := AzureConfig{
+		BaseURL:        AzureApiUrlV1,
+		ResourceName:   "res",
+		DeploymentName: "gpt-35",
+		ApiVersion:     "2023-05-15",
+	}
+	withEmbedding := azure
+	withEmbedding.EmbeddingDeploymentName = "ada"
+	tests := []struct {
+		name    string
+		gpt     ChatGPT
+		want    string
+		wantErr error
+	}{
+		{"openai", ChatGPT{Platform: OpenAI, ApiUrl: "https://api.openai.com"},
+			"https://api.openai.com/v1/embeddings", nil},
+		{"azure embedding deployment", ChatGPT{Platform: Azure, AzureConfig: withEmbedding},
+			"https://res.openai.azure.com/openai/deployments/ada/embeddings?api-version=2023-05-15", nil},
+		{"azure without embedding deployment", ChatGPT{Platform: Azure, AzureConfig: azure},
+			"", ErrNoEmbeddingDeployment},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.gpt.embeddingUrl()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("embeddingUrl() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("embeddingUrl() = %s, want %s", got, tt.want)
+			}
+			if tt.gpt.SupportsEmbeddings() != (tt.wantErr == nil) {
+				t.Errorf("SupportsEmbeddings() = %v", tt.gpt.SupportsEmbeddings())
+			}
+		})
+	}
+	// 不修改对话使用的部署
+	gpt := ChatGPT{Platform: Azure, AzureConfig: withEmbedding}
+	gpt.embeddingUrl()
+	if gpt.AzureConfig.DeploymentName != "gpt-35" {
+		t.Errorf("chat deployment changed to %s", gpt.AzureConfig.DeploymentName)
+	}
+}
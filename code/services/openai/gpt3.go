@@ -1,6 +1,8 @@
 package openai
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"strings"
 
@@ -23,6 +25,9 @@ var AIModeMap = map[string]AIMode{
 	"创意": Creativity,
 }
 
+// ChatModels 未配置 CHAT_MODELS 时, 设置卡片中可选的对话模型
+var ChatModels = []string{engine, "gpt-4o-mini", "gpt-4o", "gpt-4-turbo"}
+
 var AIModeStrs = []string{
 	"清新",
 	"温暖",
@@ -33,11 +38,133 @@ var AIModeStrs = []string{
 const (
 	maxTokens = 2000
 	engine    = "gpt-3.5-turbo"
+	// 未配置 VISION_MODEL 时使用的图片理解模型
+	defaultVisionModel = "gpt-4o"
 )
 
 type Messages struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Parts 多模态内容, 不为空时代替 Content 发送; Content 保留其中的文字部分
+	Parts []ContentPart `json:"-"`
+	// ToolCalls 模型请求调用的工具, 仅出现在 assistant 消息中
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallId 工具执行结果对应的调用, 仅出现在 tool 消息中
+	ToolCallId string `json:"tool_call_id,omitempty"`
+}
+
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageUrl *ImageUrl `json:"image_url,omitempty"`
+}
+
+type ImageUrl struct {
+	Url    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// 每张图片大约占用的 token 数, 用于限制上下文长度
+const imageTokenLength = 765
+
+// NewImageMessage 生成带图片的用户消息, imageUrls 可以是 data URL
+func NewImageMessage(text string, imageUrls ...string) Messages {
+	msg := Messages{Role: "user", Content: text}
+	if text != "" {
+		msg.Parts = append(msg.Parts, ContentPart{Type: "text", Text: text})
+	}
+	for _, url := range imageUrls {
+		msg.Parts = append(msg.Parts, ContentPart{
+			Type:     "image_url",
+			ImageUrl: &ImageUrl{Url: url},
+		})
+	}
+	return msg
+}
+
+// HasImage 消息中是否带有图片
+func (msg Messages) HasImage() bool {
+	for _, part := range msg.Parts {
+		if part.ImageUrl != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type messagesJson struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallId string          `json:"tool_call_id,omitempty"`
+}
+
+// MarshalJSON 有多模态内容时 content 为数组, 否则为字符串
+func (msg Messages) MarshalJSON() ([]byte, error) {
+	var content interface{} = msg.Content
+	if len(msg.Parts) > 0 {
+		content = msg.Parts
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(messagesJson{
+		Role:       msg.Role,
+		Content:    raw,
+		ToolCalls:  msg.ToolCalls,
+		ToolCallId: msg.ToolCallId,
+	})
+}
+
+// UnmarshalJSON 兼容字符串、null 和数组形式的 content
+func (msg *Messages) UnmarshalJSON(data []byte) error {
+	var raw messagesJson
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*msg = Messages{Role: raw.Role, ToolCalls: raw.ToolCalls, ToolCallId: raw.ToolCallId}
+	content := bytes.TrimSpace(raw.Content)
+	if len(content) == 0 || bytes.Equal(content, []byte("null")) {
+		return nil
+	}
+	if content[0] != '[' {
+		return json.Unmarshal(content, &msg.Content)
+	}
+	if err := json.Unmarshal(content, &msg.Parts); err != nil {
+		return err
+	}
+	var texts []string
+	for _, part := range msg.Parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	msg.Content = strings.Join(texts, "\n")
+	return nil
+}
+
+type ToolCall struct {
+	Id       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Tool 提供给模型调用的工具, Parameters 为 JSON schema
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters"`
 }
 
 // ChatGPTResponseBody 请求体
@@ -65,24 +192,65 @@ type ChatGPTRequestBody struct {
 	TopP             int        `json:"top_p"`
 	FrequencyPenalty int        `json:"frequency_penalty"`
 	PresencePenalty  int        `json:"presence_penalty"`
+	Tools            []Tool     `json:"tools,omitempty"`
+	// ToolChoice 为 {"type":"function","function":{"name":...}} 时强制调用指定工具
+	ToolChoice     interface{}     `json:"tool_choice,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type ResponseFormat struct {
+	Type string `json:"type"`
 }
 
 func (msg *Messages) CalculateTokenLength() int {
 	text := strings.TrimSpace(msg.Content)
-	return tokenizer.MustCalToken(text)
+	length := tokenizer.MustCalToken(text)
+	for _, part := range msg.Parts {
+		if part.ImageUrl != nil {
+			length += imageTokenLength
+		}
+	}
+	return length
 }
 
 func (gpt *ChatGPT) Completions(msg []Messages, aiMode AIMode) (resp Messages,
 	err error) {
-	requestBody := ChatGPTRequestBody{
-		Model:            engine,
+	return gpt.CompletionsWithTools(msg, aiMode, nil)
+}
+
+// CompletionsWithTools 带上可用的工具, 返回的消息中可能包含 ToolCalls
+func (gpt *ChatGPT) CompletionsWithTools(msg []Messages, aiMode AIMode,
+	tools []Tool) (resp Messages, err error) {
+	return gpt.chatCompletions(ChatGPTRequestBody{
+		Model:            gpt.chatModel(),
 		Messages:         msg,
 		MaxTokens:        maxTokens,
 		Temperature:      aiMode,
 		TopP:             1,
 		FrequencyPenalty: 0,
 		PresencePenalty:  0,
+		Tools:            tools,
+	})
+}
+
+// VisionCompletions 消息中带有图片时, 使用支持图片输入的模型
+func (gpt *ChatGPT) VisionCompletions(msg []Messages, aiMode AIMode) (resp Messages,
+	err error) {
+	model := gpt.VisionModel
+	if model == "" {
+		model = defaultVisionModel
 	}
+	return gpt.chatCompletions(ChatGPTRequestBody{
+		Model:       model,
+		Messages:    msg,
+		MaxTokens:   maxTokens,
+		Temperature: aiMode,
+		TopP:        1,
+	})
+}
+
+func (gpt *ChatGPT) chatCompletions(requestBody ChatGPTRequestBody) (resp Messages,
+	err error) {
 	gptResponseBody := &ChatGPTResponseBody{}
 	url := gpt.FullUrl("chat/completions")
 	//fmt.Println(url)
@@ -0,0 +1,123 @@
+package openai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImageOptions 图片生成的设置, 字段为空时使用接口的默认值
+type ImageOptions struct {
+	Model   string
+	Size    string
+	Quality string
+	Style   string
+	N       int
+}
+
+// ImageModelSpec 模型支持的参数取值, 第一个值为默认值
+type ImageModelSpec struct {
+	Sizes     []string
+	Qualities []string
+	Styles    []string
+	MaxN      int
+}
+
+const (
+	ImageModelDallE2   = "dall-e-2"
+	ImageModelDallE3   = "dall-e-3"
+	ImageModelGptImage = "gpt-image-1"
+)
+
+// ImageModels 内置模型的参数限制, 其他兼容模型不做校验
+var ImageModels = map[string]ImageModelSpec{
+	ImageModelDallE2: {
+		Sizes:     []string{"256x256", "512x512", "1024x1024"},
+		Qualities: []string{"standard"},
+		MaxN:      10,
+	},
+	ImageModelDallE3: {
+		Sizes:     []string{"1024x1024", "1792x1024", "1024x1792"},
+		Qualities: []string{"standard", "hd"},
+		Styles:    []string{"vivid", "natural"},
+		MaxN:      1,
+	},
+	ImageModelGptImage: {
+		Sizes:     []string{"1024x1024", "1536x1024", "1024x1536", "auto"},
+		Qualities: []string{"auto", "low", "medium", "high"},
+		MaxN:      10,
+	},
+}
+
+// ImageModelNames 设置卡片中展示的模型
+var ImageModelNames = []string{ImageModelDallE2, ImageModelDallE3, ImageModelGptImage}
+
+// DefaultImageOptions 与之前的默认行为一致: DALL·E 2, 256x256, 一张
+func DefaultImageOptions() ImageOptions {
+	return ImageOptions{Model: ImageModelDallE2, Size: "256x256", N: 1}
+}
+
+// Validate 校验模型是否支持这组参数
+func (o ImageOptions) Validate() error {
+	if o.N < 1 {
+		return fmt.Errorf("the number of images must be at least 1")
+	}
+	spec, ok := ImageModels[o.modelName()]
+	if !ok {
+		return nil
+	}
+	if o.Size != "" && !containsString(spec.Sizes, o.Size) {
+		return fmt.Errorf("%s does not support size %s, choose one of %s",
+			o.modelName(), o.Size, strings.Join(spec.Sizes, ", "))
+	}
+	if o.Quality != "" && !containsString(spec.Qualities, o.Quality) {
+		return fmt.Errorf("%s does not support quality %s", o.modelName(), o.Quality)
+	}
+	if o.Style != "" && !containsString(spec.Styles, o.Style) {
+		if len(spec.Styles) == 0 {
+			return fmt.Errorf("%s does not support styles", o.modelName())
+		}
+		return fmt.Errorf("%s does not support style %s", o.modelName(), o.Style)
+	}
+	if o.N > spec.MaxN {
+		return fmt.Errorf("%s can generate at most %d images at a time",
+			o.modelName(), spec.MaxN)
+	}
+	return nil
+}
+
+// WithModel 切换模型, 并把新模型不支持的参数重置为默认值
+func (o ImageOptions) WithModel(model string) ImageOptions {
+	o.Model = model
+	spec, ok := ImageModels[o.modelName()]
+	if !ok {
+		return o
+	}
+	if !containsString(spec.Sizes, o.Size) {
+		o.Size = spec.Sizes[0]
+	}
+	if o.Quality != "" && !containsString(spec.Qualities, o.Quality) {
+		o.Quality = ""
+	}
+	if o.Style != "" && !containsString(spec.Styles, o.Style) {
+		o.Style = ""
+	}
+	if o.N > spec.MaxN {
+		o.N = spec.MaxN
+	}
+	return o
+}
+
+// VariationSize 变体和编辑接口只支持 DALL·E 2 的尺寸
+func (o ImageOptions) VariationSize() string {
+	if containsString(ImageModels[ImageModelDallE2].Sizes, o.Size) {
+		return o.Size
+	}
+	return "1024x1024"
+}
+
+func (o ImageOptions) modelName() string {
+	if o.Model == "" {
+		return ImageModelDallE2
+	}
+	return o.Model
+}
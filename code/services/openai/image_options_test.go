@@ -0,0 +1,49 @@
+package openai
+
+import "testing"
+
+func TestImageOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ImageOptions
+		wantErr bool
+	}{
+		{"default", DefaultImageOptions(), false},
+		{"dall-e-2 non-square", ImageOptions{Model: ImageModelDallE2, Size: "1792x1024", N: 1}, true},
+		{"dall-e-2 quality", ImageOptions{Model: ImageModelDallE2, Size: "512x512", Quality: "hd", N: 1}, true},
+		{"dall-e-2 many", ImageOptions{Model: ImageModelDallE2, Size: "512x512", N: 4}, false},
+		{"dall-e-3 wide hd", ImageOptions{Model: ImageModelDallE3, Size: "1792x1024", Quality: "hd", Style: "natural", N: 1}, false},
+		{"dall-e-3 many", ImageOptions{Model: ImageModelDallE3, Size: "1024x1024", N: 2}, true},
+		{"dall-e-3 small", ImageOptions{Model: ImageModelDallE3, Size: "256x256", N: 1}, true},
+		{"gpt-image style", ImageOptions{Model: ImageModelGptImage, Size: "1536x1024", Style: "vivid", N: 1}, true},
+		{"gpt-image auto", ImageOptions{Model: ImageModelGptImage, Size: "auto", Quality: "high", N: 2}, false},
+		{"compatible model", ImageOptions{Model: "flux-pro", Size: "800x600", Style: "anime", N: 1}, false},
+		{"no image", ImageOptions{Model: ImageModelDallE2, N: 0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImageOptionsWithModel(t *testing.T) {
+	options := ImageOptions{Model: ImageModelDallE2, Size: "512x512", N: 4}.
+		WithModel(ImageModelDallE3)
+	if options.Size != "1024x1024" || options.N != 1 {
+		t.Errorf("WithModel(dall-e-3) = %+v", options)
+	}
+	if err := options.Validate(); err != nil {
+		t.Errorf("WithModel() should return valid options: %v", err)
+	}
+	options = ImageOptions{Model: ImageModelDallE3, Size: "1792x1024", Quality: "hd",
+		Style: "vivid", N: 1}.WithModel(ImageModelGptImage)
+	if options.Style != "" || options.Quality != "" || options.Size != "1024x1024" {
+		t.Errorf("WithModel(gpt-image-1) = %+v", options)
+	}
+	if got := options.VariationSize(); got != "1024x1024" {
+		t.Errorf("VariationSize() = %s", got)
+	}
+}
@@ -0,0 +1,214 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// PictureFit 非正方形图片转换为正方形的方式
+type PictureFit string
+
+const (
+	// PictureFitCrop 居中裁剪
+	PictureFitCrop PictureFit = "crop"
+	// PictureFitPad 用透明像素补齐
+	PictureFitPad PictureFit = "pad"
+)
+
+// maxPictureBytes 图片接口对上传文件大小的限制
+const maxPictureBytes = 4 * 1024 * 1024
+
+// maxPicturePixels 解码前检查的像素数上限, 避免尺寸很大的小文件占用大量内存
+const maxPicturePixels = 25 * 1000 * 1000
+
+type PreprocessOptions struct {
+	Fit PictureFit
+	// Size 输出的最大边长, 更大的图片会被缩小, 为 0 时不缩放
+	Size int
+	// MaxBytes 编码后 PNG 的大小上限, 为 0 时使用 4MB
+	MaxBytes int
+}
+
+// PreprocessImage 把 JPEG/PNG/GIF/WebP 图片转换为图片接口需要的正方形 RGBA PNG.
+// 按 EXIF 方向旋转, 裁剪或补齐为正方形, 缩小到 Size, 并保证不超过 MaxBytes
+func PreprocessImage(data []byte, opts PreprocessOptions) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 ||
+		config.Width*config.Height > maxPicturePixels {
+		return nil, fmt.Errorf("image is %dx%d, at most %d pixels are supported",
+			config.Width, config.Height, maxPicturePixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = maxPictureBytes
+	}
+	img = applyOrientation(img, exifOrientation(data))
+	square := squareImage(img, opts.Fit)
+
+	side := square.Bounds().Dx()
+	if opts.Size > 0 && side > opts.Size {
+		side = opts.Size
+	}
+	for side > 0 {
+		out := square
+		if side != square.Bounds().Dx() {
+			out = resizeImage(square, side)
+		}
+		buf := &bytes.Buffer{}
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(buf, out); err != nil {
+			return nil, err
+		}
+		if buf.Len() <= opts.MaxBytes {
+			return buf.Bytes(), nil
+		}
+		// 超过大小限制时逐步缩小
+		side = side * 3 / 4
+	}
+	return nil, fmt.Errorf("image can not be compressed under %d bytes", opts.MaxBytes)
+}
+
+// squareImage 返回正方形的 RGBA 图片
+func squareImage(img image.Image, fit PictureFit) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if fit == PictureFitPad {
+		side := w
+		if h > side {
+			side = h
+		}
+		dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+		offset := image.Pt((side-w)/2, (side-h)/2)
+		draw.Draw(dst, b.Sub(b.Min).Add(offset), img, b.Min, draw.Src)
+		return dst
+	}
+	side := w
+	if h < side {
+		side = h
+	}
+	src := image.Pt(b.Min.X+(w-side)/2, b.Min.Y+(h-side)/2)
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, src, draw.Src)
+	return dst
+}
+
+func resizeImage(img *image.NRGBA, side int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// exifOrientation 读取 JPEG 中 EXIF 的方向标记, 没有时返回 1
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		// 图像数据开始, 之后没有 EXIF
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation 按 EXIF 方向把图片转正
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// 5-8 需要交换宽高
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,279 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func encodeTestImage(t *testing.T, format string, img image.Image) []byte {
+	buf := &bytes.Buffer{}
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(buf, img)
+	case "jpeg":
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 95})
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withExifOrientation 在 JPEG 的 SOI 之后插入只包含方向标记的 EXIF 段
+func withExifOrientation(data []byte, orientation uint16) []byte {
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("MM")
+	binary.Write(tiff, binary.BigEndian, uint16(42))
+	binary.Write(tiff, binary.BigEndian, uint32(8))
+	binary.Write(tiff, binary.BigEndian, uint16(1))
+	binary.Write(tiff, binary.BigEndian, uint16(0x0112))
+	binary.Write(tiff, binary.BigEndian, uint16(3))
+	binary.Write(tiff, binary.BigEndian, uint32(1))
+	binary.Write(tiff, binary.BigEndian, orientation)
+	binary.Write(tiff, binary.BigEndian, uint16(0))
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	length := len(segment) + 2
+	out = append(out, byte(length>>8), byte(length))
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// wideImage 左半边红色, 右半边蓝色
+func wideImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 0xff, A: 0xff}
+			if x >= w/2 {
+				c = color.NRGBA{B: 0xff, A: 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func noiseImage(side int) image.Image {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, side, side))
+	r.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+// hugePng 只包含 PNG 头部的图片, 声明的尺寸很大但数据很小
+func hugePng(t *testing.T, w, h int) []byte {
+	data := encodeTestImage(t, "png", image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	// IHDR 的宽高位于第 16-23 字节, 修改后重新计算 CRC
+	binary.BigEndian.PutUint32(data[16:], uint32(w))
+	binary.BigEndian.PutUint32(data[20:], uint32(h))
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func readTestFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPreprocessImage(t *testing.T) {
+	wide := encodeTestImage(t, "jpeg", wideImage(40, 20))
+	tests := []struct {
+		name     string
+		input    []byte
+		opts     PreprocessOptions
+		wantSide int
+		// check 检查输出图片的像素, 可以为空
+		check   func(t *testing.T, img image.Image)
+		wantErr bool
+	}{
+		{
+			name:     "jpeg file",
+			input:    readTestFile(t, "./test_file/photo.jpg"),
+			opts:     PreprocessOptions{Size: 32},
+			wantSide: 32,
+		},
+		{
+			name:     "png file keeps size",
+			input:    readTestFile(t, "./test_file/photo.png"),
+			opts:     PreprocessOptions{Size: 1024, Fit: PictureFitCrop},
+			wantSide: 40,
+		},
+		{
+			name:     "jpeg file with exif orientation",
+			input:    readTestFile(t, "./test_file/photo_rotated.jpg"),
+			opts:     PreprocessOptions{Fit: PictureFitPad},
+			wantSide: 60,
+			check: func(t *testing.T, img image.Image) {
+				// 旋转后 40x60 的内容居中, 左右两侧为透明
+				if _, _, _, a := img.At(5, 30).RGBA(); a != 0 {
+					t.Errorf("sides should be transparent after rotation")
+				}
+				if r, _, _, _ := img.At(30, 5).RGBA(); r < 0x8000 {
+					t.Errorf("top should be red after rotation")
+				}
+				if _, _, b, _ := img.At(30, 55).RGBA(); b < 0x8000 {
+					t.Errorf("bottom should be blue after rotation")
+				}
+			},
+		},
+		{
+			name:     "center crop",
+			input:    encodeTestImage(t, "png", wideImage(40, 20)),
+			opts:     PreprocessOptions{Fit: PictureFitCrop},
+			wantSide: 20,
+			check: func(t *testing.T, img image.Image) {
+				if r, _, b, _ := img.At(0, 10).RGBA(); r == 0 || b != 0 {
+					t.Errorf("left edge should be red after cropping")
+				}
+				if r, _, b, _ := img.At(19, 10).RGBA(); b == 0 || r != 0 {
+					t.Errorf("right edge should be blue after cropping")
+				}
+			},
+		},
+		{
+			name:     "pad with transparency",
+			input:    encodeTestImage(t, "png", wideImage(40, 20)),
+			opts:     PreprocessOptions{Fit: PictureFitPad},
+			wantSide: 40,
+			check: func(t *testing.T, img image.Image) {
+				if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+					t.Errorf("padding should be transparent")
+				}
+				if _, _, _, a := img.At(0, 20).RGBA(); a == 0 {
+					t.Errorf("image content should be centered")
+				}
+			},
+		},
+		{
+			name:     "gif",
+			input:    encodeTestImage(t, "gif", wideImage(30, 30)),
+			wantSide: 30,
+		},
+		{
+			name:     "exif rotated 90 degrees",
+			input:    withExifOrientation(wide, 6),
+			opts:     PreprocessOptions{Fit: PictureFitPad},
+			wantSide: 40,
+			check: func(t *testing.T, img image.Image) {
+				// 旋转后红色的左半边在上方
+				if r, _, _, _ := img.At(20, 2).RGBA(); r < 0x8000 {
+					t.Errorf("top should be red after rotation")
+				}
+				if _, _, b, _ := img.At(20, 37).RGBA(); b < 0x8000 {
+					t.Errorf("bottom should be blue after rotation")
+				}
+			},
+		},
+		{
+			name:     "compress under limit",
+			input:    encodeTestImage(t, "png", noiseImage(256)),
+			opts:     PreprocessOptions{MaxBytes: 64 * 1024},
+			wantSide: 192,
+		},
+		{
+			name:    "too many pixels",
+			input:   hugePng(t, 10000, 10000),
+			wantErr: true,
+		},
+		{
+			name:    "not an image",
+			input:   []byte("hello"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := PreprocessImage(tt.input, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PreprocessImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			maxBytes := tt.opts.MaxBytes
+			if maxBytes == 0 {
+				maxBytes = maxPictureBytes
+			}
+			if len(out) > maxBytes {
+				t.Errorf("output is %d bytes, limit %d", len(out), maxBytes)
+			}
+			img, err := png.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("output is not a png: %v", err)
+			}
+			b := img.Bounds()
+			if b.Dx() != b.Dy() || (tt.wantSide > 0 && b.Dx() > tt.wantSide) {
+				t.Errorf("output is %dx%d, want square at most %d", b.Dx(), b.Dy(), tt.wantSide)
+			}
+			if tt.wantSide > 0 && tt.opts.MaxBytes == 0 && b.Dx() != tt.wantSide {
+				t.Errorf("output side = %d, want %d", b.Dx(), tt.wantSide)
+			}
+			if tt.check != nil {
+				tt.check(t, img)
+			}
+		})
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	jpg := encodeTestImage(t, "jpeg", wideImage(8, 8))
+	tests := []struct {
+		name  string
+		input []byte
+		want  int
+	}{
+		{"no exif", jpg, 1},
+		{"rotated", withExifOrientation(jpg, 6), 6},
+		{"invalid value", withExifOrientation(jpg, 42), 1},
+		{"png", encodeTestImage(t, "png", wideImage(8, 8)), 1},
+		{"truncated", withExifOrientation(jpg, 3)[:20], 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.input); got != tt.want {
+				t.Errorf("exifOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientationFile(t *testing.T) {
+	data := readTestFile(t, "./test_file/photo_rotated.jpg")
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" {
+		t.Fatalf("format = %s, want jpeg", format)
+	}
+	orientation := exifOrientation(data)
+	if orientation != 6 {
+		t.Fatalf("exifOrientation() = %d, want 6", orientation)
+	}
+	b := applyOrientation(img, orientation).Bounds()
+	if b.Dx() != 40 || b.Dy() != 60 {
+		t.Errorf("rotated image is %dx%d, want 40x60", b.Dx(), b.Dy())
+	}
+}
@@ -0,0 +1,32 @@
+package openai
+
+import "strings"
+
+const imagePromptInstruction = "You rewrite short requests into detailed prompts for an image " +
+	"generation model. Describe the subject, setting, composition, lighting, colors and art " +
+	"style in one paragraph of at most 80 words. Keep everything the user asked for and do " +
+	"not add text to the picture unless asked. Reply with the prompt only."
+
+// OptimizeImagePrompt 让聊天模型把简短的描述扩写为详细的图片提示词;
+// translate 为 true 时提示词使用英文, 否则保持用户的语言
+func (gpt *ChatGPT) OptimizeImagePrompt(prompt string,
+	translate bool) (string, error) {
+	instruction := imagePromptInstruction
+	if translate {
+		instruction += " Always write the prompt in English, translating the request if needed."
+	} else {
+		instruction += " Write the prompt in the same language as the request."
+	}
+	resp, err := gpt.Completions([]Messages{
+		{Role: "system", Content: instruction},
+		{Role: "user", Content: prompt},
+	}, Balance)
+	if err != nil {
+		return "", err
+	}
+	optimized := strings.Trim(strings.TrimSpace(resp.Content), "\"")
+	if optimized == "" {
+		return prompt, nil
+	}
+	return optimized, nil
+}
@@ -0,0 +1,33 @@
+package openai
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOptimizeImagePrompt(t *testing.T) {
+	gpt, requests := newFakeChatGPT(t, []Messages{
+		{Role: "assistant", Content: "\"A fluffy orange cat sleeping on a windowsill, soft morning light\"\n"},
+		{Role: "assistant", Content: "  "},
+	})
+	got, err := gpt.OptimizeImagePrompt("一只猫", true)
+	if err != nil {
+		t.Fatalf("OptimizeImagePrompt() error = %v", err)
+	}
+	if got != "A fluffy orange cat sleeping on a windowsill, soft morning light" {
+		t.Errorf("OptimizeImagePrompt() = %q", got)
+	}
+	system := (*requests)[0].Messages[0]
+	if system.Role != "system" || !strings.Contains(system.Content, "in English") {
+		t.Errorf("system prompt should ask for English, got %q", system.Content)
+	}
+
+	// 模型没有返回内容时使用原始描述
+	got, err = gpt.OptimizeImagePrompt("a cat", false)
+	if err != nil || got != "a cat" {
+		t.Errorf("OptimizeImagePrompt() = %q, %v, want the original prompt", got, err)
+	}
+	if system := (*requests)[1].Messages[0]; strings.Contains(system.Content, "in English") {
+		t.Errorf("system prompt should keep the user's language, got %q", system.Content)
+	}
+}
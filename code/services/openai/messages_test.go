@@ -0,0 +1,48 @@
+package openai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMessagesJSON(t *testing.T) {
+	plain, err := json.Marshal(Messages{Role: "user", Content: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != `{"role":"user","content":"hi"}` {
+		t.Errorf("plain message = %s", plain)
+	}
+
+	image := NewImageMessage("what is this", "data:image/png;base64,AAAA")
+	data, err := json.Marshal(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"content":[{"type":"text","text":"what is this"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]`) {
+		t.Errorf("image message = %s", data)
+	}
+
+	var decoded Messages
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.HasImage() || decoded.Content != "what is this" {
+		t.Errorf("decoded image message = %+v", decoded)
+	}
+
+	// 旧会话中 content 为字符串, 工具调用的回复中 content 为 null
+	for raw, want := range map[string]string{
+		`{"role":"assistant","content":"hello"}`: "hello",
+		`{"role":"assistant","content":null,"tool_calls":[{"id":"1","type":"function","function":{"name":"f","arguments":"{}"}}]}`: "",
+	} {
+		var msg Messages
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatalf("Unmarshal(%s) error = %v", raw, err)
+		}
+		if msg.Content != want || msg.HasImage() {
+			t.Errorf("Unmarshal(%s) = %+v", raw, msg)
+		}
+	}
+}
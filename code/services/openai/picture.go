@@ -2,20 +2,27 @@ package openai
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"mime/multipart"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 type ImageGenerationRequestBody struct {
+	Model          string `json:"model,omitempty"`
 	Prompt         string `json:"prompt"`
 	N              int    `json:"n"`
 	Size           string `json:"size"`
-	ResponseFormat string `json:"response_format"`
+	Quality        string `json:"quality,omitempty"`
+	Style          string `json:"style,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
 }
 
 type ImageResponseBody struct {
@@ -26,7 +33,18 @@ type ImageResponseBody struct {
 }
 
 type ImageVariantRequestBody struct {
-	Image          string `json:"image"`
+	Image string `json:"image"`
+	// ImageData 内存中的 PNG, 设置时代替 Image 路径
+	ImageData      []byte `json:"-"`
+	N              int    `json:"n"`
+	Size           string `json:"size"`
+	ResponseFormat string `json:"response_format"`
+}
+
+type ImageEditRequestBody struct {
+	ImageData      []byte `json:"-"`
+	MaskData       []byte `json:"-"`
+	Prompt         string `json:"prompt"`
 	N              int    `json:"n"`
 	Size           string `json:"size"`
 	ResponseFormat string `json:"response_format"`
@@ -34,12 +52,28 @@ type ImageVariantRequestBody struct {
 
 func (gpt *ChatGPT) GenerateImage(prompt string, size string,
 	n int) ([]string, error) {
+	return gpt.GenerateImageWithOptions(prompt, ImageOptions{Size: size, N: n})
+}
+
+// GenerateImageWithOptions 按会话的图片设置生成图片, 返回 base64 编码的图片
+func (gpt *ChatGPT) GenerateImageWithOptions(prompt string,
+	options ImageOptions) ([]string, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
 	requestBody := ImageGenerationRequestBody{
+		Model:          options.Model,
 		Prompt:         prompt,
-		N:              n,
-		Size:           size,
+		N:              options.N,
+		Size:           options.Size,
+		Quality:        options.Quality,
+		Style:          options.Style,
 		ResponseFormat: "b64_json",
 	}
+	// gpt-image 系列固定返回 base64, 不接受 response_format
+	if strings.HasPrefix(options.Model, "gpt-image") {
+		requestBody.ResponseFormat = ""
+	}
 
 	imageResponseBody := &ImageResponseBody{}
 	err := gpt.sendRequestWithBodyType(gpt.ApiUrl+"/v1/images/generations",
@@ -53,6 +87,9 @@ func (gpt *ChatGPT) GenerateImage(prompt string, size string,
 	for _, data := range imageResponseBody.Data {
 		b64Pool = append(b64Pool, data.Base64Json)
 	}
+	if len(b64Pool) == 0 {
+		return nil, fmt.Errorf("no image returned")
+	}
 	return b64Pool, nil
 }
 
@@ -72,26 +109,44 @@ func (gpt *ChatGPT) GenerateOneImageWithDefaultSize(
 
 func (gpt *ChatGPT) GenerateImageVariation(images string,
 	size string, n int) ([]string, error) {
-	requestBody := ImageVariantRequestBody{
+	return gpt.pictureFormRequest("/v1/images/variations", ImageVariantRequestBody{
 		Image:          images,
 		N:              n,
 		Size:           size,
 		ResponseFormat: "b64_json",
-	}
+	})
+}
 
-	imageResponseBody := &ImageResponseBody{}
-	err := gpt.sendRequestWithBodyType(gpt.ApiUrl+"/v1/images/variations",
-		"POST", formPictureDataBody, requestBody, imageResponseBody)
+// GenerateImageVariationData 根据内存中的 PNG 生成变体
+func (gpt *ChatGPT) GenerateImageVariationData(image []byte,
+	size string, n int) ([]string, error) {
+	return gpt.pictureFormRequest("/v1/images/variations", ImageVariantRequestBody{
+		ImageData:      image,
+		N:              n,
+		Size:           size,
+		ResponseFormat: "b64_json",
+	})
+}
 
+// GenerateOneImageEditData 根据提示词修改内存中的 PNG 图片, mask 的透明区域为
+// 需要修改的部分; mask 为空时使用 image 自身的透明区域
+func (gpt *ChatGPT) GenerateOneImageEditData(image []byte, mask []byte,
+	prompt string, size string) (string, error) {
+	b64s, err := gpt.pictureFormRequest("/v1/images/edits", ImageEditRequestBody{
+		ImageData:      image,
+		MaskData:       mask,
+		Prompt:         prompt,
+		N:              1,
+		Size:           size,
+		ResponseFormat: "b64_json",
+	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
-	var b64Pool []string
-	for _, data := range imageResponseBody.Data {
-		b64Pool = append(b64Pool, data.Base64Json)
+	if len(b64s) == 0 {
+		return "", fmt.Errorf("no image returned")
 	}
-	return b64Pool, nil
+	return b64s[0], nil
 }
 
 func (gpt *ChatGPT) GenerateOneImageVariation(images string,
@@ -103,51 +158,116 @@ func (gpt *ChatGPT) GenerateOneImageVariation(images string,
 	return b64s[0], nil
 }
 
-func pictureMultipartForm(request ImageVariantRequestBody,
-	w *multipart.Writer) error {
-
-	f, err := os.Open(request.Image)
-	if err != nil {
-		return fmt.Errorf("opening audio file: %w", err)
-	}
-	fw, err := w.CreateFormFile("image", f.Name())
+func (gpt *ChatGPT) GenerateOneImageVariationData(image []byte,
+	size string) (string, error) {
+	b64s, err := gpt.GenerateImageVariationData(image, size, 1)
 	if err != nil {
-		return fmt.Errorf("creating form file: %w", err)
+		return "", err
 	}
-	if _, err = io.Copy(fw, f); err != nil {
-		return fmt.Errorf("reading from opened audio file: %w", err)
+	if len(b64s) == 0 {
+		return "", fmt.Errorf("no image returned")
 	}
+	return b64s[0], nil
+}
 
-	err = w.WriteField("size", request.Size)
-	if err != nil {
-		return fmt.Errorf("writing size: %w", err)
-	}
+// pictureFormRequest 以表单提交变体或修改请求, 返回 base64 编码的图片
+func (gpt *ChatGPT) pictureFormRequest(path string,
+	requestBody pictureFormRequest) ([]string, error) {
+	imageResponseBody := &ImageResponseBody{}
+	err := gpt.sendRequestWithBodyType(gpt.ApiUrl+path,
+		"POST", formPictureDataBody, requestBody, imageResponseBody)
 
-	err = w.WriteField("n", fmt.Sprintf("%d", request.N))
 	if err != nil {
-		return fmt.Errorf("writing n: %w", err)
+		return nil, err
 	}
 
-	err = w.WriteField("response_format", request.ResponseFormat)
-	if err != nil {
-		return fmt.Errorf("writing response_format: %w", err)
+	var b64Pool []string
+	for _, data := range imageResponseBody.Data {
+		b64Pool = append(b64Pool, data.Base64Json)
 	}
+	return b64Pool, nil
+}
+
+// formFile 表单中的文件字段, data 不为空时直接写入内存中的内容
+type formFile struct {
+	field string
+	path  string
+	data  []byte
+}
 
-	//err = w.WriteField("user", "user123456")
+// formField 表单中的文本字段, 值为空时不写入
+type formField struct {
+	name  string
+	value string
+}
+
+// pictureFormRequest 以 multipart 表单提交的图片请求
+type pictureFormRequest interface {
+	formData() ([]formFile, []formField)
+}
 
-	//fw, err = w.CreateFormField("model")
-	//if err != nil {
-	//	return fmt.Errorf("creating form field: %w", err)
-	//}
-	//modelName := bytes.NewReader([]byte(request.Model))
-	//if _, err = io.Copy(fw, modelName); err != nil {
-	//	return fmt.Errorf("writing model name: %w", err)
-	//}
+func (request ImageVariantRequestBody) formData() ([]formFile, []formField) {
+	return []formFile{{field: "image", path: request.Image, data: request.ImageData}},
+		[]formField{
+			{name: "size", value: request.Size},
+			{name: "n", value: fmt.Sprintf("%d", request.N)},
+			{name: "response_format", value: request.ResponseFormat},
+		}
+}
 
-	//fmt.Printf("w.FormDataContentType(): %s ", w.FormDataContentType())
+func (request ImageEditRequestBody) formData() ([]formFile, []formField) {
+	files := []formFile{{field: "image", data: request.ImageData}}
+	if request.MaskData != nil {
+		files = append(files, formFile{field: "mask", data: request.MaskData})
+	}
+	return files, []formField{
+		{name: "prompt", value: request.Prompt},
+		{name: "size", value: request.Size},
+		{name: "n", value: fmt.Sprintf("%d", request.N)},
+		{name: "response_format", value: request.ResponseFormat},
+	}
+}
 
-	w.Close()
+func pictureMultipartForm(request pictureFormRequest,
+	w *multipart.Writer) error {
+	files, fields := request.formData()
+	for _, file := range files {
+		if err := writeFormFile(w, file); err != nil {
+			return err
+		}
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if err := w.WriteField(field.name, field.value); err != nil {
+			return fmt.Errorf("writing %s: %w", field.name, err)
+		}
+	}
+	return nil
+}
 
+func writeFormFile(w *multipart.Writer, file formFile) error {
+	if file.data != nil {
+		fw, err := w.CreateFormFile(file.field, file.field+".png")
+		if err != nil {
+			return fmt.Errorf("creating form file: %w", err)
+		}
+		_, err = fw.Write(file.data)
+		return err
+	}
+	f, err := os.Open(file.path)
+	if err != nil {
+		return fmt.Errorf("opening %s file: %w", file.field, err)
+	}
+	defer f.Close()
+	fw, err := w.CreateFormFile(file.field, filepath.Base(f.Name()))
+	if err != nil {
+		return fmt.Errorf("creating form file: %w", err)
+	}
+	if _, err = io.Copy(fw, f); err != nil {
+		return fmt.Errorf("reading from opened %s file: %w", file.field, err)
+	}
 	return nil
 }
 
@@ -295,3 +415,36 @@ func GetImageCompressionType(path string) (string, error) {
 	// 返回压缩类型
 	return format, nil
 }
+
+// CreateMaskData 根据 PNG 图片的透明区域生成蒙版.
+// 图片没有透明区域时, 整张图片都作为可修改区域, 返回 false
+func CreateMaskData(data []byte) ([]byte, bool, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("image must be valid png, got error: %v", err)
+	}
+
+	bounds := img.Bounds()
+	mask := image.NewNRGBA(bounds)
+	transparent := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			// 半透明以上的像素视为需要修改
+			if a < 0x8000 {
+				transparent = true
+				continue
+			}
+			mask.Set(x, y, color.NRGBA{A: 0xff})
+		}
+	}
+	if !transparent {
+		mask = image.NewNRGBA(bounds)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, mask); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), transparent, nil
+}
@@ -0,0 +1,87 @@
+package openai
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"testing"
+)
+
+func TestCreateMaskData(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	// 左上角透明
+	img.Set(0, 0, color.NRGBA{})
+
+	data, transparent, err := CreateMaskData(encodeTestImage(t, "png", img))
+	if err != nil {
+		t.Fatalf("CreateMaskData() error = %v", err)
+	}
+	if !transparent {
+		t.Fatalf("CreateMaskData() should detect the transparent area")
+	}
+	mask, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := mask.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("mask at transparent pixel has alpha %d, want 0", a)
+	}
+	if _, _, _, a := mask.At(1, 1).RGBA(); a != 0xffff {
+		t.Errorf("mask at opaque pixel has alpha %d, want opaque", a)
+	}
+
+	opaque := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			opaque.Set(x, y, blue)
+		}
+	}
+	if _, transparent, err := CreateMaskData(encodeTestImage(t, "png", opaque)); err != nil || transparent {
+		t.Errorf("CreateMaskData() of an opaque image = %v, %v, want false", transparent, err)
+	}
+	if _, _, err := CreateMaskData([]byte("hello")); err == nil {
+		t.Errorf("CreateMaskData() of invalid data should fail")
+	}
+}
+
+func TestPictureMultipartForm(t *testing.T) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	err := pictureMultipartForm(ImageEditRequestBody{
+		ImageData: encodeTestImage(t, "png", image.NewNRGBA(image.Rect(0, 0, 2, 2))), Prompt: "a beach", N: 1, Size: "256x256",
+		ResponseFormat: "b64_json",
+	}, w)
+	if err != nil {
+		t.Fatalf("pictureMultipartForm() error = %v", err)
+	}
+	w.Close()
+
+	r := multipart.NewReader(body, w.Boundary())
+	got := map[string]string{}
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		got[part.FormName()] = string(data)
+	}
+	if got["prompt"] != "a beach" || got["n"] != "1" || got["image"] == "" {
+		t.Errorf("form = %v", got)
+	}
+	if _, ok := got["mask"]; ok {
+		t.Errorf("mask should be omitted when empty")
+	}
+}
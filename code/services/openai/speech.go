@@ -0,0 +1,80 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SpeechVoices 语音合成接口支持的声音
+var SpeechVoices = []string{"alloy", "echo", "fable", "onyx", "nova", "shimmer"}
+
+// maxSpeechInput 语音合成接口单次输入的最大字符数
+const maxSpeechInput = 4096
+
+type SpeechOptions struct {
+	Model string
+	Voice string
+	// Speed 语速, 0.25 到 4.0, 为 0 时使用 1.0
+	Speed float64
+}
+
+type SpeechRequestBody struct {
+	Model          string  `json:"model"`
+	Input          string  `json:"input"`
+	Voice          string  `json:"voice"`
+	ResponseFormat string  `json:"response_format"`
+	Speed          float64 `json:"speed,omitempty"`
+}
+
+func (o SpeechOptions) Validate() error {
+	if o.Voice == "" {
+		return errors.New("speech voice is empty")
+	}
+	if o.Speed != 0 && (o.Speed < 0.25 || o.Speed > 4) {
+		return fmt.Errorf("speech speed %v is out of range 0.25-4.0", o.Speed)
+	}
+	return nil
+}
+
+// speechInput 去掉多余的空白, 超过长度限制时截断
+func speechInput(text string) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if len(runes) > maxSpeechInput {
+		runes = runes[:maxSpeechInput]
+	}
+	return string(runes)
+}
+
+// TextToSpeech 合成语音, 返回 Ogg Opus 格式的音频
+func (gpt *ChatGPT) TextToSpeech(text string, options SpeechOptions) ([]byte, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	input := speechInput(text)
+	if input == "" {
+		return nil, errors.New("nothing to speak")
+	}
+	model := options.Model
+	if model == "" {
+		model = "tts-1"
+	}
+	requestBody := SpeechRequestBody{
+		Model:          model,
+		Input:          input,
+		Voice:          options.Voice,
+		ResponseFormat: "opus",
+		Speed:          options.Speed,
+	}
+	var audio []byte
+	err := gpt.sendRequestWithBodyType(gpt.ApiUrl+"/v1/audio/speech",
+		"POST", jsonBody, requestBody, &audio)
+	if err != nil {
+		return nil, err
+	}
+	if len(audio) == 0 {
+		return nil, errors.New("speech api returned no audio")
+	}
+	return audio, nil
+}
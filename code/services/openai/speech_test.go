@@ -0,0 +1,58 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"start-feishubot/services/loadbalancer"
+)
+
+func TestTextToSpeech(t *testing.T) {
+	var got SpeechRequestBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/speech" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "audio/ogg")
+		w.Write([]byte("OggS fake audio"))
+	}))
+	t.Cleanup(server.Close)
+	gpt := &ChatGPT{
+		Lb:       loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+		ApiUrl:   server.URL,
+		Platform: OpenAI,
+	}
+
+	audio, err := gpt.TextToSpeech("  "+strings.Repeat("长", maxSpeechInput+10),
+		SpeechOptions{Voice: "nova", Speed: 1.25})
+	if err != nil {
+		t.Fatalf("TextToSpeech() error = %v", err)
+	}
+	if string(audio) != "OggS fake audio" {
+		t.Errorf("TextToSpeech() = %q, want the raw response", audio)
+	}
+	if got.Model != "tts-1" || got.Voice != "nova" || got.Speed != 1.25 ||
+		got.ResponseFormat != "opus" {
+		t.Errorf("request = %+v", got)
+	}
+	if n := len([]rune(got.Input)); n != maxSpeechInput {
+		t.Errorf("input length = %d, want %d", n, maxSpeechInput)
+	}
+
+	invalid := []SpeechOptions{{}, {Voice: "nova", Speed: 5}}
+	for _, options := range invalid {
+		if _, err := gpt.TextToSpeech("hello", options); err == nil {
+			t.Errorf("TextToSpeech(%+v) should fail", options)
+		}
+	}
+	if _, err := gpt.TextToSpeech(" \n", SpeechOptions{Voice: "nova"}); err == nil {
+		t.Errorf("TextToSpeech() with empty text should fail")
+	}
+}
@@ -0,0 +1,135 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type StructuredMode int
+
+const (
+	// StructuredAuto OpenAI 使用函数调用, Azure 使用提示词
+	StructuredAuto StructuredMode = iota
+	// StructuredFunction 强制模型调用一个参数为目标结构的函数
+	StructuredFunction
+	// StructuredJSONObject 使用 response_format: json_object
+	StructuredJSONObject
+	// StructuredPrompt 只在系统提示中给出 schema, 适用于不支持以上两种方式的接口
+	StructuredPrompt
+)
+
+type StructuredOptions struct {
+	// Name 输出结构的名称, 用作函数名
+	Name        string
+	Description string
+	Mode        StructuredMode
+	// MaxRetries 校验失败后带着错误信息重试的次数
+	MaxRetries int
+}
+
+const defaultStructuredRetries = 2
+
+// StructuredCompletions 要求模型按照 out 的结构回复 JSON, 校验后解码到 out 中.
+// out 必须是结构体指针, schema 由 SchemaOf 生成
+func (gpt *ChatGPT) StructuredCompletions(msg []Messages, aiMode AIMode,
+	out interface{}, opts StructuredOptions) error {
+	schema, err := SchemaOf(out)
+	if err != nil {
+		return err
+	}
+	if schema.Type != "object" {
+		return errors.New("structured output must be a struct")
+	}
+	if opts.Name == "" {
+		opts.Name = "output"
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultStructuredRetries
+	}
+	if opts.Mode == StructuredAuto {
+		opts.Mode = StructuredFunction
+		if gpt.Platform == Azure {
+			opts.Mode = StructuredPrompt
+		}
+	}
+
+	schemaJson, _ := json.Marshal(schema)
+	msg = append([]Messages{}, msg...)
+	requestBody := ChatGPTRequestBody{
+		Model:       gpt.chatModel(),
+		MaxTokens:   maxTokens,
+		Temperature: aiMode,
+		TopP:        1,
+	}
+	switch opts.Mode {
+	case StructuredFunction:
+		requestBody.Tools = []Tool{{
+			Type: "function",
+			Function: FunctionDefinition{
+				Name:        opts.Name,
+				Description: opts.Description,
+				Parameters:  schema,
+			},
+		}}
+		requestBody.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": opts.Name},
+		}
+	case StructuredJSONObject:
+		requestBody.ResponseFormat = &ResponseFormat{Type: "json_object"}
+		msg = append(msg, structuredPrompt(schemaJson))
+	default:
+		msg = append(msg, structuredPrompt(schemaJson))
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+		requestBody.Messages = msg
+		resp, err := gpt.chatCompletions(requestBody)
+		if err != nil {
+			return err
+		}
+		raw := structuredContent(resp)
+		lastErr = decodeStructured(raw, schema, out)
+		if lastErr == nil {
+			return nil
+		}
+		// 把错误交给模型修正, 函数调用的结果以普通文本的形式回传
+		msg = append(msg,
+			Messages{Role: "assistant", Content: raw},
+			Messages{Role: "user", Content: fmt.Sprintf(
+				"The JSON is invalid: %v. Reply again with the corrected JSON only.", lastErr)})
+	}
+	return fmt.Errorf("invalid structured output after %d attempts: %w",
+		opts.MaxRetries+1, lastErr)
+}
+
+func structuredPrompt(schemaJson []byte) Messages {
+	return Messages{Role: "system", Content: "Reply with a single JSON object only, " +
+		"without markdown, that matches this JSON schema: " + string(schemaJson)}
+}
+
+// structuredContent 取出函数调用的参数或回复的正文
+func structuredContent(resp Messages) string {
+	if len(resp.ToolCalls) > 0 {
+		return resp.ToolCalls[0].Function.Arguments
+	}
+	content := strings.TrimSpace(resp.Content)
+	content = strings.TrimPrefix(content, "```json")
+	return strings.Trim(content, "`\n ")
+}
+
+func decodeStructured(raw string, schema *Schema, out interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("not valid JSON: %v", err)
+	}
+	if err := schema.Validate(value); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(raw), out)
+}
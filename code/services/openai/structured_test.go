@@ -0,0 +1,157 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"start-feishubot/services/loadbalancer"
+)
+
+type testEvent struct {
+	Title    string   `json:"title" desc:"short title"`
+	Priority string   `json:"priority" enum:"low,high"`
+	Count    int      `json:"count"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// newFakeChatGPT 启动一个依次返回 replies 的假接口, 并记录收到的请求
+func newFakeChatGPT(t *testing.T, replies []Messages) (*ChatGPT,
+	*[]ChatGPTRequestBody) {
+	var requests []ChatGPTRequestBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		var body ChatGPTRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		requests = append(requests, body)
+		if len(replies) == 0 {
+			http.Error(w, "no more replies", http.StatusInternalServerError)
+			return
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		json.NewEncoder(w).Encode(ChatGPTResponseBody{
+			Choices: []ChatGPTChoiceItem{{Message: reply}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return &ChatGPT{
+		Lb:       loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+		ApiUrl:   server.URL,
+		Platform: OpenAI,
+	}, &requests
+}
+
+func functionReply(args string) Messages {
+	return Messages{Role: "assistant", ToolCalls: []ToolCall{{
+		Id: "call_1", Type: "function",
+		Function: FunctionCall{Name: "event", Arguments: args},
+	}}}
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema, err := SchemaOf(&testEvent{})
+	if err != nil {
+		t.Fatalf("SchemaOf() error = %v", err)
+	}
+	if got := strings.Join(schema.Required, ","); got != "count,priority,title" {
+		t.Errorf("required = %s, want count,priority,title", got)
+	}
+	if schema.Properties["count"].Type != "integer" ||
+		schema.Properties["tags"].Items.Type != "string" ||
+		schema.Properties["title"].Description != "short title" ||
+		len(schema.Properties["priority"].Enum) != 2 {
+		t.Errorf("unexpected properties: %+v", schema.Properties)
+	}
+	if _, err := SchemaOf(make(chan int)); err == nil {
+		t.Errorf("SchemaOf(chan) should fail")
+	}
+}
+
+func TestStructuredCompletions(t *testing.T) {
+	gpt, requests := newFakeChatGPT(t, []Messages{
+		functionReply(`{"title":"launch","priority":"urgent","count":1}`),
+		functionReply(`{"title":"launch","priority":"high","count":2,"tags":["a"]}`),
+	})
+	var event testEvent
+	err := gpt.StructuredCompletions([]Messages{{Role: "user", Content: "plan"}},
+		Fresh, &event, StructuredOptions{Name: "event"})
+	if err != nil {
+		t.Fatalf("StructuredCompletions() error = %v", err)
+	}
+	if event.Title != "launch" || event.Priority != "high" || event.Count != 2 ||
+		len(event.Tags) != 1 {
+		t.Errorf("event = %+v", event)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(*requests))
+	}
+	first := (*requests)[0]
+	if len(first.Tools) != 1 || first.Tools[0].Function.Name != "event" ||
+		first.ToolChoice == nil {
+		t.Errorf("first request should force the event function: %+v", first)
+	}
+	retry := (*requests)[1].Messages
+	if last := retry[len(retry)-1]; !strings.Contains(last.Content, "$.priority must be one of") {
+		t.Errorf("retry should include the validation error, got %q", last.Content)
+	}
+}
+
+func TestStructuredCompletionsJSONObject(t *testing.T) {
+	gpt, requests := newFakeChatGPT(t, []Messages{
+		{Role: "assistant", Content: "```json\n{\"title\":\"x\",\"priority\":\"low\",\"count\":3}\n```"},
+	})
+	var event testEvent
+	err := gpt.StructuredCompletions([]Messages{{Role: "user", Content: "plan"}},
+		Fresh, &event, StructuredOptions{Mode: StructuredJSONObject})
+	if err != nil {
+		t.Fatalf("StructuredCompletions() error = %v", err)
+	}
+	if event.Count != 3 {
+		t.Errorf("event = %+v", event)
+	}
+	if f := (*requests)[0].ResponseFormat; f == nil || f.Type != "json_object" {
+		t.Errorf("response_format = %+v, want json_object", f)
+	}
+}
+
+func TestStructuredCompletionsGiveUp(t *testing.T) {
+	gpt, requests := newFakeChatGPT(t, []Messages{
+		functionReply(`not json`),
+		functionReply(`{"title":"x"}`),
+	})
+	var event testEvent
+	err := gpt.StructuredCompletions([]Messages{{Role: "user", Content: "plan"}},
+		Fresh, &event, StructuredOptions{Name: "event", MaxRetries: 1})
+	if err == nil || !strings.Contains(err.Error(), "is required") {
+		t.Fatalf("StructuredCompletions() error = %v, want a required field error", err)
+	}
+	if len(*requests) != 2 {
+		t.Errorf("requests = %d, want 2", len(*requests))
+	}
+}
+
+func TestWithModel(t *testing.T) {
+	reply := Messages{Role: "assistant", Content: "hi"}
+	gpt, requests := newFakeChatGPT(t, []Messages{reply, reply})
+	if _, err := gpt.WithModel("gpt-4o").Completions(
+		[]Messages{{Role: "user", Content: "hi"}}, Balance); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gpt.Completions([]Messages{{Role: "user", Content: "hi"}}, Balance); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*requests)[0].Model; got != "gpt-4o" {
+		t.Errorf("model = %s, want gpt-4o", got)
+	}
+	if got := (*requests)[1].Model; got != engine {
+		t.Errorf("model after WithModel = %s, want the default %s", got, engine)
+	}
+}
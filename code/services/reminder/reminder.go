@@ -0,0 +1,220 @@
+package reminder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	// StatusPending 等待用户在卡片上确认
+	StatusPending Status = "pending"
+	StatusActive  Status = "active"
+	StatusDone    Status = "done"
+	StatusCancel  Status = "cancelled"
+)
+
+// 未确认的提醒保留时长
+const pendingExpiry = 24 * time.Hour
+
+type Reminder struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	Content   string    `json:"content"`
+	DueAt     time.Time `json:"due_at"`
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type storeData struct {
+	Reminders []*Reminder       `json:"reminders"`
+	Timezones map[string]string `json:"timezones"`
+}
+
+// Store 持久化的提醒列表和用户时区设置
+type Store struct {
+	mu              sync.Mutex
+	path            string
+	defaultTimezone *time.Location
+	reminders       map[string]*Reminder
+	timezones       map[string]string
+}
+
+func NewStore(path string, defaultTimezone *time.Location) (*Store, error) {
+	s := &Store{
+		path:            path,
+		defaultTimezone: defaultTimezone,
+		reminders:       make(map[string]*Reminder),
+		timezones:       make(map[string]string),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	var saved storeData
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return s, fmt.Errorf("invalid reminder file %s: %w", path, err)
+	}
+	for _, r := range saved.Reminders {
+		s.reminders[r.Id] = r
+	}
+	for user, tz := range saved.Timezones {
+		s.timezones[user] = tz
+	}
+	return s, nil
+}
+
+// Add 新建一个待确认的提醒
+func (s *Store) Add(userId string, content string, dueAt time.Time) (*Reminder, error) {
+	r := &Reminder{
+		Id:        uuid.New().String()[:8],
+		UserId:    userId,
+		Content:   content,
+		DueAt:     dueAt,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reminders[r.Id] = r
+	copied := *r
+	return &copied, s.save()
+}
+
+func (s *Store) Get(id string) (*Reminder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reminders[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *r
+	return &copied, true
+}
+
+// Update 修改提醒, 只有提醒的创建者可以修改
+func (s *Store) Update(id string, userId string, update func(r *Reminder)) (*Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reminders[id]
+	if !ok {
+		return nil, fmt.Errorf("reminder %s not found", id)
+	}
+	if r.UserId != userId {
+		return nil, errors.New("only the creator can change this reminder")
+	}
+	update(r)
+	copied := *r
+	return &copied, s.save()
+}
+
+// List 用户尚未触发的提醒, 按时间排序
+func (s *Store) List(userId string) []Reminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Reminder
+	for _, r := range s.reminders {
+		if r.UserId == userId && r.Status == StatusActive {
+			result = append(result, *r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DueAt.Before(result[j].DueAt)
+	})
+	return result
+}
+
+// Timezone 用户的时区, 未设置时使用默认时区
+func (s *Store) Timezone(userId string) *time.Location {
+	s.mu.Lock()
+	name, ok := s.timezones[userId]
+	s.mu.Unlock()
+	if ok {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return s.defaultTimezone
+}
+
+func (s *Store) SetTimezone(userId string, name string) error {
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("unknown time zone %s", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timezones[userId] = name
+	return s.save()
+}
+
+// Run 定时检查到期的提醒, 标记为已完成后交给 fire 发送
+func (s *Store) Run(interval time.Duration, fire func(r Reminder)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, r := range s.takeDue(now) {
+			fire(r)
+		}
+	}
+}
+
+func (s *Store) takeDue(now time.Time) []Reminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Reminder
+	changed := false
+	for id, r := range s.reminders {
+		switch {
+		case r.Status == StatusActive && !r.DueAt.After(now):
+			r.Status = StatusDone
+			due = append(due, *r)
+			changed = true
+		case r.Status == StatusPending && now.Sub(r.CreatedAt) > pendingExpiry,
+			r.Status == StatusCancel,
+			r.Status == StatusDone && now.Sub(r.DueAt) > pendingExpiry:
+			delete(s.reminders, id)
+			changed = true
+		}
+	}
+	if changed {
+		if err := s.save(); err != nil {
+			fmt.Printf("failed to save reminders: %v\n", err)
+		}
+	}
+	return due
+}
+
+// save 调用方需持有锁
+func (s *Store) save() error {
+	data := storeData{Timezones: s.timezones}
+	for _, r := range s.reminders {
+		data.Reminders = append(data.Reminders, r)
+	}
+	sort.Slice(data.Reminders, func(i, j int) bool {
+		return data.Reminders[i].CreatedAt.Before(data.Reminders[j].CreatedAt)
+	})
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,58 @@
+package reminder
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reminders.json")
+	s, err := NewStore(path, time.UTC)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	now := time.Now()
+	added, err := s.Add("ou_1", "send the report", now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if len(s.List("ou_1")) != 0 {
+		t.Errorf("pending reminders should not be listed before confirmation")
+	}
+	if _, err := s.Update(added.Id, "ou_2", func(r *Reminder) {}); err == nil {
+		t.Errorf("Update() by another user should fail")
+	}
+	if _, err := s.Update(added.Id, "ou_1", func(r *Reminder) {
+		r.Status = StatusActive
+	}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := s.SetTimezone("ou_1", "Not/AZone"); err == nil {
+		t.Errorf("SetTimezone() with an unknown zone should fail")
+	}
+	if err := s.SetTimezone("ou_1", "Asia/Tokyo"); err != nil {
+		t.Fatalf("SetTimezone() error = %v", err)
+	}
+
+	restored, err := NewStore(path, time.UTC)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if got := restored.Timezone("ou_1").String(); got != "Asia/Tokyo" {
+		t.Errorf("Timezone() = %s, want Asia/Tokyo", got)
+	}
+	if got := restored.Timezone("ou_2"); got != time.UTC {
+		t.Errorf("Timezone() of unknown user = %s, want UTC", got)
+	}
+	if due := restored.takeDue(now); len(due) != 0 {
+		t.Errorf("takeDue() before due time = %+v, want none", due)
+	}
+	due := restored.takeDue(now.Add(2 * time.Hour))
+	if len(due) != 1 || due[0].Id != added.Id || due[0].Content != "send the report" {
+		t.Fatalf("takeDue() = %+v, want %s", due, added.Id)
+	}
+	if due := restored.takeDue(now.Add(3 * time.Hour)); len(due) != 0 {
+		t.Errorf("reminder fired twice: %+v", due)
+	}
+}
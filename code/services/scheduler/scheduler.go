@@ -0,0 +1,242 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+type JobKind string
+
+const (
+	// KindPrompt 将 Prompt 发给模型, 把回答发到群里
+	KindPrompt JobKind = "prompt"
+	// KindSummary 总结当天的群聊记录
+	KindSummary JobKind = "summary"
+)
+
+type Job struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Spec      string    `json:"spec"`
+	ChatId    string    `json:"chat_id"`
+	Kind      JobKind   `json:"kind"`
+	Prompt    string    `json:"prompt"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// FromConfig 配置文件中定义的任务不会持久化, 也不能通过命令取消
+	FromConfig bool `json:"-"`
+}
+
+// Scheduler 进程内的 cron 调度器, 通过命令创建的任务持久化到 path
+type Scheduler struct {
+	mu      sync.RWMutex
+	cron    *cron.Cron
+	parser  cron.Parser
+	path    string
+	jobs    map[string]*Job
+	entries map[string]cron.EntryID
+	specs   map[string]cron.Schedule
+	loc     *time.Location
+	run     func(job Job)
+}
+
+// New 创建调度器, cron 表达式按 loc 时区执行
+func New(path string, loc *time.Location, run func(job Job)) *Scheduler {
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom |
+		cron.Month | cron.Dow | cron.Descriptor)
+	return &Scheduler{
+		cron:    cron.New(cron.WithParser(parser), cron.WithLocation(loc)),
+		parser:  parser,
+		path:    path,
+		loc:     loc,
+		jobs:    make(map[string]*Job),
+		entries: make(map[string]cron.EntryID),
+		specs:   make(map[string]cron.Schedule),
+		run:     run,
+	}
+}
+
+// Load 注册配置文件中的任务, 并恢复持久化的任务. 无效的任务跳过,
+// 不影响其他任务
+func (s *Scheduler) Load(configJobs []Job) error {
+	for i, job := range configJobs {
+		job.FromConfig = true
+		if job.Id == "" {
+			job.Id = fmt.Sprintf("config-%d", i+1)
+		}
+		if _, err := s.register(job); err != nil {
+			fmt.Printf("skip invalid schedule %s: %v\n", job.Id, err)
+		}
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []Job
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid schedule file %s: %w", s.path, err)
+	}
+	for _, job := range saved {
+		if _, err := s.register(job); err != nil {
+			fmt.Printf("skip schedule %s: %v\n", job.Id, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// Add 新建任务并持久化
+func (s *Scheduler) Add(job Job) (*Job, error) {
+	job.Id = uuid.New().String()[:8]
+	job.CreatedAt = time.Now()
+	job.FromConfig = false
+	added, err := s.register(job)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(); err != nil {
+		s.mu.Lock()
+		s.unregister(added.Id)
+		s.mu.Unlock()
+		return nil, err
+	}
+	return added, nil
+}
+
+// Remove 取消任务, 配置文件中的任务不能取消
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("schedule %s not found", id)
+	}
+	if job.FromConfig {
+		s.mu.Unlock()
+		return fmt.Errorf("schedule %s is defined in the config file", id)
+	}
+	s.unregister(id)
+	s.mu.Unlock()
+	return s.save()
+}
+
+func (s *Scheduler) unregister(id string) {
+	s.cron.Remove(s.entries[id])
+	delete(s.jobs, id)
+	delete(s.entries, id)
+	delete(s.specs, id)
+}
+
+// List 返回会话群中的任务, 按创建时间排序
+func (s *Scheduler) List(chatId string) []Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var jobs []Job
+	for _, job := range s.jobs {
+		if job.ChatId == chatId {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Next 任务下一次执行的时间
+func (s *Scheduler) Next(id string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schedule, ok := s.specs[id]
+	if !ok {
+		return time.Time{}
+	}
+	return schedule.Next(time.Now().In(s.loc))
+}
+
+// Validate 校验 cron 表达式
+func (s *Scheduler) Validate(spec string) error {
+	_, err := s.parser.Parse(spec)
+	return err
+}
+
+func (s *Scheduler) register(job Job) (*Job, error) {
+	if job.ChatId == "" {
+		return nil, errors.New("chat_id is required")
+	}
+	if job.Kind == "" {
+		job.Kind = KindPrompt
+	}
+	if job.Kind != KindPrompt && job.Kind != KindSummary {
+		return nil, fmt.Errorf("unknown kind %s", job.Kind)
+	}
+	if job.Kind == KindPrompt && job.Prompt == "" {
+		return nil, errors.New("prompt is required")
+	}
+	schedule, err := s.parser.Parse(job.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Id]; ok {
+		return nil, fmt.Errorf("duplicate schedule id %s", job.Id)
+	}
+	stored := job
+	entryId := s.cron.Schedule(schedule, cron.FuncJob(func() {
+		s.run(stored)
+	}))
+	s.jobs[job.Id] = &stored
+	s.entries[job.Id] = entryId
+	s.specs[job.Id] = schedule
+	return &stored, nil
+}
+
+// save 只持久化通过命令创建的任务
+func (s *Scheduler) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []Job
+	for _, job := range s.jobs {
+		if !job.FromConfig {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
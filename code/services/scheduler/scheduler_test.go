@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchedulerPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	noop := func(job Job) {}
+
+	s := New(path, time.UTC, noop)
+	if err := s.Load([]Job{{Spec: "0 9 * * 1", ChatId: "oc_1", Prompt: "config"}}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	added, err := s.Add(Job{Spec: "30 18 * * *", ChatId: "oc_1", Kind: KindSummary})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := s.Add(Job{Spec: "not a cron", ChatId: "oc_1", Prompt: "x"}); err == nil {
+		t.Errorf("Add() with invalid spec should fail")
+	}
+	if err := s.Remove("config-1"); err == nil {
+		t.Errorf("Remove() of a config job should fail")
+	}
+
+	restored := New(path, time.UTC, noop)
+	if err := restored.Load(nil); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	jobs := restored.List("oc_1")
+	if len(jobs) != 1 || jobs[0].Id != added.Id || jobs[0].Kind != KindSummary {
+		t.Fatalf("restored jobs = %+v, want only %s", jobs, added.Id)
+	}
+	if restored.Next(added.Id).IsZero() {
+		t.Errorf("Next() should be set for a registered job")
+	}
+
+	if err := restored.Remove(added.Id); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	empty := New(path, time.UTC, noop)
+	if err := empty.Load(nil); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if jobs := empty.List("oc_1"); len(jobs) != 0 {
+		t.Errorf("jobs after Remove() = %+v, want none", jobs)
+	}
+}
+
+func TestSchedulerSkipsInvalidConfigJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	noop := func(job Job) {}
+	s := New(path, time.UTC, noop)
+	added, err := s.Add(Job{Spec: "0 9 * * *", ChatId: "oc_1", Prompt: "saved"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// 配置中的无效任务不影响其他配置任务和持久化的任务
+	restored := New(path, time.UTC, noop)
+	err = restored.Load([]Job{
+		{Spec: "not a cron", ChatId: "oc_1", Prompt: "bad"},
+		{Spec: "0 18 * * *", ChatId: "oc_1", Prompt: "good"},
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, job := range restored.List("oc_1") {
+		ids[job.Id] = true
+	}
+	if len(ids) != 2 || !ids["config-2"] || !ids[added.Id] {
+		t.Errorf("loaded jobs = %v, want config-2 and %s", ids, added.Id)
+	}
+}
+
+func TestSchedulerLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	s := New(filepath.Join(t.TempDir(), "schedules.json"), loc, func(job Job) {})
+	if err := s.Load([]Job{{Spec: "0 9 * * *", ChatId: "oc_1", Prompt: "x"}}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	next := s.Next("config-1").In(loc)
+	if next.Hour() != 9 || next.Minute() != 0 {
+		t.Errorf("Next() = %v, want 09:00 in %s", next, loc)
+	}
+	if next = s.Next("config-1").UTC(); next.Hour() != 1 {
+		t.Errorf("Next() in UTC = %v, want 01:00", next)
+	}
+}
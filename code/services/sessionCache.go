@@ -1,6 +1,7 @@
 package services
 
 import (
+	"start-feishubot/services/document"
 	"start-feishubot/services/openai"
 	"time"
 
@@ -12,15 +13,52 @@ type SessionService struct {
 	cache *cache.Cache
 }
 type PicSetting struct {
-	resolution Resolution
+	// options 图片生成的模型、尺寸、质量、风格和数量
+	options openai.ImageOptions
+	// editImage 图片创作模式下最近一次收到或修改后的图片, 后续的文字指令用于修改它
+	editImage []byte
+	// history 会话中收到和生成的图片, 最新的在最后
+	history []PicHistoryItem
+	// optimizePrompt 是否先扩写提示词, 为空时使用配置的默认值
+	optimizePrompt *bool
 }
+
+// PicHistoryItem 会话中的一张图片, 通过飞书的 image_key 重新获取
+type PicHistoryItem struct {
+	ImageKey string
+	// MsgId 用户发送的图片所在的消息, 为空时是机器人上传的图片
+	MsgId string
+	// Prompt 生成或修改图片时使用的提示词
+	Prompt    string
+	CreatedAt time.Time
+}
+
+// maxPicHistory 每个会话保留的图片数量
+const maxPicHistory = 10
+
 type Resolution string
 
+// VoiceSetting 语音转写和语音回复设置, 为空时使用配置的默认值
+type VoiceSetting struct {
+	reply *bool
+	voice string
+	// language 转写的语言提示, auto 表示自动识别
+	language string
+	// transcribeOnly 只转写语音, 不回答
+	transcribeOnly *bool
+}
+
 type SessionMeta struct {
-	Mode       SessionMode       `json:"mode"`
-	Msg        []openai.Messages `json:"msg,omitempty"`
-	PicSetting PicSetting        `json:"pic_setting,omitempty"`
-	AIMode     openai.AIMode     `json:"ai_mode,omitempty"`
+	Mode         SessionMode        `json:"mode"`
+	Msg          []openai.Messages  `json:"msg,omitempty"`
+	PicSetting   PicSetting         `json:"pic_setting,omitempty"`
+	AIMode       openai.AIMode      `json:"ai_mode,omitempty"`
+	Document     *document.Document `json:"document,omitempty"`
+	VoiceSetting VoiceSetting       `json:"voice_setting,omitempty"`
+	// Model 话题使用的对话模型, 为空时使用会话设置
+	Model string `json:"model,omitempty"`
+	// AIModeSet 话题是否选择过 AI 模式, 用于区分温度 0 和未选择
+	AIModeSet bool `json:"ai_mode_set,omitempty"`
 }
 
 const (
@@ -43,13 +81,32 @@ type SessionServiceCacheInterface interface {
 	GetMode(sessionId string) SessionMode
 	GetAIMode(sessionId string) openai.AIMode
 	SetAIMode(sessionId string, aiMode openai.AIMode)
+	HasAIMode(sessionId string) bool
+	GetModel(sessionId string) string
+	SetModel(sessionId string, model string)
 	SetPicResolution(sessionId string, resolution Resolution)
 	GetPicResolution(sessionId string) string
+	SetPicOptions(sessionId string, options openai.ImageOptions)
+	GetPicOptions(sessionId string) openai.ImageOptions
+	SetPicEditImage(sessionId string, image []byte)
+	AddPicHistory(sessionId string, items ...PicHistoryItem)
+	SetPicPromptOptimize(sessionId string, on bool)
+	GetPicPromptOptimize(sessionId string, defaultOn bool) bool
+	GetPicHistory(sessionId string) []PicHistoryItem
+	GetPicEditImage(sessionId string) []byte
+	SetDocument(sessionId string, doc *document.Document)
+	GetDocument(sessionId string) *document.Document
+	SetVoiceReply(sessionId string, on bool)
+	GetVoiceReply(sessionId string, defaultOn bool) bool
+	SetVoice(sessionId string, voice string)
+	GetVoice(sessionId string, defaultVoice string) string
+	SetTranscribeLanguage(sessionId string, language string)
+	GetTranscribeLanguage(sessionId string, defaultLanguage string) string
+	SetTranscribeOnly(sessionId string, on bool)
+	GetTranscribeOnly(sessionId string, defaultOn bool) bool
 	Clear(sessionId string)
 }
 
-var sessionServices *SessionService
-
 // implement Get interface
 func (s *SessionService) Get(sessionId string) *SessionMeta {
 	sessionContext, ok := s.cache.Get(sessionId)
@@ -103,15 +160,25 @@ func (s *SessionService) SetAIMode(sessionId string, aiMode openai.AIMode) {
 	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
-		sessionMeta := &SessionMeta{AIMode: aiMode}
+		sessionMeta := &SessionMeta{AIMode: aiMode, AIModeSet: true}
 		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 		return
 	}
 	sessionMeta := sessionContext.(*SessionMeta)
 	sessionMeta.AIMode = aiMode
+	sessionMeta.AIModeSet = true
 	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 }
 
+// HasAIMode 话题中是否已经选择了 AI 模式或温度
+func (s *SessionService) HasAIMode(sessionId string) bool {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return false
+	}
+	return sessionContext.(*SessionMeta).AIModeSet
+}
+
 func (s *SessionService) GetMsg(sessionId string) (msg []openai.Messages) {
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
@@ -121,12 +188,32 @@ func (s *SessionService) GetMsg(sessionId string) (msg []openai.Messages) {
 	return sessionMeta.Msg
 }
 
+func (s *SessionService) GetModel(sessionId string) string {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return ""
+	}
+	return sessionContext.(*SessionMeta).Model
+}
+
+func (s *SessionService) SetModel(sessionId string, model string) {
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		s.cache.Set(sessionId, &SessionMeta{Model: model}, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.Model = model
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
 func (s *SessionService) SetMsg(sessionId string, msg []openai.Messages) {
 	maxLength := 4096
 	maxCacheTime := time.Hour * 12
 
 	//限制对话上下文长度
-	for getStrPoolTotalLength(msg) > maxLength {
+	for len(msg) > 1 && getStrPoolTotalLength(msg) > maxLength {
 		msg = append(msg[:1], msg[2:]...)
 	}
 
@@ -143,35 +230,248 @@ func (s *SessionService) SetMsg(sessionId string, msg []openai.Messages) {
 
 func (s *SessionService) SetPicResolution(sessionId string,
 	resolution Resolution) {
+	options := s.GetPicOptions(sessionId)
+	options.Size = string(resolution)
+	if options.Validate() != nil {
+		options.Size = string(Resolution256)
+	}
+	s.SetPicOptions(sessionId, options)
+}
+
+func (s *SessionService) GetPicResolution(sessionId string) string {
+	return s.GetPicOptions(sessionId).Size
+}
+
+// SetPicOptions 保存图片设置, 调用方需要先校验
+func (s *SessionService) SetPicOptions(sessionId string,
+	options openai.ImageOptions) {
 	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		sessionMeta := &SessionMeta{PicSetting: PicSetting{options: options}}
+		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.PicSetting.options = options
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
 
-	//if not in [Resolution256, Resolution512, Resolution1024] then set
-	//to Resolution256
-	switch resolution {
-	case Resolution256, Resolution512, Resolution1024:
-	default:
-		resolution = Resolution256
+// GetPicOptions 未设置时返回默认的 DALL·E 2 设置
+func (s *SessionService) GetPicOptions(sessionId string) openai.ImageOptions {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return openai.DefaultImageOptions()
 	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.PicSetting.options.N == 0 {
+		return openai.DefaultImageOptions()
+	}
+	return sessionMeta.PicSetting.options
+}
 
+// SetPicEditImage 保存待修改的图片 (PNG)
+func (s *SessionService) SetPicEditImage(sessionId string, image []byte) {
+	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
-		sessionMeta := &SessionMeta{PicSetting: PicSetting{resolution: resolution}}
+		sessionMeta := &SessionMeta{PicSetting: PicSetting{editImage: image}}
 		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 		return
 	}
 	sessionMeta := sessionContext.(*SessionMeta)
-	sessionMeta.PicSetting.resolution = resolution
+	sessionMeta.PicSetting.editImage = image
 	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 }
 
-func (s *SessionService) GetPicResolution(sessionId string) string {
+func (s *SessionService) GetPicEditImage(sessionId string) []byte {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return nil
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	return sessionMeta.PicSetting.editImage
+}
+
+// AddPicHistory 记录图片, 超过 maxPicHistory 时丢弃最早的
+func (s *SessionService) AddPicHistory(sessionId string,
+	items ...PicHistoryItem) {
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		sessionContext = &SessionMeta{}
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	history := append(sessionMeta.PicSetting.history, items...)
+	if len(history) > maxPicHistory {
+		history = history[len(history)-maxPicHistory:]
+	}
+	sessionMeta.PicSetting.history = history
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+func (s *SessionService) GetPicHistory(sessionId string) []PicHistoryItem {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return nil
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	return append([]PicHistoryItem{}, sessionMeta.PicSetting.history...)
+}
+
+func (s *SessionService) SetPicPromptOptimize(sessionId string, on bool) {
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		sessionMeta := &SessionMeta{PicSetting: PicSetting{optimizePrompt: &on}}
+		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.PicSetting.optimizePrompt = &on
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+// GetPicPromptOptimize 会话未设置时返回 defaultOn
+func (s *SessionService) GetPicPromptOptimize(sessionId string, defaultOn bool) bool {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return defaultOn
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.PicSetting.optimizePrompt == nil {
+		return defaultOn
+	}
+	return *sessionMeta.PicSetting.optimizePrompt
+}
+
+// SetDocument 绑定会话中用于问答的文档
+func (s *SessionService) SetDocument(sessionId string,
+	doc *document.Document) {
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		sessionMeta := &SessionMeta{Document: doc}
+		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.Document = doc
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+func (s *SessionService) GetDocument(sessionId string) *document.Document {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return nil
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	return sessionMeta.Document
+}
+
+func (s *SessionService) SetVoiceReply(sessionId string, on bool) {
+	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
-		return string(Resolution256)
+		sessionMeta := &SessionMeta{VoiceSetting: VoiceSetting{reply: &on}}
+		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+		return
 	}
 	sessionMeta := sessionContext.(*SessionMeta)
-	return string(sessionMeta.PicSetting.resolution)
+	sessionMeta.VoiceSetting.reply = &on
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
 
+// GetVoiceReply 会话未设置时返回 defaultOn
+func (s *SessionService) GetVoiceReply(sessionId string, defaultOn bool) bool {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return defaultOn
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.VoiceSetting.reply == nil {
+		return defaultOn
+	}
+	return *sessionMeta.VoiceSetting.reply
+}
+
+func (s *SessionService) SetVoice(sessionId string, voice string) {
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		sessionMeta := &SessionMeta{VoiceSetting: VoiceSetting{voice: voice}}
+		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.VoiceSetting.voice = voice
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+// GetVoice 会话未选择声音时返回 defaultVoice
+func (s *SessionService) GetVoice(sessionId string, defaultVoice string) string {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return defaultVoice
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.VoiceSetting.voice == "" {
+		return defaultVoice
+	}
+	return sessionMeta.VoiceSetting.voice
+}
+
+func (s *SessionService) SetTranscribeLanguage(sessionId string, language string) {
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		sessionMeta := &SessionMeta{VoiceSetting: VoiceSetting{language: language}}
+		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.VoiceSetting.language = language
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+// GetTranscribeLanguage 会话未设置时返回 defaultLanguage
+func (s *SessionService) GetTranscribeLanguage(sessionId string,
+	defaultLanguage string) string {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return defaultLanguage
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.VoiceSetting.language == "" {
+		return defaultLanguage
+	}
+	return sessionMeta.VoiceSetting.language
+}
+
+func (s *SessionService) SetTranscribeOnly(sessionId string, on bool) {
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		sessionMeta := &SessionMeta{VoiceSetting: VoiceSetting{transcribeOnly: &on}}
+		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.VoiceSetting.transcribeOnly = &on
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+// GetTranscribeOnly 会话未设置时返回 defaultOn
+func (s *SessionService) GetTranscribeOnly(sessionId string, defaultOn bool) bool {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return defaultOn
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.VoiceSetting.transcribeOnly == nil {
+		return defaultOn
+	}
+	return *sessionMeta.VoiceSetting.transcribeOnly
 }
 
 func (s *SessionService) Clear(sessionId string) {
@@ -179,11 +479,9 @@ func (s *SessionService) Clear(sessionId string) {
 	s.cache.Delete(sessionId)
 }
 
-func GetSessionCache() SessionServiceCacheInterface {
-	if sessionServices == nil {
-		sessionServices = &SessionService{cache: cache.New(time.Hour*12, time.Hour*1)}
-	}
-	return sessionServices
+// NewSessionCache 每个飞书应用使用独立的会话缓存, 同一会话 ID 在不同应用间互不影响
+func NewSessionCache() SessionServiceCacheInterface {
+	return &SessionService{cache: cache.New(time.Hour*12, time.Hour*1)}
 }
 
 func getStrPoolTotalLength(strPool []openai.Messages) int {
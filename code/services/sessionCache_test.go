@@ -0,0 +1,60 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+func TestPicHistory(t *testing.T) {
+	s := &SessionService{cache: cache.New(time.Hour, time.Hour)}
+	if got := s.GetPicHistory("s1"); len(got) != 0 {
+		t.Fatalf("history of a new session = %v", got)
+	}
+	for i := 0; i < maxPicHistory+2; i++ {
+		s.AddPicHistory("s1", PicHistoryItem{ImageKey: fmt.Sprintf("img_%d", i)})
+	}
+	history := s.GetPicHistory("s1")
+	if len(history) != maxPicHistory {
+		t.Fatalf("history length = %d, want %d", len(history), maxPicHistory)
+	}
+	if history[0].ImageKey != "img_2" || history[maxPicHistory-1].ImageKey != "img_11" {
+		t.Errorf("history should keep the latest pictures, got %s..%s",
+			history[0].ImageKey, history[maxPicHistory-1].ImageKey)
+	}
+	// 图片历史与其他设置互不影响
+	s.SetPicResolution("s1", Resolution512)
+	if len(s.GetPicHistory("s1")) != maxPicHistory || s.GetPicResolution("s1") != "512x512" {
+		t.Errorf("picture settings should not reset the history")
+	}
+}
+
+func TestVoiceSetting(t *testing.T) {
+	s := &SessionService{cache: cache.New(time.Hour, time.Hour)}
+	if !s.GetVoiceReply("s1", true) || s.GetVoice("s1", "alloy") != "alloy" {
+		t.Fatalf("a new session should use the defaults")
+	}
+	s.SetVoice("s1", "nova")
+	if s.GetVoiceReply("s1", true) != true {
+		t.Errorf("choosing a voice should keep the default reply mode")
+	}
+	s.SetVoiceReply("s1", false)
+	if s.GetVoiceReply("s1", true) || s.GetVoice("s1", "alloy") != "nova" {
+		t.Errorf("voice settings = %v/%s, want off/nova",
+			s.GetVoiceReply("s1", true), s.GetVoice("s1", "alloy"))
+	}
+
+	if s.GetTranscribeLanguage("s1", "auto") != "auto" || s.GetTranscribeOnly("s1", false) {
+		t.Errorf("transcription settings should use the defaults")
+	}
+	s.SetTranscribeLanguage("s1", "zh")
+	s.SetTranscribeOnly("s2", true)
+	if s.GetTranscribeLanguage("s1", "auto") != "zh" || !s.GetTranscribeOnly("s2", false) {
+		t.Errorf("transcription settings were not saved")
+	}
+	if s.GetVoice("s1", "alloy") != "nova" || s.GetTranscribeOnly("s1", false) {
+		t.Errorf("transcription settings should not change other sessions or settings")
+	}
+}
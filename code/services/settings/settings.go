@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Settings 一个群聊或私聊的设置, 未设置的字段使用全局配置
+type Settings struct {
+	// Role 新话题默认使用的角色标题, 与 SystemPrompt 只能有一个生效
+	Role string `json:"role,omitempty"`
+	// SystemPrompt 新话题默认使用的系统提示词
+	SystemPrompt string   `json:"system_prompt,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	// AnswerWithoutMention 群聊中不需要@机器人也回答
+	AnswerWithoutMention bool `json:"answer_without_mention,omitempty"`
+	// GroupMode 群聊的触发方式, 多个用逗号分隔, 为空时使用 GROUP_MODE
+	GroupMode string `json:"group_mode,omitempty"`
+	// Language 回答使用的语言, 为空时跟随提问的语言
+	Language   string `json:"language,omitempty"`
+	VoiceReply *bool  `json:"voice_reply,omitempty"`
+	// MaxHistory 每次提问最多带上的历史消息数, 为 0 时不限制
+	MaxHistory int       `json:"max_history,omitempty"`
+	UpdatedBy  string    `json:"updated_by,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at,omitempty"`
+}
+
+// Store 持久化的会话设置, 与 12 小时过期的会话缓存相互独立
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	chats map[string]Settings
+}
+
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, chats: make(map[string]Settings)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s.chats); err != nil {
+		return s, fmt.Errorf("invalid settings file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get 会话的设置, 未设置过时返回空设置
+func (s *Store) Get(chatId string) Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chats[chatId]
+}
+
+// Update 修改会话的设置并保存, userId 记录为最后修改人
+func (s *Store) Update(chatId string, userId string,
+	update func(settings *Settings)) (Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.chats[chatId]
+	update(&settings)
+	settings.UpdatedBy = userId
+	settings.UpdatedAt = time.Now()
+	s.chats[chatId] = settings
+	return settings, s.save()
+}
+
+// Reset 恢复会话的设置为全局配置
+func (s *Store) Reset(chatId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[chatId]; !ok {
+		return nil
+	}
+	delete(s.chats, chatId)
+	return s.save()
+}
+
+// save 调用方需持有锁
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s.chats, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
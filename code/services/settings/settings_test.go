@@ -0,0 +1,43 @@
+package settings
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if got := s.Get("oc_1"); got.Model != "" || got.Temperature != nil {
+		t.Errorf("Get() of an unknown chat = %+v, want empty settings", got)
+	}
+	temperature := 0.2
+	if _, err := s.Update("oc_1", "ou_1", func(settings *Settings) {
+		settings.Model = "gpt-4o"
+		settings.Temperature = &temperature
+		settings.MaxHistory = 10
+	}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	s.Update("oc_2", "ou_1", func(settings *Settings) { settings.Language = "en" })
+
+	restored, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	got := restored.Get("oc_1")
+	if got.Model != "gpt-4o" || got.Temperature == nil || *got.Temperature != 0.2 ||
+		got.MaxHistory != 10 || got.UpdatedBy != "ou_1" {
+		t.Errorf("restored settings = %+v", got)
+	}
+	if err := restored.Reset("oc_1"); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	restored, _ = NewStore(path)
+	if restored.Get("oc_1").Model != "" || restored.Get("oc_2").Language != "en" {
+		t.Errorf("Reset() should only clear the settings of oc_1")
+	}
+}
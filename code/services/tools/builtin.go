@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+
+	larkcontact "github.com/larksuite/oapi-sdk-go/v3/service/contact/v3"
+)
+
+// RegisterBuiltins 注册内置工具
+func RegisterBuiltins(r *Registry, defaultTimezone *time.Location) error {
+	for _, tool := range []Tool{
+		currentTimeTool(defaultTimezone),
+		calculatorTool(),
+		feishuUserTool(),
+	} {
+		if err := r.Register(tool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func currentTimeTool(defaultTimezone *time.Location) Tool {
+	return Tool{
+		Name:        "current_time",
+		Description: "Get the current date, time and weekday.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"timezone": map[string]interface{}{
+					"type":        "string",
+					"description": "IANA time zone such as Asia/Shanghai, optional",
+				},
+			},
+		},
+		Handler: func(ctx context.Context, caller Caller,
+			args json.RawMessage) (string, error) {
+			var params struct {
+				Timezone string `json:"timezone"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+			loc := defaultTimezone
+			if params.Timezone != "" {
+				var err error
+				if loc, err = time.LoadLocation(params.Timezone); err != nil {
+					return "", fmt.Errorf("unknown time zone %s", params.Timezone)
+				}
+			}
+			now := time.Now().In(loc)
+			return fmt.Sprintf("%s %s (%s)", now.Format("2006-01-02 15:04:05"),
+				now.Weekday(), loc), nil
+		},
+	}
+}
+
+func calculatorTool() Tool {
+	return Tool{
+		Name: "calculator",
+		Description: "Evaluate an arithmetic expression exactly. Supports + - * / % ^, " +
+			"parentheses, sqrt, abs, ln, log, sin, cos, tan, round, floor, ceil, pi and e.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"expression": map[string]interface{}{
+					"type":        "string",
+					"description": "the expression, e.g. (12.5 + 3) * 4 ^ 2",
+				},
+			},
+			"required": []string{"expression"},
+		},
+		Handler: func(ctx context.Context, caller Caller,
+			args json.RawMessage) (string, error) {
+			var params struct {
+				Expression string `json:"expression"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+			value, err := Evaluate(params.Expression)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(value, 'g', -1, 64), nil
+		},
+	}
+}
+
+func feishuUserTool() Tool {
+	return Tool{
+		Name:        "lookup_feishu_user",
+		Description: "Look up a Feishu user in the organization by email, mobile number or open_id.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"email":   map[string]interface{}{"type": "string"},
+				"mobile":  map[string]interface{}{"type": "string"},
+				"open_id": map[string]interface{}{"type": "string"},
+			},
+		},
+		Handler: func(ctx context.Context, caller Caller,
+			args json.RawMessage) (string, error) {
+			var params struct {
+				Email  string `json:"email"`
+				Mobile string `json:"mobile"`
+				OpenId string `json:"open_id"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+			openId := params.OpenId
+			if openId == "" {
+				var err error
+				if openId, err = findOpenId(ctx, params.Email, params.Mobile); err != nil {
+					return "", err
+				}
+			}
+			return getFeishuUser(ctx, openId)
+		},
+	}
+}
+
+func findOpenId(ctx context.Context, email string, mobile string) (string, error) {
+	body := larkcontact.NewBatchGetIdUserReqBodyBuilder()
+	switch {
+	case email != "":
+		body.Emails([]string{email})
+	case mobile != "":
+		body.Mobiles([]string{mobile})
+	default:
+		return "", errors.New("one of email, mobile or open_id is required")
+	}
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Contact.User.BatchGetId(ctx, larkcontact.NewBatchGetIdUserReqBuilder().
+		UserIdType("open_id").
+		Body(body.Build()).
+		Build())
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success() {
+		return "", fmt.Errorf("%d %s", resp.Code, resp.Msg)
+	}
+	for _, user := range resp.Data.UserList {
+		if user.UserId != nil && *user.UserId != "" {
+			return *user.UserId, nil
+		}
+	}
+	return "", errors.New("user not found or not visible to the bot")
+}
+
+func getFeishuUser(ctx context.Context, openId string) (string, error) {
+	client := initialization.GetLarkClient(ctx)
+	resp, err := client.Contact.User.Get(ctx, larkcontact.NewGetUserReqBuilder().
+		UserId(openId).
+		UserIdType("open_id").
+		Build())
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success() || resp.Data == nil || resp.Data.User == nil {
+		return "", fmt.Errorf("%d %s", resp.Code, resp.Msg)
+	}
+	user := resp.Data.User
+	var lines []string
+	add := func(key string, value *string) {
+		if value != nil && *value != "" {
+			lines = append(lines, key+": "+*value)
+		}
+	}
+	lines = append(lines, "open_id: "+openId)
+	add("name", user.Name)
+	add("en_name", user.EnName)
+	add("email", user.Email)
+	add("job_title", user.JobTitle)
+	add("city", user.City)
+	add("employee_no", user.EmployeeNo)
+	if len(user.DepartmentIds) > 0 {
+		lines = append(lines, "department_ids: "+strings.Join(user.DepartmentIds, ", "))
+	}
+	return strings.Join(lines, "\n"), nil
+}
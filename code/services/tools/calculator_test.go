@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 / 4", 2.5},
+		{"10 % 4", 2},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"2 * -3", -6},
+		{"sqrt(16) + abs(-2)", 6},
+		{"round(pi * 100) / 100", 3.14},
+		{"1_000 * 3", 3000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Evaluate(tt.expr)
+			if err != nil {
+				t.Fatalf("Evaluate(%q) error = %v", tt.expr, err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Evaluate(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 / 0",
+		"foo(1)",
+		"sqrt 4",
+		"1 2",
+		strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100),
+	}
+	for _, expr := range tests {
+		if got, err := Evaluate(expr); err == nil {
+			t.Errorf("Evaluate(%q) = %v, want error", expr, got)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"start-feishubot/services/openai"
+)
+
+// 单个工具结果最多返回给模型的长度
+const maxResultLength = 4000
+
+var ErrMaxIterations = errors.New("too many tool calls")
+
+// Caller 发起对话的用户, 用于工具的权限校验
+type Caller struct {
+	UserId string
+	ChatId string
+	Admin  bool
+}
+
+type Handler func(ctx context.Context, caller Caller,
+	args json.RawMessage) (string, error)
+
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters 参数的 JSON schema
+	Parameters map[string]interface{}
+	// Allow 为空时所有人都可以使用
+	Allow   func(caller Caller) bool
+	Handler Handler
+}
+
+// AdminOnly 只允许管理员使用的工具
+func AdminOnly(caller Caller) bool {
+	return caller.Admin
+}
+
+// Record 一次工具调用的记录, 用于在卡片中展示
+type Record struct {
+	Name      string
+	Arguments string
+	Result    string
+	Failed    bool
+}
+
+type Completer interface {
+	CompletionsWithTools(msg []openai.Messages, aiMode openai.AIMode,
+		tools []openai.Tool) (openai.Messages, error)
+}
+
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]*Tool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]*Tool)}
+}
+
+func (r *Registry) Register(tool Tool) error {
+	if tool.Name == "" || tool.Handler == nil {
+		return errors.New("tool name and handler are required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[tool.Name]; ok {
+		return fmt.Errorf("duplicate tool %s", tool.Name)
+	}
+	r.tools[tool.Name] = &tool
+	return nil
+}
+
+// Restrict 将指定的工具限制为管理员使用
+func (r *Registry) Restrict(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		if tool, ok := r.tools[name]; ok {
+			tool.Allow = AdminOnly
+		}
+	}
+}
+
+// Definitions 调用者有权限使用的工具, 按名称排序
+func (r *Registry) Definitions(caller Caller) []openai.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var defs []openai.Tool
+	for _, tool := range r.tools {
+		if tool.Allow != nil && !tool.Allow(caller) {
+			continue
+		}
+		params := tool.Parameters
+		if params == nil {
+			params = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		defs = append(defs, openai.Tool{
+			Type: "function",
+			Function: openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  params,
+			},
+		})
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Function.Name < defs[j].Function.Name
+	})
+	return defs
+}
+
+// Run 对话并执行模型请求的工具, 直到模型给出最终回答或超过 maxIterations 轮
+func (r *Registry) Run(ctx context.Context, c Completer, caller Caller,
+	msg []openai.Messages, aiMode openai.AIMode,
+	maxIterations int) (openai.Messages, []Record, error) {
+	defs := r.Definitions(caller)
+	if len(defs) == 0 {
+		resp, err := c.CompletionsWithTools(msg, aiMode, nil)
+		return resp, nil, err
+	}
+	// 不修改调用方的消息列表
+	msg = append([]openai.Messages{}, msg...)
+	var records []Record
+	for i := 0; i <= maxIterations; i++ {
+		tools := defs
+		if i == maxIterations {
+			// 最后一轮不再提供工具, 要求模型直接回答
+			tools = nil
+			msg = append(msg, openai.Messages{Role: "system",
+				Content: "The tool call limit has been reached. Answer with the information you have."})
+		}
+		resp, err := c.CompletionsWithTools(msg, aiMode, tools)
+		if err != nil {
+			return resp, records, err
+		}
+		if len(resp.ToolCalls) == 0 {
+			return resp, records, nil
+		}
+		if i == maxIterations {
+			break
+		}
+		msg = append(msg, resp)
+		for _, call := range resp.ToolCalls {
+			record := r.call(ctx, caller, call)
+			records = append(records, record)
+			msg = append(msg, openai.Messages{
+				Role:       "tool",
+				ToolCallId: call.Id,
+				Content:    record.Result,
+			})
+		}
+	}
+	return openai.Messages{}, records, ErrMaxIterations
+}
+
+func (r *Registry) call(ctx context.Context, caller Caller,
+	call openai.ToolCall) Record {
+	record := Record{Name: call.Function.Name, Arguments: call.Function.Arguments}
+	fail := func(msg string) Record {
+		record.Result = "error: " + msg
+		record.Failed = true
+		return record
+	}
+
+	r.mu.RLock()
+	tool, ok := r.tools[call.Function.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return fail("unknown tool")
+	}
+	if tool.Allow != nil && !tool.Allow(caller) {
+		return fail("permission denied")
+	}
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return fail("arguments are not valid JSON")
+	}
+	result, err := tool.Handler(ctx, caller, args)
+	if err != nil {
+		return fail(err.Error())
+	}
+	if runes := []rune(result); len(runes) > maxResultLength {
+		result = string(runes[:maxResultLength]) + "..."
+	}
+	record.Result = result
+	return record
+}
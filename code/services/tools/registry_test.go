@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"start-feishubot/services/openai"
+)
+
+// fakeCompleter 依次返回预设的回复, 并记录每次请求
+type fakeCompleter struct {
+	replies  []openai.Messages
+	requests [][]openai.Messages
+	tools    [][]openai.Tool
+}
+
+func (f *fakeCompleter) CompletionsWithTools(msg []openai.Messages,
+	aiMode openai.AIMode, tools []openai.Tool) (openai.Messages, error) {
+	f.requests = append(f.requests, msg)
+	f.tools = append(f.tools, tools)
+	if len(f.replies) == 0 {
+		return openai.Messages{}, errors.New("no more replies")
+	}
+	reply := f.replies[0]
+	f.replies = f.replies[1:]
+	return reply, nil
+}
+
+func toolCall(id string, name string, args string) openai.Messages {
+	return openai.Messages{Role: "assistant", ToolCalls: []openai.ToolCall{{
+		Id: id, Type: "function",
+		Function: openai.FunctionCall{Name: name, Arguments: args},
+	}}}
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+	if err := r.Register(calculatorTool()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(Tool{
+		Name:  "secret",
+		Allow: AdminOnly,
+		Handler: func(ctx context.Context, caller Caller, args json.RawMessage) (string, error) {
+			return "secret value", nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegistryRun(t *testing.T) {
+	r := newTestRegistry(t)
+	c := &fakeCompleter{replies: []openai.Messages{
+		toolCall("call_1", "calculator", `{"expression":"6*7"}`),
+		toolCall("call_2", "secret", `{}`),
+		{Role: "assistant", Content: "42"},
+	}}
+	resp, records, err := r.Run(context.Background(), c, Caller{UserId: "ou_1"},
+		[]openai.Messages{{Role: "user", Content: "what is 6*7"}}, openai.Fresh, 5)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if resp.Content != "42" {
+		t.Errorf("Run() answer = %q, want 42", resp.Content)
+	}
+	if len(records) != 2 || records[0].Result != "42" || records[0].Failed {
+		t.Fatalf("records = %+v", records)
+	}
+	if !records[1].Failed || records[1].Result != "error: permission denied" {
+		t.Errorf("secret tool should be denied for non-admins, got %+v", records[1])
+	}
+	if len(c.tools[0]) != 1 || c.tools[0][0].Function.Name != "calculator" {
+		t.Errorf("non-admins should only see the calculator, got %+v", c.tools[0])
+	}
+	last := c.requests[2]
+	if got := last[len(last)-1]; got.Role != "tool" || got.ToolCallId != "call_2" {
+		t.Errorf("last message = %+v, want the tool result of call_2", got)
+	}
+}
+
+func TestRegistryRunMaxIterations(t *testing.T) {
+	r := newTestRegistry(t)
+	c := &fakeCompleter{}
+	for i := 0; i < 3; i++ {
+		c.replies = append(c.replies, toolCall("call", "calculator", `{"expression":"1+1"}`))
+	}
+	c.replies = append(c.replies, openai.Messages{Role: "assistant", Content: "2"})
+	resp, records, err := r.Run(context.Background(), c, Caller{Admin: true},
+		[]openai.Messages{{Role: "user", Content: "loop"}}, openai.Fresh, 3)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if resp.Content != "2" {
+		t.Errorf("Run() answer = %q, want 2", resp.Content)
+	}
+	if len(records) != 3 {
+		t.Errorf("records = %d, want 3", len(records))
+	}
+	// 最后一轮不提供工具
+	if len(c.tools) != 4 || len(c.tools[2]) == 0 || c.tools[3] != nil {
+		t.Errorf("tools per request = %v, want none only in the last one", c.tools)
+	}
+
+	// 模型仍然返回工具调用时报错
+	c = &fakeCompleter{}
+	for i := 0; i < 4; i++ {
+		c.replies = append(c.replies, toolCall("call", "calculator", `{"expression":"1+1"}`))
+	}
+	_, records, err = r.Run(context.Background(), c, Caller{Admin: true},
+		[]openai.Messages{{Role: "user", Content: "loop"}}, openai.Fresh, 3)
+	if !errors.Is(err, ErrMaxIterations) {
+		t.Fatalf("Run() error = %v, want ErrMaxIterations", err)
+	}
+	if len(records) != 3 {
+		t.Errorf("records = %d, want 3", len(records))
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+type UserService struct {
+	cache *cache.Cache
+}
+type UserCacheInterface interface {
+	GetName(openId string) (string, bool)
+	SetName(openId string, name string)
+}
+
+func (u UserService) GetName(openId string) (string, bool) {
+	name, found := u.cache.Get(openId)
+	if !found {
+		return "", false
+	}
+	return name.(string), true
+}
+
+func (u UserService) SetName(openId string, name string) {
+	u.cache.Set(openId, name, time.Hour*24)
+}
+
+func NewUserCache() UserCacheInterface {
+	return &UserService{cache: cache.New(24*time.Hour, time.Hour)}
+}
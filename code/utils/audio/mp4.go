@@ -0,0 +1,431 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrNoAudioTrack = errors.New("no audio track found")
+
+// mp4Containers 需要解析子节点的 box
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true,
+}
+
+type mp4Box struct {
+	typ      string
+	payload  []byte
+	children []*mp4Box
+}
+
+func (b *mp4Box) child(typ string) *mp4Box {
+	for _, c := range b.children {
+		if c.typ == typ {
+			return c
+		}
+	}
+	return nil
+}
+
+// path 按路径查找子节点, 如 path("mdia", "minf", "stbl")
+func (b *mp4Box) path(types ...string) *mp4Box {
+	box := b
+	for _, typ := range types {
+		if box = box.child(typ); box == nil {
+			return nil
+		}
+	}
+	return box
+}
+
+func parseMP4Boxes(data []byte) ([]*mp4Box, error) {
+	var boxes []*mp4Box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("truncated mp4 box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		header := uint64(8)
+		switch size {
+		case 0: // 延续到文件末尾
+			size = uint64(len(data))
+		case 1: // 64 位大小
+			if len(data) < 16 {
+				return nil, errors.New("truncated mp4 box header")
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid size %d of mp4 box %q", size, data[4:8])
+		}
+		box := &mp4Box{typ: string(data[4:8]), payload: data[header:size]}
+		if mp4Containers[box.typ] {
+			children, err := parseMP4Boxes(box.payload)
+			if err != nil {
+				return nil, err
+			}
+			box.children = children
+		}
+		boxes = append(boxes, box)
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// IsMP4 判断是否为 MP4/M4A/MOV 容器
+func IsMP4(data []byte) bool {
+	return len(data) >= 12 && string(data[4:8]) == "ftyp"
+}
+
+// mp4Sample 音频轨道中的一帧, offset 是在原文件中的位置
+type mp4Sample struct {
+	offset   uint64
+	size     uint32
+	duration uint32
+}
+
+// mp4AudioTrack 从原文件中提取出的音频轨道
+type mp4AudioTrack struct {
+	timescale uint32
+	language  uint16
+	hdlr      []byte
+	stsd      []byte
+	samples   []mp4Sample
+}
+
+func findMP4AudioTrack(data []byte) (*mp4AudioTrack, error) {
+	boxes, err := parseMP4Boxes(data)
+	if err != nil {
+		return nil, err
+	}
+	var moov *mp4Box
+	for _, box := range boxes {
+		if box.typ == "moov" {
+			moov = box
+		}
+		if box.typ == "moof" {
+			return nil, errors.New("fragmented mp4 is not supported")
+		}
+	}
+	if moov == nil {
+		return nil, errors.New("mp4 has no moov box")
+	}
+	for _, trak := range moov.children {
+		if trak.typ != "trak" {
+			continue
+		}
+		hdlr := trak.path("mdia", "hdlr")
+		if hdlr == nil || len(hdlr.payload) < 12 || string(hdlr.payload[8:12]) != "soun" {
+			continue
+		}
+		return parseMP4AudioTrack(trak, hdlr, uint64(len(data)))
+	}
+	return nil, ErrNoAudioTrack
+}
+
+func parseMP4AudioTrack(trak *mp4Box, hdlr *mp4Box, fileSize uint64) (*mp4AudioTrack, error) {
+	mdhd := trak.path("mdia", "mdhd")
+	stbl := trak.path("mdia", "minf", "stbl")
+	if mdhd == nil || stbl == nil || len(mdhd.payload) < 24 {
+		return nil, errors.New("incomplete mp4 audio track")
+	}
+	track := &mp4AudioTrack{hdlr: hdlr.payload}
+	if mdhd.payload[0] == 1 {
+		if len(mdhd.payload) < 36 {
+			return nil, errors.New("incomplete mp4 audio track")
+		}
+		track.timescale = binary.BigEndian.Uint32(mdhd.payload[20:])
+		track.language = binary.BigEndian.Uint16(mdhd.payload[32:])
+	} else {
+		track.timescale = binary.BigEndian.Uint32(mdhd.payload[12:])
+		track.language = binary.BigEndian.Uint16(mdhd.payload[20:])
+	}
+	if track.timescale == 0 {
+		return nil, errors.New("mp4 audio track has no timescale")
+	}
+
+	stsd, stts, stsc, stsz := stbl.child("stsd"), stbl.child("stts"),
+		stbl.child("stsc"), stbl.child("stsz")
+	if stsd == nil || stts == nil || stsc == nil || stsz == nil {
+		return nil, errors.New("incomplete mp4 sample table")
+	}
+	track.stsd = stsd.payload
+
+	sizes, err := mp4SampleSizes(stsz.payload, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	durations, err := mp4SampleDurations(stts.payload, len(sizes))
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := mp4ChunkOffsets(stbl)
+	if err != nil {
+		return nil, err
+	}
+	chunkSamples, err := mp4ChunkSamples(stsc.payload, len(offsets))
+	if err != nil {
+		return nil, err
+	}
+
+	index := 0
+	for chunk, offset := range offsets {
+		for i := 0; i < chunkSamples[chunk] && index < len(sizes); i++ {
+			size := sizes[index]
+			if offset+uint64(size) > fileSize {
+				return nil, errors.New("mp4 sample is outside of the file")
+			}
+			track.samples = append(track.samples, mp4Sample{
+				offset: offset, size: size, duration: durations[index]})
+			offset += uint64(size)
+			index++
+		}
+	}
+	if len(track.samples) == 0 {
+		return nil, ErrNoAudioTrack
+	}
+	return track, nil
+}
+
+// fullBoxEntries 跳过 version/flags, 返回条目数和剩余内容
+func fullBoxEntries(payload []byte, skip int, entrySize int) (int, []byte, error) {
+	if len(payload) < 4+skip+4 {
+		return 0, nil, errors.New("truncated mp4 table")
+	}
+	count := int(binary.BigEndian.Uint32(payload[4+skip:]))
+	rest := payload[8+skip:]
+	if entrySize > 0 && count > len(rest)/entrySize {
+		return 0, nil, errors.New("truncated mp4 table")
+	}
+	return count, rest, nil
+}
+
+// mp4SampleSizes 每帧的大小; 固定大小时帧数来自文件, 需要确认文件放得下这么多帧,
+// 避免伪造的帧数导致分配大量内存
+func mp4SampleSizes(stsz []byte, fileSize uint64) ([]uint32, error) {
+	if len(stsz) < 12 {
+		return nil, errors.New("truncated mp4 table")
+	}
+	fixed := binary.BigEndian.Uint32(stsz[4:])
+	entrySize := 4
+	if fixed != 0 {
+		entrySize = 0
+	}
+	count, rest, err := fullBoxEntries(stsz, 4, entrySize)
+	if err != nil {
+		return nil, err
+	}
+	if fixed != 0 && uint64(count) > fileSize/uint64(fixed) {
+		return nil, fmt.Errorf("mp4 has %d samples of %d bytes, more than the file holds",
+			count, fixed)
+	}
+	sizes := make([]uint32, count)
+	for i := range sizes {
+		if fixed != 0 {
+			sizes[i] = fixed
+		} else {
+			sizes[i] = binary.BigEndian.Uint32(rest[i*4:])
+		}
+	}
+	return sizes, nil
+}
+
+func mp4SampleDurations(stts []byte, samples int) ([]uint32, error) {
+	count, rest, err := fullBoxEntries(stts, 0, 8)
+	if err != nil {
+		return nil, err
+	}
+	durations := make([]uint32, 0, samples)
+	for i := 0; i < count && len(durations) < samples; i++ {
+		n := int(binary.BigEndian.Uint32(rest[i*8:]))
+		delta := binary.BigEndian.Uint32(rest[i*8+4:])
+		for j := 0; j < n && len(durations) < samples; j++ {
+			durations = append(durations, delta)
+		}
+	}
+	if len(durations) < samples {
+		return nil, errors.New("mp4 time table does not cover all samples")
+	}
+	return durations, nil
+}
+
+func mp4ChunkOffsets(stbl *mp4Box) ([]uint64, error) {
+	if stco := stbl.child("stco"); stco != nil {
+		count, rest, err := fullBoxEntries(stco.payload, 0, 4)
+		if err != nil {
+			return nil, err
+		}
+		offsets := make([]uint64, count)
+		for i := range offsets {
+			offsets[i] = uint64(binary.BigEndian.Uint32(rest[i*4:]))
+		}
+		return offsets, nil
+	}
+	if co64 := stbl.child("co64"); co64 != nil {
+		count, rest, err := fullBoxEntries(co64.payload, 0, 8)
+		if err != nil {
+			return nil, err
+		}
+		offsets := make([]uint64, count)
+		for i := range offsets {
+			offsets[i] = binary.BigEndian.Uint64(rest[i*8:])
+		}
+		return offsets, nil
+	}
+	return nil, errors.New("mp4 has no chunk offsets")
+}
+
+// mp4ChunkSamples 展开 stsc, 返回每个 chunk 的帧数
+func mp4ChunkSamples(stsc []byte, chunks int) ([]int, error) {
+	count, rest, err := fullBoxEntries(stsc, 0, 12)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int, chunks)
+	for i := 0; i < count; i++ {
+		first := int(binary.BigEndian.Uint32(rest[i*12:]))
+		perChunk := int(binary.BigEndian.Uint32(rest[i*12+4:]))
+		last := chunks + 1
+		if i+1 < count {
+			last = int(binary.BigEndian.Uint32(rest[(i+1)*12:]))
+		}
+		for c := first; c < last && c <= chunks; c++ {
+			if c >= 1 {
+				result[c-1] = perChunk
+			}
+		}
+	}
+	return result, nil
+}
+
+// mp4Part 写出只包含 samples 的音频文件 (M4A)
+func (t *mp4AudioTrack) mp4Part(data []byte, samples []mp4Sample) []byte {
+	var duration uint64
+	var mdatSize int
+	for _, s := range samples {
+		duration += uint64(s.duration)
+		mdatSize += int(s.size)
+	}
+	ftyp := mp4BoxBytes("ftyp", []byte("M4A \x00\x00\x00\x00M4A mp42isom"))
+	moov := t.moov(samples, duration, 0)
+	// 第二次写入时已知 mdat 的位置
+	moov = t.moov(samples, duration, uint32(len(ftyp)+len(moov)+8))
+
+	out := bytes.NewBuffer(make([]byte, 0, len(ftyp)+len(moov)+8+mdatSize))
+	out.Write(ftyp)
+	out.Write(moov)
+	binary.Write(out, binary.BigEndian, uint32(8+mdatSize))
+	out.WriteString("mdat")
+	for _, s := range samples {
+		out.Write(data[s.offset : s.offset+uint64(s.size)])
+	}
+	return out.Bytes()
+}
+
+var mp4Matrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func (t *mp4AudioTrack) moov(samples []mp4Sample, duration uint64, mdatOffset uint32) []byte {
+	put := func(buf *bytes.Buffer, values ...interface{}) {
+		for _, v := range values {
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	}
+	mvhd := &bytes.Buffer{}
+	put(mvhd, uint32(0), uint32(0), uint32(0), t.timescale, uint32(duration),
+		uint32(0x00010000), uint16(0x0100), make([]byte, 10), mp4Matrix,
+		make([]byte, 24), uint32(2))
+
+	tkhd := &bytes.Buffer{}
+	put(tkhd, uint32(0x00000003), uint32(0), uint32(0), uint32(1), uint32(0),
+		uint32(duration), make([]byte, 8), uint16(0), uint16(0), uint16(0x0100),
+		uint16(0), mp4Matrix, uint32(0), uint32(0))
+
+	mdhd := &bytes.Buffer{}
+	put(mdhd, uint32(0), uint32(0), uint32(0), t.timescale, uint32(duration),
+		t.language, uint16(0))
+
+	stts := &bytes.Buffer{}
+	var runs [][2]uint32
+	for _, s := range samples {
+		if n := len(runs); n > 0 && runs[n-1][1] == s.duration {
+			runs[n-1][0]++
+		} else {
+			runs = append(runs, [2]uint32{1, s.duration})
+		}
+	}
+	put(stts, uint32(0), uint32(len(runs)))
+	for _, run := range runs {
+		put(stts, run[0], run[1])
+	}
+	stsz := &bytes.Buffer{}
+	put(stsz, uint32(0), uint32(0), uint32(len(samples)))
+	for _, s := range samples {
+		put(stsz, s.size)
+	}
+	// 所有帧放在同一个 chunk 中
+	stsc := &bytes.Buffer{}
+	put(stsc, uint32(0), uint32(1), uint32(1), uint32(len(samples)), uint32(1))
+	stco := &bytes.Buffer{}
+	put(stco, uint32(0), uint32(1), mdatOffset)
+
+	url := mp4BoxBytes("url ", []byte{0, 0, 0, 1})
+	dref := mp4BoxBytes("dref", append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, url...))
+	stbl := mp4BoxBytes("stbl", mp4BoxBytes("stsd", t.stsd),
+		mp4BoxBytes("stts", stts.Bytes()), mp4BoxBytes("stsc", stsc.Bytes()),
+		mp4BoxBytes("stsz", stsz.Bytes()), mp4BoxBytes("stco", stco.Bytes()))
+	minf := mp4BoxBytes("minf", mp4BoxBytes("smhd", make([]byte, 8)),
+		mp4BoxBytes("dinf", dref), stbl)
+	mdia := mp4BoxBytes("mdia", mp4BoxBytes("mdhd", mdhd.Bytes()),
+		mp4BoxBytes("hdlr", t.hdlr), minf)
+	trak := mp4BoxBytes("trak", mp4BoxBytes("tkhd", tkhd.Bytes()), mdia)
+	return mp4BoxBytes("moov", mp4BoxBytes("mvhd", mvhd.Bytes()), trak)
+}
+
+func mp4BoxBytes(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	out := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(out, uint32(size))
+	copy(out[4:], typ)
+	for _, p := range payloads {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// ExtractMP4Audio 从 MP4/M4A/MOV 中提取音频轨道, 按 maxBytes 切分为多个 M4A 文件
+func ExtractMP4Audio(data []byte, maxBytes int) ([]Part, error) {
+	track, err := findMP4AudioTrack(data)
+	if err != nil {
+		return nil, err
+	}
+	var parts []Part
+	var start, size int
+	var elapsed, partStart uint64
+	flush := func(end int) {
+		parts = append(parts, Part{
+			Data:   track.mp4Part(data, track.samples[start:end]),
+			Ext:    ".m4a",
+			Offset: float64(partStart) / float64(track.timescale),
+		})
+		start, size, partStart = end, 0, elapsed
+	}
+	for i, s := range track.samples {
+		// 预留文件头和帧表的空间
+		if i > start && mp4PartOverhead+size+int(s.size)+12*(i-start+1) > maxBytes {
+			flush(i)
+		}
+		size += int(s.size)
+		elapsed += uint64(s.duration)
+	}
+	flush(len(track.samples))
+	return parts, nil
+}
+
+// mp4PartOverhead 切分后每个文件除帧数据和帧表以外的大小上限
+const mp4PartOverhead = 4096
@@ -0,0 +1,163 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func be32(values ...uint32) []byte {
+	out := make([]byte, len(values)*4)
+	for i, v := range values {
+		binary.BigEndian.PutUint32(out[i*4:], v)
+	}
+	return out
+}
+
+// testTrak 构造只有采样表的轨道, 每个 chunk 两帧, 帧时长固定为 1024
+func testTrak(handler string, sizes []uint32, chunkOffsets []uint32) []byte {
+	hdlr := append(be32(0, 0), []byte(handler)...)
+	hdlr = append(hdlr, make([]byte, 13)...)
+	mdhd := append(be32(0, 0, 0, 44100, uint32(len(sizes)*1024)), 0x55, 0xc4, 0, 0)
+	stsz := be32(0, 0, uint32(len(sizes)))
+	for _, size := range sizes {
+		stsz = append(stsz, be32(size)...)
+	}
+	stco := be32(0, uint32(len(chunkOffsets)))
+	stco = append(stco, be32(chunkOffsets...)...)
+	stbl := mp4BoxBytes("stbl",
+		mp4BoxBytes("stsd", append(be32(0, 1), mp4BoxBytes("mp4a", make([]byte, 28))...)),
+		mp4BoxBytes("stts", be32(0, 1, uint32(len(sizes)), 1024)),
+		mp4BoxBytes("stsc", be32(0, 1, 1, 2, 1)),
+		mp4BoxBytes("stsz", stsz),
+		mp4BoxBytes("stco", stco))
+	return mp4BoxBytes("trak", mp4BoxBytes("mdia",
+		mp4BoxBytes("mdhd", mdhd),
+		mp4BoxBytes("hdlr", hdlr),
+		mp4BoxBytes("minf", stbl)))
+}
+
+// testVideo 构造视频和音频交错存放的 MP4, 音频帧 i 的内容全部为字节 i
+func testVideo(frames int) []byte {
+	ftyp := mp4BoxBytes("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+	audioSizes := make([]uint32, frames)
+	for i := range audioSizes {
+		audioSizes[i] = uint32(100 + i)
+	}
+	chunks := (frames + 1) / 2
+	videoSizes := make([]uint32, chunks*2)
+	for i := range videoSizes {
+		videoSizes[i] = 500
+	}
+
+	// 先用空偏移计算 moov 的大小, 再填入真实偏移
+	build := func(audioOffsets, videoOffsets []uint32) []byte {
+		return mp4BoxBytes("moov",
+			testTrak("vide", videoSizes, videoOffsets),
+			testTrak("soun", audioSizes, audioOffsets))
+	}
+	audioOffsets := make([]uint32, chunks)
+	videoOffsets := make([]uint32, chunks)
+	moov := build(audioOffsets, videoOffsets)
+
+	mdat := &bytes.Buffer{}
+	start := uint32(len(ftyp) + len(moov) + 8)
+	for c := 0; c < chunks; c++ {
+		videoOffsets[c] = start + uint32(mdat.Len())
+		mdat.Write(bytes.Repeat([]byte{0xee}, 1000))
+		audioOffsets[c] = start + uint32(mdat.Len())
+		for i := c * 2; i < c*2+2 && i < frames; i++ {
+			mdat.Write(bytes.Repeat([]byte{byte(i)}, int(audioSizes[i])))
+		}
+	}
+	moov = build(audioOffsets, videoOffsets)
+	out := append(ftyp, moov...)
+	return append(out, mp4BoxBytes("mdat", mdat.Bytes())...)
+}
+
+func TestExtractMP4Audio(t *testing.T) {
+	video := testVideo(9)
+	tests := []struct {
+		name      string
+		input     []byte
+		maxBytes  int
+		wantParts int
+		wantErr   bool
+	}{
+		{"whole track", video, 1 << 20, 1, false},
+		// 每段最多约 3 帧
+		{"split", video, mp4PartOverhead + 350, 4, false},
+		{"not mp4", []byte("RIFF1234WAVEfmt "), 1 << 20, 0, true},
+		{"truncated", video[:len(video)/2], 1 << 20, 0, true},
+		{"no audio", append(mp4BoxBytes("ftyp", []byte("isom\x00\x00\x00\x00")),
+			mp4BoxBytes("moov", testTrak("vide", []uint32{10}, []uint32{0}))...),
+			1 << 20, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := ExtractMP4Audio(tt.input, tt.maxBytes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractMP4Audio() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(parts) != tt.wantParts {
+				t.Fatalf("got %d parts, want %d", len(parts), tt.wantParts)
+			}
+			frame := 0
+			for i, part := range parts {
+				if len(part.Data) > tt.maxBytes || part.Ext != ".m4a" {
+					t.Errorf("part %d is %d bytes %s, limit %d", i, len(part.Data),
+						part.Ext, tt.maxBytes)
+				}
+				if want := float64(frame*1024) / 44100; part.Offset != want {
+					t.Errorf("part %d offset = %v, want %v", i, part.Offset, want)
+				}
+				// 切分后的文件可以重新解析, 帧的内容和顺序不变
+				track, err := findMP4AudioTrack(part.Data)
+				if err != nil {
+					t.Fatalf("part %d can not be parsed: %v", i, err)
+				}
+				for _, s := range track.samples {
+					data := part.Data[s.offset : s.offset+uint64(s.size)]
+					if int(s.size) != 100+frame || data[0] != byte(frame) ||
+						data[len(data)-1] != byte(frame) || s.duration != 1024 {
+						t.Fatalf("part %d has wrong data for frame %d", i, frame)
+					}
+					frame++
+				}
+			}
+			if frame != 9 {
+				t.Errorf("parts contain %d frames, want 9", frame)
+			}
+		})
+	}
+}
+
+func TestMP4SampleSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		stsz     []byte
+		fileSize uint64
+		want     int
+		wantErr  bool
+	}{
+		{"table", be32(0, 0, 2, 10, 20), 100, 2, false},
+		{"fixed size", be32(0, 10, 5), 100, 5, false},
+		{"fixed size larger than the file", be32(0, 10, 11), 100, 0, true},
+		{"huge count", be32(0, 1, 0xffffffff), 1 << 20, 0, true},
+		{"truncated table", be32(0, 0, 3, 10), 100, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sizes, err := mp4SampleSizes(tt.stsz, tt.fileSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mp4SampleSizes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(sizes) != tt.want {
+				t.Errorf("got %d sizes, want %d", len(sizes), tt.want)
+			}
+		})
+	}
+}
@@ -1,61 +1,332 @@
 package audio
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"os"
 
 	"github.com/pion/opus"
-	"github.com/pion/opus/pkg/oggreader"
 )
 
-func OggToWavByPath(ogg string, wav string) error {
-	input, err := os.Open(ogg)
-	if err != nil {
-		return err
+// OpusSampleRate Opus 解码输出的采样率, pre-skip 和 granule position 都以它为单位
+const OpusSampleRate = 48000
+
+// opusFrameSamples 每个 20ms 帧在 48kHz 下的采样数
+const opusFrameSamples = OpusSampleRate / 50
+
+var (
+	ErrNotOgg  = errors.New("not an ogg stream")
+	ErrNotOpus = errors.New("not an opus stream")
+)
+
+// OpusHead Ogg Opus 的头信息, 见 RFC 7845 5.1
+type OpusHead struct {
+	Version         uint8
+	Channels        int
+	PreSkip         int
+	InputSampleRate int
+	// OutputGain Q7.8 格式的增益, 单位 dB
+	OutputGain    int16
+	MappingFamily uint8
+}
+
+func parseOpusHead(packet []byte) (*OpusHead, error) {
+	if len(packet) < 19 || !bytes.HasPrefix(packet, []byte("OpusHead")) {
+		return nil, ErrNotOpus
 	}
-	defer input.Close()
+	head := &OpusHead{
+		Version:         packet[8],
+		Channels:        int(packet[9]),
+		PreSkip:         int(binary.LittleEndian.Uint16(packet[10:12])),
+		InputSampleRate: int(binary.LittleEndian.Uint32(packet[12:16])),
+		OutputGain:      int16(binary.LittleEndian.Uint16(packet[16:18])),
+		MappingFamily:   packet[18],
+	}
+	// 只支持主版本号为 0 的格式
+	if head.Version>>4 != 0 || head.Channels == 0 {
+		return nil, fmt.Errorf("%w: unsupported version %d with %d channels",
+			ErrNotOpus, head.Version, head.Channels)
+	}
+	return head, nil
+}
 
-	output, err := os.Create(wav)
-	if err != nil {
-		return err
+// oggPage Ogg 页, 见 RFC 3533
+type oggPage struct {
+	headerType      uint8
+	granulePosition int64
+	serial          uint32
+	sequence        uint32
+	// lacing 每个分段的长度, 长度为 255 的分段表示数据包在下一个分段中继续
+	lacing []byte
+	body   []byte
+}
+
+const oggPageHeaderLen = 27
+
+// readOggPage 读取一页并校验 CRC
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggPageHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated ogg page header: %w", err)
+		}
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, ErrNotOgg
+	}
+	if header[4] != 0 {
+		return nil, fmt.Errorf("unsupported ogg version %d", header[4])
+	}
+	page := &oggPage{
+		headerType:      header[5],
+		granulePosition: int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:          binary.LittleEndian.Uint32(header[14:18]),
+		sequence:        binary.LittleEndian.Uint32(header[18:22]),
+		lacing:          make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.lacing); err != nil {
+		return nil, fmt.Errorf("truncated ogg page: %w", err)
+	}
+	size := 0
+	for _, l := range page.lacing {
+		size += int(l)
+	}
+	page.body = make([]byte, size)
+	if _, err := io.ReadFull(r, page.body); err != nil {
+		return nil, fmt.Errorf("truncated ogg page: %w", err)
 	}
 
-	defer output.Close()
-	return OggToWav(input, output)
+	checksum := binary.LittleEndian.Uint32(header[22:26])
+	copy(header[22:26], []byte{0, 0, 0, 0})
+	crc := oggCRC(0, header)
+	crc = oggCRC(crc, page.lacing)
+	crc = oggCRC(crc, page.body)
+	if crc != checksum {
+		return nil, fmt.Errorf("ogg page %d checksum mismatch", page.sequence)
+	}
+	return page, nil
 }
 
-func OggToWav(input io.Reader, output io.WriteSeeker) error {
-	ogg, _, err := oggreader.NewWith(input)
-	if err != nil {
-		return err
+// writeOggPage 写入一页, lacing 和 body 由调用方按 255 字节分段
+func writeOggPage(w io.Writer, page *oggPage) error {
+	header := make([]byte, oggPageHeaderLen)
+	copy(header, "OggS")
+	header[5] = page.headerType
+	binary.LittleEndian.PutUint64(header[6:14], uint64(page.granulePosition))
+	binary.LittleEndian.PutUint32(header[14:18], page.serial)
+	binary.LittleEndian.PutUint32(header[18:22], page.sequence)
+	header[26] = byte(len(page.lacing))
+	crc := oggCRC(0, header)
+	crc = oggCRC(crc, page.lacing)
+	crc = oggCRC(crc, page.body)
+	binary.LittleEndian.PutUint32(header[22:26], crc)
+	for _, data := range [][]byte{header, page.lacing, page.body} {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	out := make([]byte, 1920)
+var oggCRCTable = func() *[256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = (r << 1) ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return &table
+}()
 
-	decoder := opus.NewDecoder()
-	encoder := NewEncoder(output, 44100, 16)
+func oggCRC(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = (crc << 8) ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
 
-	for {
-		segments, _, err := ogg.ParseNextPage()
-		if errors.Is(err, io.EOF) {
+// oggPacketReader 把 Ogg 页中的分段拼接成完整的数据包, 数据包可以跨页
+type oggPacketReader struct {
+	r       io.Reader
+	packets [][]byte
+	partial []byte
+	// granule 最近读取的页的 granule position
+	granule int64
+	eos     bool
+}
+
+func newOggPacketReader(r io.Reader) *oggPacketReader {
+	return &oggPacketReader{r: bufio.NewReader(r), granule: -1}
+}
+
+// next 返回下一个数据包, 读完时返回 io.EOF
+func (o *oggPacketReader) next() ([]byte, error) {
+	for len(o.packets) == 0 {
+		if o.eos {
+			return nil, io.EOF
+		}
+		page, err := readOggPage(o.r)
+		if err != nil {
+			if err == io.EOF && len(o.partial) > 0 {
+				return nil, fmt.Errorf("truncated ogg packet: %w", io.ErrUnexpectedEOF)
+			}
+			return nil, err
+		}
+		o.eos = page.headerType&0x04 != 0
+		if page.granulePosition >= 0 {
+			o.granule = page.granulePosition
+		}
+		offset := 0
+		for _, l := range page.lacing {
+			o.partial = append(o.partial, page.body[offset:offset+int(l)]...)
+			offset += int(l)
+			if l < 255 {
+				o.packets = append(o.packets, o.partial)
+				o.partial = nil
+			}
+		}
+	}
+	packet := o.packets[0]
+	o.packets = o.packets[1:]
+	return packet, nil
+}
+
+// DecodeOggOpus 解码 Ogg Opus 为 48kHz 单声道的 16 位 PCM.
+// 支持映射族 0 的单声道和双声道流, 双声道下混为单声道; 解码器只支持 SILK 编码
+// (飞书语音使用的编码), 以及单声道编码的数据包, 立体声编码的数据包返回错误
+func DecodeOggOpus(input io.Reader) (pcm []int16, head *OpusHead, err error) {
+	// 解码器遇到异常数据时可能 panic, 转换为错误返回
+	defer func() {
+		if r := recover(); r != nil {
+			pcm, head, err = nil, nil, fmt.Errorf("opus decoder: %v", r)
+		}
+	}()
+
+	packets := newOggPacketReader(input)
+	packet, err := packets.next()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil, ErrNotOgg
+		}
+		return nil, nil, err
+	}
+	head, err = parseOpusHead(packet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if head.MappingFamily != 0 || head.Channels > 2 {
+		return nil, nil, fmt.Errorf("%w: %d channels with mapping family %d are not supported",
+			ErrNotOpus, head.Channels, head.MappingFamily)
+	}
+	if _, err = packets.next(); err != nil {
+		return nil, nil, fmt.Errorf("reading opus tags: %w", err)
+	}
+
+	decoder := opus.NewDecoder()
+	frame := make([]float32, opusFrameSamples)
+	gain := math.Pow(10, float64(head.OutputGain)/(20*256))
+	for index := 0; ; index++ {
+		packet, err := packets.next()
+		if err == io.EOF {
 			break
-		} else if bytes.HasPrefix(segments[0], []byte("OpusTags")) {
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		// 空数据包表示丢帧, 补静音
+		if len(packet) == 0 {
+			pcm = append(pcm, make([]int16, opusFrameSamples)...)
 			continue
 		}
-
+		// TOC 的 s 位表示立体声编码. 单声道编码的数据包在双声道流中左右声道相同,
+		// 解码结果就是下混后的单声道
+		if packet[0]&0x04 != 0 {
+			return nil, nil, fmt.Errorf(
+				"decoding opus packet %d: stereo coded packets are not supported", index)
+		}
+		bandwidth, _, err := decoder.DecodeFloat32(packet, frame)
 		if err != nil {
-			panic(err)
+			return nil, nil, fmt.Errorf("decoding opus packet %d: %w", index, err)
 		}
+		pcm = appendFrame(pcm, frame, bandwidth.SampleRate(), gain)
+	}
 
-		for i := range segments {
-			if _, _, err = decoder.Decode(segments[i], out); err != nil {
-				panic(err)
-			}
-			encoder.Write(out)
+	// 去掉编码器的预读, 并按最后一页的 granule position 截掉末尾的补齐
+	if packets.granule >= 0 {
+		if end := int(packets.granule); end < len(pcm) {
+			pcm = pcm[:end]
 		}
 	}
-	encoder.Close()
-	return nil
+	if head.PreSkip >= len(pcm) {
+		return []int16{}, head, nil
+	}
+	return pcm[head.PreSkip:], head, nil
+}
+
+// appendFrame 把解码出的一帧重采样为 48kHz 追加到 pcm 中.
+// 解码器把 SILK 的输出固定放大 3 倍, 只有宽带时正好是 48kHz
+func appendFrame(pcm []int16, frame []float32, bandRate int, gain float64) []int16 {
+	valid := bandRate / 50 * 3
+	if valid <= 0 || valid > len(frame) {
+		valid = len(frame)
+	}
+	for i := 0; i < opusFrameSamples; i++ {
+		// 线性插值
+		pos := float64(i) * float64(valid) / opusFrameSamples
+		j := int(pos)
+		v := float64(frame[j])
+		if j+1 < valid {
+			v += (float64(frame[j+1]) - v) * (pos - float64(j))
+		}
+		v *= gain * 32767
+		if v > math.MaxInt16 {
+			v = math.MaxInt16
+		} else if v < math.MinInt16 {
+			v = math.MinInt16
+		}
+		pcm = append(pcm, int16(v))
+	}
+	return pcm
+}
+
+// OggToWav 把飞书语音 (Ogg Opus) 转换为 48kHz 单声道 16 位 WAV
+func OggToWav(input io.Reader, output io.Writer) error {
+	pcm, _, err := DecodeOggOpus(input)
+	if err != nil {
+		return err
+	}
+	return WriteWav(output, pcm, OpusSampleRate, 1)
+}
+
+// OggToWavBytes 在内存中完成转换
+func OggToWavBytes(ogg []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	if err := OggToWav(bytes.NewReader(ogg), out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func OggToWavByPath(ogg string, wav string) error {
+	data, err := os.ReadFile(ogg)
+	if err != nil {
+		return err
+	}
+	out, err := OggToWavBytes(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(wav, out, 0644)
 }
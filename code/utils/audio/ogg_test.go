@@ -0,0 +1,183 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+)
+
+// testdata/silk_wideband.ogg 来自 pion/opus 的测试数据 (MIT), 由 libopus 编码,
+// 与飞书语音消息相同: 单声道、SILK 宽带、每个数据包 20ms
+
+// buildOgg 把数据包写成 Ogg 流: OpusHead 单独一页, 之后每页最多 maxSegments 个分段,
+// 长数据包会跨页. 只有最后一页带 granule position
+func buildOgg(packets [][]byte, maxSegments int, finalGranule int64) []byte {
+	out := &bytes.Buffer{}
+	sequence := uint32(0)
+	writePage := func(headerType byte, granule int64, lacing []byte, body []byte) {
+		writeOggPage(out, &oggPage{headerType: headerType, granulePosition: granule,
+			serial: 1, sequence: sequence, lacing: lacing, body: body})
+		sequence++
+	}
+	writePage(0x02, 0, []byte{byte(len(packets[0]))}, packets[0])
+
+	var lacing, body []byte
+	for _, packet := range packets[1:] {
+		rest := packet
+		for {
+			n := len(rest)
+			if n > 255 {
+				n = 255
+			}
+			lacing = append(lacing, byte(n))
+			body = append(body, rest[:n]...)
+			rest = rest[n:]
+			if len(lacing) == maxSegments {
+				writePage(0, -1, lacing, body)
+				lacing, body = nil, nil
+			}
+			if n < 255 {
+				break
+			}
+		}
+	}
+	writePage(0x04, finalGranule, lacing, body)
+	return out.Bytes()
+}
+
+func opusHead(channels byte, preSkip uint16) []byte {
+	head := []byte("OpusHead\x01")
+	head = append(head, channels, byte(preSkip), byte(preSkip>>8))
+	// 原始采样率 16kHz, 增益 0, 映射族 0
+	return append(head, 0x80, 0x3e, 0, 0, 0, 0, 0)
+}
+
+// fixturePacket 取出测试文件中唯一的音频数据包
+func fixturePacket(t *testing.T) []byte {
+	data, err := os.ReadFile("testdata/silk_wideband.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := newOggPacketReader(bytes.NewReader(data))
+	var packet []byte
+	for i := 0; i < 3; i++ {
+		if packet, err = packets.next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return packet
+}
+
+type wavHeader struct {
+	Riff          [4]byte
+	Size          uint32
+	Wave          [4]byte
+	Fmt           [4]byte
+	FmtSize       uint32
+	Format        uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+	Data          [4]byte
+	DataSize      uint32
+}
+
+func TestOggToWav(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/silk_wideband.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := fixturePacket(t)
+	fiftyPackets := make([][]byte, 0, 52)
+	fiftyPackets = append(fiftyPackets, opusHead(1, 312), []byte("OpusTags"))
+	for i := 0; i < 50; i++ {
+		fiftyPackets = append(fiftyPackets, packet)
+	}
+
+	tests := []struct {
+		name        string
+		input       []byte
+		wantSamples int
+		wantErr     bool
+	}{
+		// granule 591 - pre-skip 312
+		{"feishu voice fixture", fixture, 279, false},
+		{"one second over pages", buildOgg(fiftyPackets, 7, 50*960), 50*960 - 312, false},
+		{"empty packet is silence", buildOgg([][]byte{opusHead(1, 0), []byte("OpusTags"),
+			packet, {}}, 10, 2*960), 2 * 960, false},
+		{"not ogg", []byte("RIFF....WAVEfmt "), 0, true},
+		{"empty", nil, 0, true},
+		{"truncated", fixture[:len(fixture)-5], 0, true},
+		// 双声道流中单声道编码的数据包下混为单声道
+		{"stereo", buildOgg([][]byte{opusHead(2, 0), []byte("OpusTags"), packet}, 10, 960), 960, false},
+		{"stereo coded packet", buildOgg([][]byte{opusHead(2, 0), []byte("OpusTags"),
+			append([]byte{packet[0] | 0x04}, packet[1:]...)}, 10, 960), 0, true},
+		{"too many channels", buildOgg([][]byte{opusHead(3, 0), []byte("OpusTags"), packet}, 10, 960), 0, true},
+		{"celt packet", buildOgg([][]byte{opusHead(1, 0), []byte("OpusTags"),
+			{0xf8, 0x01, 0x02}}, 10, 960), 0, true},
+		{"not opus", buildOgg([][]byte{[]byte("\x01vorbis........................"),
+			[]byte("tags"), packet}, 10, 960), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := OggToWavBytes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OggToWavBytes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var header wavHeader
+			if err := binary.Read(bytes.NewReader(out), binary.LittleEndian, &header); err != nil {
+				t.Fatal(err)
+			}
+			if string(header.Riff[:]) != "RIFF" || string(header.Wave[:]) != "WAVE" ||
+				string(header.Data[:]) != "data" {
+				t.Fatalf("invalid wav header %+v", header)
+			}
+			if header.Channels != 1 || header.SampleRate != 48000 ||
+				header.ByteRate != 96000 || header.BlockAlign != 2 || header.BitsPerSample != 16 {
+				t.Errorf("wav format = %+v, want 48kHz mono 16 bit", header)
+			}
+			if int(header.DataSize) != len(out)-44 || int(header.Size) != len(out)-8 {
+				t.Errorf("sizes in header = %d/%d, file is %d bytes", header.Size,
+					header.DataSize, len(out))
+			}
+			if got := int(header.DataSize) / 2; got != tt.wantSamples {
+				t.Errorf("samples = %d, want %d", got, tt.wantSamples)
+			}
+		})
+	}
+}
+
+func TestOggPacketReader(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 600)
+	data := buildOgg([][]byte{opusHead(1, 0), []byte("OpusTags"), long, {1, 2, 3}}, 2, 0)
+	packets := newOggPacketReader(bytes.NewReader(data))
+	var got [][]byte
+	for {
+		packet, err := packets.next()
+		if err != nil {
+			break
+		}
+		got = append(got, packet)
+	}
+	if len(got) != 4 || !bytes.Equal(got[2], long) || !bytes.Equal(got[3], []byte{1, 2, 3}) {
+		t.Fatalf("got %d packets, want 4 with the long packet intact", len(got))
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	packets = newOggPacketReader(bytes.NewReader(corrupted))
+	var err error
+	for err == nil {
+		_, err = packets.next()
+	}
+	if err == io.EOF {
+		t.Errorf("corrupted page should fail the checksum")
+	}
+}
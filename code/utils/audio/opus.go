@@ -0,0 +1,257 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// oggOpusSerial 写入的 Ogg 流的序列号, 每个文件只有一个流
+const oggOpusSerial = 0x6f707573
+
+// oggMaxPageSegments 每页最多的分段数, 见 RFC 3533
+const oggMaxPageSegments = 255
+
+// oggPagePackets 每页最多放入的数据包数, 20ms 的帧约 1 秒一页
+const oggPagePackets = 50
+
+// OpusPacketSamples 根据 TOC 计算数据包在 48kHz 下的采样数, 见 RFC 6716 3.1
+func OpusPacketSamples(packet []byte) (int, error) {
+	if len(packet) == 0 {
+		return 0, fmt.Errorf("%w: empty packet", ErrNotOpus)
+	}
+	toc := packet[0]
+	config := int(toc >> 3)
+	var frameSamples int
+	switch {
+	case config < 12: // SILK: 10/20/40/60ms
+		frameSamples = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid: 10/20ms
+		frameSamples = []int{480, 960}[config%2]
+	default: // CELT: 2.5/5/10/20ms
+		frameSamples = []int{120, 240, 480, 960}[config%4]
+	}
+	frames := 1
+	switch toc & 0x03 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, fmt.Errorf("%w: truncated packet", ErrNotOpus)
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	samples := frames * frameSamples
+	// 单个数据包最长 120ms
+	if frames == 0 || samples > 5760 {
+		return 0, fmt.Errorf("%w: invalid frame count %d", ErrNotOpus, frames)
+	}
+	return samples, nil
+}
+
+// OggOpusWriter 把 Opus 数据包封装为 Ogg Opus 文件, 是飞书 audio 消息要求的格式.
+// 只负责封装, 数据包需要由 Opus 编码器 (如语音合成接口) 产生
+type OggOpusWriter struct {
+	w        io.Writer
+	head     OpusHead
+	sequence uint32
+	// samples 已写入的数据包解码后的采样数, 包含 pre-skip
+	samples int64
+	lacing  []byte
+	body    []byte
+	packets int
+}
+
+// NewOggOpusWriter 写入 OpusHead 和 OpusTags 两个头页
+func NewOggOpusWriter(w io.Writer, head OpusHead) (*OggOpusWriter, error) {
+	if head.Channels <= 0 || head.Channels > 2 {
+		return nil, fmt.Errorf("%w: %d channels are not supported", ErrNotOpus,
+			head.Channels)
+	}
+	o := &OggOpusWriter{w: w, head: head}
+
+	idHeader := &bytes.Buffer{}
+	idHeader.WriteString("OpusHead")
+	idHeader.WriteByte(1)
+	idHeader.WriteByte(byte(head.Channels))
+	binary.Write(idHeader, binary.LittleEndian, uint16(head.PreSkip))
+	binary.Write(idHeader, binary.LittleEndian, uint32(head.InputSampleRate))
+	binary.Write(idHeader, binary.LittleEndian, head.OutputGain)
+	// 单声道和立体声都使用映射族 0
+	idHeader.WriteByte(0)
+	if err := o.writeHeaderPage(0x02, idHeader.Bytes()); err != nil {
+		return nil, err
+	}
+
+	vendor := "start-feishubot"
+	tags := &bytes.Buffer{}
+	tags.WriteString("OpusTags")
+	binary.Write(tags, binary.LittleEndian, uint32(len(vendor)))
+	tags.WriteString(vendor)
+	binary.Write(tags, binary.LittleEndian, uint32(0))
+	if err := o.writeHeaderPage(0, tags.Bytes()); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *OggOpusWriter) writeHeaderPage(headerType uint8, packet []byte) error {
+	lacing, body := appendPacket(nil, nil, packet)
+	if len(lacing) > oggMaxPageSegments {
+		return fmt.Errorf("opus header of %d bytes is too large", len(packet))
+	}
+	return o.writePage(headerType, 0, lacing, body)
+}
+
+func (o *OggOpusWriter) writePage(headerType uint8, granule int64,
+	lacing []byte, body []byte) error {
+	err := writeOggPage(o.w, &oggPage{
+		headerType:      headerType,
+		granulePosition: granule,
+		serial:          oggOpusSerial,
+		sequence:        o.sequence,
+		lacing:          lacing,
+		body:            body,
+	})
+	o.sequence++
+	return err
+}
+
+// appendPacket 按 255 字节分段追加数据包, 长度正好是 255 的倍数时以 0 结尾
+func appendPacket(lacing []byte, body []byte, packet []byte) ([]byte, []byte) {
+	for n := len(packet); n >= 255; n -= 255 {
+		lacing = append(lacing, 255)
+	}
+	lacing = append(lacing, byte(len(packet)%255))
+	return lacing, append(body, packet...)
+}
+
+// WritePacket 写入一个 Opus 数据包, 满一页时输出
+func (o *OggOpusWriter) WritePacket(packet []byte) error {
+	samples, err := OpusPacketSamples(packet)
+	if err != nil {
+		return err
+	}
+	segments := len(packet)/255 + 1
+	if segments > oggMaxPageSegments {
+		return fmt.Errorf("opus packet of %d bytes is too large", len(packet))
+	}
+	if len(o.lacing)+segments > oggMaxPageSegments {
+		if err := o.flush(0); err != nil {
+			return err
+		}
+	}
+	o.lacing, o.body = appendPacket(o.lacing, o.body, packet)
+	o.samples += int64(samples)
+	o.packets++
+	if o.packets >= oggPagePackets {
+		return o.flush(0)
+	}
+	return nil
+}
+
+// flush 输出缓存的数据包, granule position 是到页尾为止解码出的采样数
+func (o *OggOpusWriter) flush(headerType uint8) error {
+	if len(o.lacing) == 0 && headerType == 0 {
+		return nil
+	}
+	err := o.writePage(headerType, o.samples, o.lacing, o.body)
+	o.lacing, o.body, o.packets = nil, nil, 0
+	return err
+}
+
+// Close 写入带结束标记的最后一页
+func (o *OggOpusWriter) Close() error {
+	return o.closeAt(o.samples)
+}
+
+// closeAt 结束写入, end 小于已写入的采样数时, 播放器会丢弃最后一页末尾多出的采样
+func (o *OggOpusWriter) closeAt(end int64) error {
+	if end >= 0 && end < o.samples {
+		o.samples = end
+	}
+	return o.flush(0x04)
+}
+
+// DurationMs 已写入音频去掉 pre-skip 后的时长, 单位毫秒
+func (o *OggOpusWriter) DurationMs() int {
+	samples := o.samples - int64(o.head.PreSkip)
+	if samples < 0 {
+		return 0
+	}
+	return int(samples * 1000 / OpusSampleRate)
+}
+
+// RemuxOggOpus 校验语音合成接口返回的 Ogg Opus 并重新封装,
+// 修正页大小和 granule position, 返回新的文件和时长 (毫秒).
+// 这里不做转码, 语音合成接口需要支持 response_format: opus
+func RemuxOggOpus(data []byte) ([]byte, int, error) {
+	if format := sniffAudioFormat(data); format != "" {
+		return nil, 0, fmt.Errorf("%w: got %s audio, the speech endpoint must support "+
+			"response_format opus", ErrNotOgg, format)
+	}
+	packets := newOggPacketReader(bytes.NewReader(data))
+	packet, err := packets.next()
+	if err != nil {
+		if err == io.EOF {
+			return nil, 0, ErrNotOgg
+		}
+		return nil, 0, err
+	}
+	head, err := parseOpusHead(packet)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err = packets.next(); err != nil {
+		return nil, 0, fmt.Errorf("reading opus tags: %w", err)
+	}
+
+	out := &bytes.Buffer{}
+	writer, err := NewOggOpusWriter(out, *head)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		packet, err := packets.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		// 空数据包没有音频内容, 不需要保留
+		if len(packet) == 0 {
+			continue
+		}
+		if err = writer.WritePacket(packet); err != nil {
+			return nil, 0, err
+		}
+	}
+	// 保留原文件末尾的裁剪
+	if err = writer.closeAt(packets.granule); err != nil {
+		return nil, 0, err
+	}
+	return out.Bytes(), writer.DurationMs(), nil
+}
+
+// sniffAudioFormat 识别语音合成接口可能返回的其他格式, 用于错误提示;
+// Ogg 或无法识别时返回空
+func sniffAudioFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return ""
+	case bytes.HasPrefix(data, []byte("ID3")),
+		len(data) >= 2 && data[0] == 0xFF && data[1]&0xE6 == 0xE2:
+		return "mp3"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return "wav"
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return "flac"
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xF6 == 0xF0:
+		return "aac"
+	case IsMP4(data):
+		return "mp4"
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package audio
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestOpusPacketSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		want    int
+		wantErr bool
+	}{
+		{"silk 20ms", []byte{0x48, 0x00}, 960, false},
+		{"silk 60ms", []byte{0x18}, 2880, false},
+		{"hybrid 10ms", []byte{0x60}, 480, false},
+		{"celt 2.5ms", []byte{0x80}, 120, false},
+		{"two frames", []byte{0x49}, 1920, false},
+		{"arbitrary frames", []byte{0xfb, 0x03}, 2880, false},
+		{"too long", []byte{0x1b, 0x03}, 0, true},
+		{"zero frames", []byte{0xfb, 0x00}, 0, true},
+		{"truncated", []byte{0xfb}, 0, true},
+		{"empty", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OpusPacketSamples(tt.packet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OpusPacketSamples() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("OpusPacketSamples() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemuxOggOpus(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/silk_wideband.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := fixturePacket(t)
+	// 三秒的语音, 分散在每页两个分段的小页中
+	long := [][]byte{opusHead(1, 312), []byte("OpusTags")}
+	for i := 0; i < 150; i++ {
+		long = append(long, packet)
+	}
+
+	tests := []struct {
+		name         string
+		input        []byte
+		wantDuration int
+		wantSamples  int
+		wantErr      bool
+	}{
+		{"fixture", fixture, 5, 279, false},
+		{"three seconds", buildOgg(long, 2, 150*960), 2993, 150*960 - 312, false},
+		{"mp3", []byte("ID3\x04"), 0, 0, true},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), 0, 0, true},
+		{"not ogg", []byte("hello"), 0, 0, true},
+		{"celt packet with bad frame count", buildOgg([][]byte{opusHead(1, 0),
+			[]byte("OpusTags"), {0xfb, 0x00}}, 10, 960), 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, duration, err := RemuxOggOpus(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RemuxOggOpus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if duration != tt.wantDuration {
+				t.Errorf("duration = %dms, want %dms", duration, tt.wantDuration)
+			}
+			// 重新封装后的文件可以被正常解码, granule position 决定了采样数
+			pcm, head, err := DecodeOggOpus(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("decoding remuxed stream: %v", err)
+			}
+			if head.PreSkip != 312 || head.Channels != 1 {
+				t.Errorf("head = %+v, want the original pre-skip and channels", head)
+			}
+			if len(pcm) != tt.wantSamples {
+				t.Errorf("samples = %d, want %d", len(pcm), tt.wantSamples)
+			}
+		})
+	}
+}
+
+func TestOggOpusWriterPages(t *testing.T) {
+	out := &bytes.Buffer{}
+	writer, err := NewOggOpusWriter(out, OpusHead{Channels: 1, InputSampleRate: 24000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 120; i++ {
+		if err := writer.WritePacket([]byte{0x48, byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := writer.DurationMs(); got != 2400 {
+		t.Errorf("DurationMs() = %d, want 2400", got)
+	}
+
+	// 两个头页, 之后每页 50 个数据包
+	var granules []int64
+	var last *oggPage
+	r := bytes.NewReader(out.Bytes())
+	for {
+		page, err := readOggPage(r)
+		if err != nil {
+			break
+		}
+		granules = append(granules, page.granulePosition)
+		last = page
+	}
+	want := []int64{0, 0, 50 * 960, 100 * 960, 120 * 960}
+	if len(granules) != len(want) {
+		t.Fatalf("granules = %v, want %v", granules, want)
+	}
+	for i := range want {
+		if granules[i] != want[i] {
+			t.Errorf("page %d granule = %d, want %d", i, granules[i], want[i])
+		}
+	}
+	if last.headerType&0x04 == 0 {
+		t.Errorf("last page should be marked as end of stream")
+	}
+}
+
+func TestSniffAudioFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"ogg", []byte("OggS\x00\x02"), ""},
+		{"mp3 with id3", []byte("ID3\x04\x00"), "mp3"},
+		{"mp3 frame", []byte{0xFF, 0xFB, 0x90, 0x00}, "mp3"},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "wav"},
+		{"flac", []byte("fLaC\x00"), "flac"},
+		{"aac", []byte{0xFF, 0xF1, 0x50, 0x80}, "aac"},
+		{"unknown", []byte("hello"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffAudioFormat(tt.input); got != tt.want {
+				t.Errorf("sniffAudioFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SpeechSampleRate 转写前把 PCM 降采样到 16kHz, 与语音识别模型的输入一致
+const SpeechSampleRate = 16000
+
+var ErrUnsupportedAudio = errors.New("unsupported audio format")
+
+// Part 长录音切分后的一段, Offset 为这一段在原录音中的起始秒数
+type Part struct {
+	Data []byte
+	// Ext 文件扩展名, 语音识别接口按扩展名识别格式
+	Ext    string
+	Offset float64
+}
+
+// WavParts 把 16 位单声道 PCM 切分为不超过 maxSamples 的多段 WAV
+func WavParts(pcm []int16, sampleRate int, maxSamples int) ([]Part, error) {
+	var parts []Part
+	offset := 0
+	for _, chunk := range SplitPCM(pcm, sampleRate, maxSamples) {
+		wav := &bytes.Buffer{}
+		if err := WriteWav(wav, chunk, sampleRate, 1); err != nil {
+			return nil, err
+		}
+		parts = append(parts, Part{
+			Data:   wav.Bytes(),
+			Ext:    ".wav",
+			Offset: float64(offset) / float64(sampleRate),
+		})
+		offset += len(chunk)
+	}
+	return parts, nil
+}
+
+// ReadWav 读取 16 位 PCM WAV, 多声道混合为单声道
+func ReadWav(data []byte) ([]int16, int, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("%w: not a wav file", ErrUnsupportedAudio)
+	}
+	var format, channels, sampleRate, bitDepth int
+	rest := data[12:]
+	for len(rest) >= 8 {
+		id := string(rest[:4])
+		size := int(binary.LittleEndian.Uint32(rest[4:8]))
+		body := rest[8:]
+		// 流式写入的文件 data 大小可能不准确
+		if size > len(body) {
+			size = len(body)
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, fmt.Errorf("%w: invalid wav format chunk", ErrUnsupportedAudio)
+			}
+			format = int(binary.LittleEndian.Uint16(body))
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			bitDepth = int(binary.LittleEndian.Uint16(body[14:]))
+		case "data":
+			// 1 为 PCM, 0xFFFE 为 WAVE_FORMAT_EXTENSIBLE
+			if (format != 1 && format != 0xfffe) || bitDepth != 16 ||
+				channels <= 0 || sampleRate <= 0 {
+				return nil, 0, fmt.Errorf("%w: only 16 bit pcm wav is supported",
+					ErrUnsupportedAudio)
+			}
+			frames := size / 2 / channels
+			pcm := make([]int16, frames)
+			for i := range pcm {
+				sum := 0
+				for c := 0; c < channels; c++ {
+					sum += int(int16(binary.LittleEndian.Uint16(body[(i*channels+c)*2:])))
+				}
+				pcm[i] = int16(sum / channels)
+			}
+			return pcm, sampleRate, nil
+		}
+		// chunk 按偶数字节对齐
+		size += size & 1
+		if size > len(body) {
+			break
+		}
+		rest = body[size:]
+	}
+	return nil, 0, fmt.Errorf("%w: wav has no data", ErrUnsupportedAudio)
+}
+
+// passThroughExts 语音识别接口直接支持, 但这里无法切分的格式
+var passThroughExts = []string{".mp3", ".mpeg", ".mpga", ".webm", ".flac"}
+
+// mediaExts 可以提取音频转写的录音和视频格式
+var mediaExts = append([]string{".ogg", ".opus", ".wav", ".mp4", ".m4a", ".mov"},
+	passThroughExts...)
+
+// IsMediaFile 根据扩展名判断是否为可以转写的录音或视频
+func IsMediaFile(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, supported := range mediaExts {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitForTranscription 提取录音或视频中的音频, 切分为不超过 maxBytes 的多段.
+// 飞书语音 (Ogg Opus) 和 WAV 解码后转为 16kHz WAV, MP4/M4A/MOV 只保留音频轨道,
+// 其他接口支持的格式不超过 maxBytes 时原样上传
+func SplitForTranscription(fileName string, data []byte, maxBytes int) ([]Part, error) {
+	// 16 位单声道 WAV 每个采样 2 字节, 预留文件头
+	maxSamples := (maxBytes - 44) / 2
+	switch {
+	case bytes.HasPrefix(data, []byte("OggS")):
+		pcm, _, err := DecodeOggOpus(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return WavParts(Resample(pcm, OpusSampleRate, SpeechSampleRate),
+			SpeechSampleRate, maxSamples)
+	case bytes.HasPrefix(data, []byte("RIFF")):
+		pcm, rate, err := ReadWav(data)
+		if err != nil {
+			return nil, err
+		}
+		return WavParts(Resample(pcm, rate, SpeechSampleRate), SpeechSampleRate,
+			maxSamples)
+	case IsMP4(data):
+		return ExtractMP4Audio(data, maxBytes)
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, supported := range passThroughExts {
+		if ext != supported {
+			continue
+		}
+		if len(data) > maxBytes {
+			return nil, fmt.Errorf("%w: %s files larger than %dMB can not be split",
+				ErrUnsupportedAudio, ext, maxBytes/1024/1024)
+		}
+		return []Part{{Data: data, Ext: ext}}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAudio, fileName)
+}
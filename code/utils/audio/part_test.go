@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSplitForTranscription(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/silk_wideband.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav := &bytes.Buffer{}
+	WriteWav(wav, make([]int16, 48000*3), 48000, 1)
+	stereo := &bytes.Buffer{}
+	WriteWav(stereo, []int16{100, 300, -100, -300}, 8000, 2)
+
+	tests := []struct {
+		name      string
+		fileName  string
+		input     []byte
+		maxBytes  int
+		wantParts int
+		wantExt   string
+		wantErr   bool
+	}{
+		{"feishu voice", "voice.opus", fixture, 1 << 20, 1, ".wav", false},
+		// 在静音处切分, 每段略短于 1 秒
+		{"wav split", "a.wav", wav.Bytes(), 16000*2 + 44, 4, ".wav", false},
+		{"stereo wav", "b.wav", stereo.Bytes(), 1 << 20, 1, ".wav", false},
+		{"video", "meeting.mp4", testVideo(4), 1 << 20, 1, ".m4a", false},
+		{"mp3 as is", "c.MP3", []byte("ID3 fake mp3"), 1 << 20, 1, ".mp3", false},
+		{"mp3 too large", "c.mp3", make([]byte, 200), 100, 0, "", true},
+		{"unknown", "d.avi", []byte("RIFF....AVI "), 1 << 20, 0, "", true},
+		{"unknown extension", "e.txt", []byte("hello"), 1 << 20, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := SplitForTranscription(tt.fileName, tt.input, tt.maxBytes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitForTranscription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(parts) != tt.wantParts || parts[0].Ext != tt.wantExt {
+				t.Fatalf("got %d parts of %s, want %d of %s", len(parts),
+					parts[0].Ext, tt.wantParts, tt.wantExt)
+			}
+			samples := 0
+			for i, part := range parts {
+				if len(part.Data) > tt.maxBytes {
+					t.Errorf("part %d is %d bytes, limit %d", i, len(part.Data), tt.maxBytes)
+				}
+				if part.Ext == ".wav" {
+					want := float64(samples) / SpeechSampleRate
+					if part.Offset != want {
+						t.Errorf("part %d starts at %vs, want %vs", i, part.Offset, want)
+					}
+					samples += (len(part.Data) - 44) / 2
+				}
+			}
+		})
+	}
+
+	pcm, rate, err := ReadWav(stereo.Bytes())
+	if err != nil || rate != 8000 || len(pcm) != 2 || pcm[0] != 200 || pcm[1] != -200 {
+		t.Errorf("ReadWav() = %v, %d, %v, want the stereo channels mixed", pcm, rate, err)
+	}
+}
+
+func TestIsMediaFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"meeting.MP4": true, "call.m4a": true, "voice.opus": true, "talk.mp3": true,
+		"notes.pdf": false, "video.avi": false, "noext": false,
+	} {
+		if got := IsMediaFile(name); got != want {
+			t.Errorf("IsMediaFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package audio
+
+// Resample 转换 16 位 PCM 的采样率. 整数倍降采样时取平均值, 避免混叠;
+// 其他情况使用线性插值
+func Resample(pcm []int16, from int, to int) []int16 {
+	if from == to || from <= 0 || to <= 0 || len(pcm) == 0 {
+		return pcm
+	}
+	if from > to && from%to == 0 {
+		factor := from / to
+		out := make([]int16, 0, len(pcm)/factor+1)
+		for i := 0; i < len(pcm); i += factor {
+			end := i + factor
+			if end > len(pcm) {
+				end = len(pcm)
+			}
+			sum := 0
+			for _, v := range pcm[i:end] {
+				sum += int(v)
+			}
+			out = append(out, int16(sum/(end-i)))
+		}
+		return out
+	}
+	n := int(int64(len(pcm)) * int64(to) / int64(from))
+	out := make([]int16, n)
+	for i := range out {
+		pos := float64(i) * float64(from) / float64(to)
+		j := int(pos)
+		v := float64(pcm[j])
+		if j+1 < len(pcm) {
+			v += (float64(pcm[j+1]) - v) * (pos - float64(j))
+		}
+		out[i] = int16(v)
+	}
+	return out
+}
+
+// silenceSearchSeconds 在每段末尾的这段时间内寻找最安静的位置切分
+const silenceSearchSeconds = 5
+
+// SplitPCM 把 PCM 切分为不超过 maxSamples 的多段, 尽量在停顿处切分, 避免切断词语
+func SplitPCM(pcm []int16, sampleRate int, maxSamples int) [][]int16 {
+	if maxSamples <= 0 {
+		return [][]int16{pcm}
+	}
+	search := silenceSearchSeconds * sampleRate
+	if search > maxSamples/2 {
+		search = maxSamples / 2
+	}
+	// 以 100ms 为窗口比较能量
+	window := sampleRate / 10
+	if window <= 0 || window > search {
+		window = search
+	}
+	var chunks [][]int16
+	for len(pcm) > maxSamples {
+		cut := quietestPoint(pcm, maxSamples-search, maxSamples, window)
+		chunks = append(chunks, pcm[:cut])
+		pcm = pcm[cut:]
+	}
+	return append(chunks, pcm)
+}
+
+// quietestPoint 返回 [lo, hi) 中能量最低的窗口的中点, 相同时取靠后的, 让每段尽量长
+func quietestPoint(pcm []int16, lo int, hi int, window int) int {
+	if window <= 0 {
+		return hi
+	}
+	best, bestEnergy := hi, int64(-1)
+	step := window/2 + 1
+	for start := lo; start+window <= hi; start += step {
+		var energy int64
+		for _, v := range pcm[start : start+window] {
+			energy += int64(v) * int64(v)
+		}
+		if bestEnergy < 0 || energy <= bestEnergy {
+			best, bestEnergy = start+window/2, energy
+		}
+	}
+	if best <= 0 {
+		return hi
+	}
+	return best
+}
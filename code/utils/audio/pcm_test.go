@@ -0,0 +1,81 @@
+package audio
+
+import "testing"
+
+// tone 生成振幅为 amplitude 的方波
+func tone(samples int, amplitude int16) []int16 {
+	pcm := make([]int16, samples)
+	for i := range pcm {
+		if i%20 < 10 {
+			pcm[i] = amplitude
+		} else {
+			pcm[i] = -amplitude
+		}
+	}
+	return pcm
+}
+
+func TestResample(t *testing.T) {
+	tests := []struct {
+		name    string
+		pcm     []int16
+		from    int
+		to      int
+		want    []int16
+		wantLen int
+	}{
+		{"same rate", []int16{1, 2, 3}, 16000, 16000, []int16{1, 2, 3}, 3},
+		{"average on integer factor", []int16{3, 6, 9, 30, 60, 90, 7}, 48000, 16000,
+			[]int16{6, 60, 7}, 3},
+		{"interpolate up", []int16{0, 10}, 8000, 16000, []int16{0, 5, 10, 10}, 4},
+		{"non integer factor", make([]int16, 44100), 44100, 16000, nil, 16000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resample(tt.pcm, tt.from, tt.to)
+			if len(got) != tt.wantLen {
+				t.Fatalf("Resample() returned %d samples, want %d", len(got), tt.wantLen)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Resample() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSplitPCM(t *testing.T) {
+	const rate = 1000
+	// 25 秒的语音, 在第 8 秒和第 17 秒处各有 0.5 秒的停顿
+	var pcm []int16
+	pcm = append(pcm, tone(8*rate, 8000)...)
+	pcm = append(pcm, make([]int16, rate/2)...)
+	pcm = append(pcm, tone(8500, 8000)...)
+	pcm = append(pcm, make([]int16, rate/2)...)
+	pcm = append(pcm, tone(7500, 8000)...)
+
+	chunks := SplitPCM(pcm, rate, 10*rate)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	total := 0
+	for i, chunk := range chunks {
+		if len(chunk) > 10*rate {
+			t.Errorf("chunk %d has %d samples, limit %d", i, len(chunk), 10*rate)
+		}
+		total += len(chunk)
+	}
+	if total != len(pcm) {
+		t.Errorf("chunks have %d samples in total, want %d", total, len(pcm))
+	}
+	// 切分点应落在停顿中
+	if cut := len(chunks[0]); cut < 8*rate || cut > 8*rate+rate/2 {
+		t.Errorf("first cut at %d, want inside the pause at 8000-8500", cut)
+	}
+
+	if got := SplitPCM(pcm[:5*rate], rate, 10*rate); len(got) != 1 || len(got[0]) != 5*rate {
+		t.Errorf("short audio should not be split")
+	}
+}
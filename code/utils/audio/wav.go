@@ -1,77 +1,69 @@
 package audio
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 )
 
 type Encoder struct {
-	Output          io.WriteSeeker
-	SampleRate      int
-	BitDepth        int
+	Output     io.WriteSeeker
+	SampleRate int
+	BitDepth   int
+	// Channels 为 0 时按单声道处理
+	Channels        int
 	totalBytes      uint32
 	isHeaderWritten bool
 }
 
-func (e *Encoder) WriteHeader() error {
-	if err := writeLe(e.Output, []byte("RIFF")); err != nil {
-		return err
-	}
-
-	if err := writeLe(e.Output, uint32(0)); err != nil { // Placeholder for file size
-		return err
-	}
-
-	if err := writeLe(e.Output, []byte("WAVE")); err != nil {
-		return err
-	}
-
-	if err := writeLe(e.Output, []byte("fmt ")); err != nil {
-		return err
-	}
-	if err := writeLe(e.Output, uint32(16)); err != nil {
-		return err
-	}
-
-	if err := writeLe(e.Output, uint16(1)); err != nil { // Audio format: PCM
-		return err
-	}
-	if err := writeLe(e.Output, uint16(1)); err != nil { // Number of channels: 1 (mono)
-		return err
-	}
-	if err := writeLe(e.Output, uint32(e.SampleRate)); err != nil {
-		return err
-	}
-
-	if err := writeLe(e.Output, uint32(e.SampleRate*e.BitDepth/8)); err != nil {
-		return err
-	}
-
-	if err := writeLe(e.Output, uint16(e.BitDepth/8)); err != nil {
-		return err
-	}
-	if err := writeLe(e.Output, uint16(e.BitDepth)); err != nil {
-		return err
+// writeWavHeader 写入 44 字节的 PCM WAV 头
+func writeWavHeader(w io.Writer, sampleRate int, bitDepth int, channels int,
+	dataSize uint32) error {
+	blockAlign := channels * bitDepth / 8
+	fields := []interface{}{
+		[]byte("RIFF"),
+		uint32(36 + dataSize),
+		[]byte("WAVE"),
+		[]byte("fmt "),
+		uint32(16),
+		uint16(1), // Audio format: PCM
+		uint16(channels),
+		uint32(sampleRate),
+		uint32(sampleRate * blockAlign), // Byte rate
+		uint16(blockAlign),
+		uint16(bitDepth),
+		[]byte("data"),
+		dataSize,
+	}
+	for _, field := range fields {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	if err := writeLe(e.Output, []byte("data")); err != nil {
-		return err
+func (e *Encoder) channels() int {
+	if e.Channels <= 0 {
+		return 1
 	}
+	return e.Channels
+}
 
-	if err := writeLe(e.Output, uint32(0)); err != nil { //Placeholder for data size
+func (e *Encoder) WriteHeader() error {
+	// 数据大小在 Close 时回填
+	if err := writeWavHeader(e.Output, e.SampleRate, e.BitDepth, e.channels(), 0); err != nil {
 		return err
 	}
 	e.isHeaderWritten = true
 	return nil
 }
 
-func writeLe[T []byte | uint32 | uint16 | uint8](w io.Writer, data T) error {
-	return binary.Write(w, binary.LittleEndian, data)
-}
-
 func (e *Encoder) Write(data []byte) error {
 	if !e.isHeaderWritten {
-		e.WriteHeader()
+		if err := e.WriteHeader(); err != nil {
+			return err
+		}
 	}
 	n, err := e.Output.Write(data)
 	if err != nil {
@@ -82,6 +74,11 @@ func (e *Encoder) Write(data []byte) error {
 }
 
 func (e *Encoder) Close() error {
+	if !e.isHeaderWritten {
+		if err := e.WriteHeader(); err != nil {
+			return err
+		}
+	}
 	if _, err := e.Output.Seek(4, io.SeekStart); err != nil {
 		return err
 	}
@@ -94,7 +91,8 @@ func (e *Encoder) Close() error {
 	if err := binary.Write(e.Output, binary.LittleEndian, e.totalBytes); err != nil {
 		return err
 	}
-	return nil
+	_, err := e.Output.Seek(0, io.SeekEnd)
+	return err
 }
 
 func NewEncoder(w io.WriteSeeker, sampleRate int, bitDepth int) *Encoder {
@@ -105,3 +103,17 @@ func NewEncoder(w io.WriteSeeker, sampleRate int, bitDepth int) *Encoder {
 		isHeaderWritten: false,
 	}
 }
+
+// WriteWav 把 16 位 PCM 写为完整的 WAV, 不需要 Seek
+func WriteWav(w io.Writer, pcm []int16, sampleRate int, channels int) error {
+	data := &bytes.Buffer{}
+	data.Grow(len(pcm) * 2)
+	if err := binary.Write(data, binary.LittleEndian, pcm); err != nil {
+		return err
+	}
+	if err := writeWavHeader(w, sampleRate, 16, channels, uint32(data.Len())); err != nil {
+		return err
+	}
+	_, err := w.Write(data.Bytes())
+	return err
+}
@@ -36,3 +36,24 @@ func EitherTrimEqual(s string, prefix ...string) (string, bool) {
 	}
 	return s, false
 }
+
+// CutCommand 匹配命令本身或命令后跟空白和参数, 返回去掉首尾空白的参数.
+// aliases 为不带斜杠的别名, 只在整条消息等于别名时匹配, 避免普通提问被当作命令
+func CutCommand(s, command string, aliases ...string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == command {
+		return "", true
+	}
+	if strings.HasPrefix(s, command) {
+		rest := s[len(command):]
+		if trimmed := strings.TrimLeft(rest, " \t\n"); trimmed != rest {
+			return strings.TrimSpace(trimmed), true
+		}
+	}
+	for _, alias := range aliases {
+		if s == alias {
+			return "", true
+		}
+	}
+	return s, false
+}
@@ -107,3 +107,33 @@ func TestEitherTrimEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestCutCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		aliases []string
+		want    string
+		want1   bool
+	}{
+		{"command", " /schedule ", nil, "", true},
+		{"command with args", "/schedule add 0 9 * * 1 | hi", nil, "add 0 9 * * 1 | hi", true},
+		{"command with newline", "/schedule\nlist", nil, "list", true},
+		{"longer command", "/schedules", nil, "/schedules", false},
+		{"alias", "Schedule", []string{"Schedule"}, "", true},
+		{"alias in a sentence", "Schedule a sync with the team", []string{"Schedule"},
+			"Schedule a sync with the team", false},
+		{"other text", "hello", []string{"Schedule"}, "hello", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := CutCommand(tt.s, "/schedule", tt.aliases...)
+			if got != tt.want {
+				t.Errorf("CutCommand() got = %q, want %q", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("CutCommand() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}